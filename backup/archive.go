@@ -0,0 +1,260 @@
+// Package backup writes and reads offline copies of a docbot
+// document series.
+//
+// An archive is either a directory or a gzipped tarball (a path
+// ending in .tar.gz or .tgz).  It holds manifest.json, listing each
+// document with the SHA-256 of each of its files, and the files
+// themselves under docs/<file ID>/.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+const (
+	// Format identifies a docbot backup manifest.
+	Format = "docbot-backup"
+	// Version is the manifest layout version written by this code.
+	Version = 1
+	// ManifestFile is the manifest's path within an archive.
+	ManifestFile = "manifest.json"
+)
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Format    string   `json:"format"`
+	Version   int      `json:"version"`
+	Created   string   `json:"created"`
+	Folderid  string   `json:"folderid"`
+	Docprefix string   `json:"docprefix"`
+	Docs      []*Entry `json:"docs"`
+}
+
+// Entry describes one document in an archive.
+type Entry struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Num      int    `json:"num"`
+	Modified string `json:"modified"`
+	Version  int64  `json:"version"`
+	// Removed is the time a backup first found the document missing
+	// from the folder, or "" if it is still there.
+	Removed string `json:"removed,omitempty"`
+	// Files maps file names to SHA-256 checksums in hex.
+	Files map[string]string `json:"files"`
+	// Status says what the backup that wrote this manifest did with
+	// the document: "fetched", "unchanged" or "removed".
+	Status string `json:"-"`
+}
+
+// Dir returns the directory holding e's files within an archive.
+func (e *Entry) Dir() string {
+	return path.Join("docs", e.Id)
+}
+
+// Checksum returns the hex SHA-256 of buf.
+func Checksum(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsTarball returns true if fn names a gzipped tarball.
+func IsTarball(fn string) bool {
+	return strings.HasSuffix(fn, ".tar.gz") || strings.HasSuffix(fn, ".tgz")
+}
+
+// NewManifest returns an empty manifest for the given folder.
+func NewManifest(folderid, docprefix string, now time.Time) *Manifest {
+	return &Manifest{
+		Format:    Format,
+		Version:   Version,
+		Created:   now.UTC().Format(time.RFC3339),
+		Folderid:  folderid,
+		Docprefix: docprefix,
+	}
+}
+
+// Archive is an archive opened for reading.
+type Archive struct {
+	Manifest *Manifest
+	// read returns the contents of the file at name.
+	read func(name string) ([]byte, error)
+}
+
+// Open opens the archive at fn and reads its manifest.
+func Open(fn string) (a *Archive, err error) {
+	defer Return(&err)
+	a = &Archive{}
+	if IsTarball(fn) {
+		files, err := readTarball(fn)
+		Ck(err)
+		a.read = func(name string) ([]byte, error) {
+			buf, ok := files[name]
+			if !ok {
+				return nil, fmt.Errorf("%s: no such file in %s", name, fn)
+			}
+			return buf, nil
+		}
+	} else {
+		a.read = func(name string) ([]byte, error) {
+			return ioutil.ReadFile(filepath.Join(fn, filepath.FromSlash(name)))
+		}
+	}
+
+	buf, err := a.read(ManifestFile)
+	Ck(err)
+	m := &Manifest{}
+	err = json.Unmarshal(buf, m)
+	Ck(err, fn)
+	Assert(m.Format == Format, "%s: not a docbot backup", fn)
+	Assert(m.Version <= Version, "%s: backup version %d is newer than %d", fn, m.Version, Version)
+	a.Manifest = m
+	return
+}
+
+// ReadFile returns the file fn of entry e, failing if it doesn't
+// match its checksum in the manifest.
+func (a *Archive) ReadFile(e *Entry, fn string) (buf []byte, err error) {
+	defer Return(&err)
+	sum, ok := e.Files[fn]
+	Assert(ok, "%s: no %s in backup", e.Name, fn)
+	buf, err = a.read(path.Join(e.Dir(), fn))
+	Ck(err)
+	Assert(Checksum(buf) == sum, "%s: checksum mismatch in %s", e.Name, fn)
+	return
+}
+
+// Verify checks every file in the archive against its checksum.
+func (a *Archive) Verify() (err error) {
+	defer Return(&err)
+	for _, e := range a.Manifest.Docs {
+		for fn := range e.Files {
+			_, err = a.ReadFile(e, fn)
+			Ck(err)
+		}
+	}
+	return
+}
+
+func readTarball(fn string) (files map[string][]byte, err error) {
+	defer Return(&err)
+	f, err := os.Open(fn)
+	Ck(err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	Ck(err, fn)
+	tr := tar.NewReader(gz)
+	files = make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		Ck(err, fn)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		buf, err := ioutil.ReadAll(tr)
+		Ck(err, fn)
+		files[hdr.Name] = buf
+	}
+	return
+}
+
+// writer stores files in a new or existing archive.
+type writer interface {
+	write(name string, buf []byte) error
+	close() error
+}
+
+// create returns a writer for the archive at fn.  A tarball is
+// written to a temporary file and only replaces fn when closed.
+func create(fn string) (w writer, err error) {
+	defer Return(&err)
+	if !IsTarball(fn) {
+		err = os.MkdirAll(fn, 0755)
+		Ck(err)
+		return &dirWriter{dir: fn}, nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fn), ".docbot-backup-*")
+	Ck(err)
+	gz := gzip.NewWriter(f)
+	return &tarWriter{dest: fn, f: f, gz: gz, tw: tar.NewWriter(gz)}, nil
+}
+
+type dirWriter struct {
+	dir string
+}
+
+func (w *dirWriter) write(name string, buf []byte) (err error) {
+	defer Return(&err)
+	fn := filepath.Join(w.dir, filepath.FromSlash(name))
+	err = os.MkdirAll(filepath.Dir(fn), 0755)
+	Ck(err)
+	err = ioutil.WriteFile(fn, buf, 0644)
+	Ck(err)
+	return
+}
+
+func (w *dirWriter) close() error { return nil }
+
+type tarWriter struct {
+	dest string
+	f    *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func (w *tarWriter) write(name string, buf []byte) (err error) {
+	defer Return(&err)
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(buf)),
+		ModTime: time.Now(),
+	}
+	err = w.tw.WriteHeader(hdr)
+	Ck(err)
+	_, err = w.tw.Write(buf)
+	Ck(err)
+	return
+}
+
+func (w *tarWriter) close() (err error) {
+	defer Return(&err)
+	defer os.Remove(w.f.Name())
+	err = w.tw.Close()
+	Ck(err)
+	err = w.gz.Close()
+	Ck(err)
+	err = w.f.Close()
+	Ck(err)
+	err = os.Rename(w.f.Name(), w.dest)
+	Ck(err)
+	return
+}
+
+// writeManifest stores m in w.  It is written last so that an
+// interrupted backup leaves the previous manifest in place.
+func writeManifest(w writer, m *Manifest) (err error) {
+	defer Return(&err)
+	buf, err := json.MarshalIndent(m, "", "  ")
+	Ck(err)
+	err = w.write(ManifestFile, append(buf, '\n'))
+	Ck(err)
+	return
+}
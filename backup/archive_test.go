@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func writeArchive(t *testing.T, fn string) *Manifest {
+	w, err := create(fn)
+	Tassert(t, err == nil, err)
+	m := NewManifest("folder", "mcp", time.Now())
+	e := &Entry{Id: "abc", Name: "mcp-1-foo", Num: 1, Version: 7, Files: map[string]string{}}
+	for name, txt := range map[string]string{
+		"document.txt": "hello\n",
+		"document.md":  "# hello\n",
+	} {
+		err = w.write(path.Join(e.Dir(), name), []byte(txt))
+		Tassert(t, err == nil, err)
+		e.Files[name] = Checksum([]byte(txt))
+	}
+	m.Docs = append(m.Docs, e)
+	err = writeManifest(w, m)
+	Tassert(t, err == nil, err)
+	err = w.close()
+	Tassert(t, err == nil, err)
+	return m
+}
+
+func TestArchive(t *testing.T) {
+	for _, name := range []string{"dir", "backup.tar.gz", "backup.tgz"} {
+		fn := filepath.Join(t.TempDir(), name)
+		writeArchive(t, fn)
+		a, err := Open(fn)
+		Tassert(t, err == nil, name, err)
+		Tassert(t, len(a.Manifest.Docs) == 1, name)
+		e := a.Manifest.Docs[0]
+		Tassert(t, e.Name == "mcp-1-foo" && e.Version == 7, name, e)
+		buf, err := a.ReadFile(e, "document.md")
+		Tassert(t, err == nil, name, err)
+		Tassert(t, string(buf) == "# hello\n", name, string(buf))
+		err = a.Verify()
+		Tassert(t, err == nil, name, err)
+		_, err = a.ReadFile(e, "document.docx")
+		Tassert(t, err != nil, name)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, dir)
+	err := ioutil.WriteFile(filepath.Join(dir, "docs", "abc", "document.txt"), []byte("tampered\n"), 0644)
+	Tassert(t, err == nil, err)
+	a, err := Open(dir)
+	Tassert(t, err == nil, err)
+	err = a.Verify()
+	Tassert(t, err != nil)
+}
+
+func TestUnchanged(t *testing.T) {
+	e := &Entry{Name: "mcp-1-foo", Version: 7, Modified: "2022-01-01T00:00:00Z"}
+	cur := *e
+	Tassert(t, e.unchanged(&cur))
+	cur.Version = 8
+	Tassert(t, !e.unchanged(&cur))
+	cur = *e
+	cur.Name = "mcp-1-bar"
+	Tassert(t, !e.unchanged(&cur))
+	e.Removed = "2022-02-01T00:00:00Z"
+	Tassert(t, !e.unchanged(e))
+}
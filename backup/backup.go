@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// Backup writes every Google Doc in the transaction's folder to the
+// archive at dest.  If incremental is true and dest already holds a
+// backup, documents whose Drive version hasn't changed are copied
+// from it instead of being fetched again, and documents that have
+// left the folder are kept and marked as removed.
+func Backup(tx *transaction.Transaction, folderid, docprefix, dest string, incremental bool) (m *Manifest, err error) {
+	defer Return(&err)
+	now := time.Now()
+
+	prev := make(map[string]*Entry)
+	var old *Archive
+	if incremental {
+		old, err = Open(dest)
+		if errors.Is(err, os.ErrNotExist) {
+			old, err = nil, nil
+		}
+		Ck(err)
+	}
+	if old != nil {
+		for _, e := range old.Manifest.Docs {
+			prev[e.Id] = e
+		}
+	}
+
+	w, err := create(dest)
+	Ck(err)
+	// files of an unchanged doc are already in place in a directory
+	// being updated, but must be copied into a new tarball
+	inPlace := old != nil && !IsTarball(dest)
+
+	m = NewManifest(folderid, docprefix, now)
+	nodes, err := tx.AllNodes()
+	Ck(err)
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		if node.MimeType() != google.DocMimeType {
+			continue
+		}
+		seen[node.Id()] = true
+		e := &Entry{
+			Id:       node.Id(),
+			Name:     node.Name(),
+			Num:      node.Num(),
+			Modified: node.Modified(),
+			Version:  node.Version(),
+			Files:    make(map[string]string),
+			Status:   "fetched",
+		}
+		p, ok := prev[e.Id]
+		if ok && p.unchanged(e) {
+			e.Files = p.Files
+			e.Status = "unchanged"
+			if !inPlace {
+				err = copyEntry(w, old, p)
+				Ck(err)
+			}
+			m.Docs = append(m.Docs, e)
+			continue
+		}
+		files, err := tx.DocFiles(node)
+		Ck(err, node.Name())
+		for fn, buf := range files {
+			err = w.write(path.Join(e.Dir(), fn), buf)
+			Ck(err)
+			e.Files[fn] = Checksum(buf)
+		}
+		m.Docs = append(m.Docs, e)
+	}
+
+	// keep documents that have been deleted since the last backup
+	for id, p := range prev {
+		if seen[id] {
+			continue
+		}
+		if p.Removed == "" {
+			p.Removed = m.Created
+		}
+		p.Status = "removed"
+		if !inPlace {
+			err = copyEntry(w, old, p)
+			Ck(err)
+		}
+		m.Docs = append(m.Docs, p)
+	}
+
+	sort.SliceStable(m.Docs, func(i, j int) bool {
+		if m.Docs[i].Num != m.Docs[j].Num {
+			return m.Docs[i].Num < m.Docs[j].Num
+		}
+		return m.Docs[i].Name < m.Docs[j].Name
+	})
+	err = writeManifest(w, m)
+	Ck(err)
+	err = w.close()
+	Ck(err)
+	return
+}
+
+// unchanged returns true if cur describes the same revision of the
+// document that e was backed up from.
+func (e *Entry) unchanged(cur *Entry) bool {
+	return e.Removed == "" &&
+		e.Name == cur.Name &&
+		e.Version == cur.Version &&
+		e.Modified == cur.Modified
+}
+
+// copyEntry copies e's files from archive a to w, verifying their
+// checksums.
+func copyEntry(w writer, a *Archive, e *Entry) (err error) {
+	defer Return(&err)
+	for fn := range e.Files {
+		buf, err := a.ReadFile(e, fn)
+		Ck(err)
+		err = w.write(path.Join(e.Dir(), fn), buf)
+		Ck(err)
+	}
+	return
+}
+
+// RestoreItem reports what Restore did with one document.
+type RestoreItem struct {
+	*Entry
+	// Node is the restored document, or nil if it was skipped or
+	// this is a dry run.
+	Node *google.Node
+	// Skipped explains why the document was not restored.
+	Skipped  string
+	Warnings []string
+}
+
+// Restore recreates the documents in the archive at src, other than
+// those marked removed, in the transaction's folder under their
+// original names.  Documents whose name is already taken are skipped.
+// Every checksum is verified before anything is uploaded.  If dryRun
+// is true, nothing is changed and the returned items show what would
+// be done.
+func Restore(tx *transaction.Transaction, src string, dryRun bool) (items []*RestoreItem, err error) {
+	defer Return(&err)
+	a, err := Open(src)
+	Ck(err)
+	err = a.Verify()
+	Ck(err)
+
+	for _, e := range a.Manifest.Docs {
+		if e.Removed != "" {
+			continue
+		}
+		item := &RestoreItem{Entry: e}
+		items = append(items, item)
+		existing, err := tx.GetByName(e.Name)
+		Ck(err)
+		if existing != nil {
+			item.Skipped = "already exists"
+			continue
+		}
+		if dryRun {
+			continue
+		}
+		docx, err := a.ReadFile(e, transaction.DocDocxFile)
+		Ck(err)
+		var perms []byte
+		if _, ok := e.Files[transaction.PermissionsFile]; ok {
+			perms, err = a.ReadFile(e, transaction.PermissionsFile)
+			Ck(err)
+		}
+		item.Node, item.Warnings, err = tx.Restore(e.Name, docx, perms)
+		Ck(err)
+	}
+	return
+}
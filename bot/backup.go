@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"github.com/stevegt/docbot/backup"
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// BackupTo writes the document series to the archive at dest.
+func (b *Bot) BackupTo(tx *transaction.Transaction, dest string, incremental bool) (m *backup.Manifest, err error) {
+	conf := b.CurrentConf()
+	return backup.Backup(tx, conf.Folderid, conf.Docprefix, dest, incremental)
+}
+
+// RestoreFrom recreates the documents in the archive at src in the
+// Drive folder folderid, or in the configured folder if folderid is
+// "".  It starts its own transaction.
+func (b *Bot) RestoreFrom(src, folderid string, dryRun bool) (items []*backup.RestoreItem, err error) {
+	defer Return(&err)
+	conf := b.CurrentConf()
+	b.mu.RLock()
+	gf := b.repo
+	b.mu.RUnlock()
+	if folderid != "" && folderid != conf.Folderid {
+		gf, err = b.OpenFolder(folderid)
+		Ck(err)
+	}
+	tx := transaction.Start(gf)
+	defer tx.Close()
+	items, err = backup.Restore(tx, src, dryRun)
+	Ck(err)
+	return
+}
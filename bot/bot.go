@@ -1,13 +1,15 @@
 package bot
 
 import (
-	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"regexp"
+	"sync"
 
 	"github.com/stevegt/docbot/google"
 	"github.com/stevegt/docbot/transaction"
 	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/option"
 )
 
 type Doc interface {
@@ -19,58 +21,184 @@ type Doc interface {
 	URL() string
 }
 
-type Conf struct {
-	Folderid        string
-	Docprefix       string
-	Template        string
-	SessionTemplate string `json:"session_template"`
-	CSWGTemplate    string `json:"cswg_template"`
-	Url             string
-	Listen          string
-	MinNextNum      int
-}
-
 type Bot struct {
-	Ls         bool
-	Serve      bool
-	Confpath   string
-	Credpath   string
-	Conf       *Conf
+	Ls          bool
+	Serve       bool
+	Config      bool
+	Check       bool
+	Templates   bool
+	Show        bool
+	Validate    bool
+	Name        string
+	Rename      bool
+	Newname     string
+	Dedupe      bool
+	Apply       bool
+	Alias       bool
+	Add         bool
+	Rm          bool
+	AliasName   string `docopt:"<alias>"`
+	Import      bool
+	DryRun      bool
+	Move        bool
+	Id          string
+	Backup      bool
+	Incremental bool
+	Dest        string
+	Restore     bool
+	Src         string
+	Folderid    string
+	Trash       bool
+	Purge       bool
+	All         bool
+	Refs        bool
+	Update      bool
+	Backlinks   bool
+	Dangling    bool
+	Graph       bool
+	Json        bool
+	Set         bool
+	Assignments []string `docopt:"<field>"`
+	Drift       bool
+	BulkCreate  bool `docopt:"bulk-create"`
+	Sessions    bool
+	Type        string
+	Schedule    string
+	Export      bool
+	Format      string
+	Output      string
+	Title       string
+	Doctype     string
+	From        string
+	To          string
+	Tag         string
+	Confpath    string
+	Credpath    string
+	Conf        *Conf
+	// Sandbox, if not nil, restricts the changes the bot may make;
+	// see google.Sandbox.
+	Sandbox *google.Sandbox
+	// ClientOptions, if not nil, are used to reach Drive instead of
+	// the credentials at Credpath, e.g. to use a fake server in tests.
+	ClientOptions []option.ClientOption
+
 	repo       *google.Folder
 	docpattern *regexp.Regexp
+	aliases    *transaction.Aliases
+	audit      *transaction.Audit
+	refindex   *transaction.Refs
+	mu         sync.RWMutex
 }
 
 func (b *Bot) Init() (err error) {
+	return b.Reload(nil)
+}
+
+// Reload reads and validates the config file, builds a new folder
+// from it, and then swaps both into place.  If check is not nil it is
+// called with the new config before the swap; if it or anything else
+// fails, the bot keeps its previous state.
+func (b *Bot) Reload(check func(conf *Conf) error) (err error) {
+	defer Return(&err)
+
+	conf, err := ReadConf(b.Confpath)
+	Ck(err)
+	err = conf.Validate()
+	Ck(err, b.Confpath)
+	if b.Sandbox != nil && conf.Production {
+		return fmt.Errorf("%w: %s is a production config", google.ErrSandbox, b.Confpath)
+	}
 
-	err = b.LoadConf(b.Confpath)
+	cbuf, err := b.readCreds()
 	Ck(err)
 
-	cbuf, err := ioutil.ReadFile(b.Credpath)
+	pat := Spf("^%s-(\\d+)-", conf.Docprefix)
+	docpattern, err := regexp.Compile(pat)
 	Ck(err)
 
-	pat := Spf("^%s-(\\d+)-", b.Conf.Docprefix)
-	b.docpattern, err = regexp.Compile(pat)
+	repo, err := b.newFolder(conf, cbuf, conf.Folderid)
 	Ck(err)
 
-	b.repo, err = google.NewFolder(cbuf, b.Conf.Folderid, regexp.MustCompile(Spf("^%s-"+`(\d+)`, b.Conf.Docprefix)), b.Conf.MinNextNum)
+	aliases, err := transaction.LoadAliases(conf.DataPath("aliases.json"))
 	Ck(err)
+	audit := transaction.OpenAudit(conf.DataPath("audit.jsonl"))
+	refindex := transaction.OpenRefs(conf.DataPath("refs.json"))
+
+	if check != nil {
+		err = check(conf)
+		Ck(err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Conf = conf
+	b.docpattern = docpattern
+	b.repo = repo
+	b.aliases = aliases
+	b.audit = audit
+	b.refindex = refindex
+	return
+}
 
+func (b *Bot) newFolder(conf *Conf, cbuf []byte, folderid string) (gf *google.Folder, err error) {
+	defer Return(&err)
+	pat := regexp.MustCompile(Spf("^%s-"+`(\d+)`, conf.Docprefix))
+	if b.ClientOptions != nil {
+		gf, err = google.NewFolderWith(folderid, pat, conf.MinNextNum, b.ClientOptions...)
+	} else {
+		gf, err = google.NewFolder(cbuf, folderid, pat, conf.MinNextNum)
+	}
+	Ck(err)
+	gf.SetSandbox(b.Sandbox)
+	gf.SetProduction(conf.Production)
 	return
 }
 
-func (b *Bot) LoadConf(fn string) (err error) {
+// OpenFolder returns the Drive folder folderid, using the current
+// credentials and document naming.
+func (b *Bot) OpenFolder(folderid string) (gf *google.Folder, err error) {
 	defer Return(&err)
-	buf, err := ioutil.ReadFile(fn)
+	cbuf, err := b.readCreds()
 	Ck(err)
-	conf := &Conf{}
-	err = json.Unmarshal(buf, conf)
+	gf, err = b.newFolder(b.CurrentConf(), cbuf, folderid)
 	Ck(err)
-	b.Conf = conf
 	return
 }
 
+// readCreds returns the service account credentials, or nil if
+// ClientOptions are set.
+func (b *Bot) readCreds() (cbuf []byte, err error) {
+	if b.ClientOptions != nil {
+		return
+	}
+	return ioutil.ReadFile(b.Credpath)
+}
+
+// CurrentConf returns the current config.  Callers that may run
+// concurrently with Reload should use this rather than b.Conf.
+func (b *Bot) CurrentConf() *Conf {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.Conf
+}
+
 func (b *Bot) StartTransaction() (tx *transaction.Transaction) {
-	tx = transaction.Start(b.repo)
+	b.mu.RLock()
+	repo := b.repo
+	aliases := b.aliases
+	audit := b.audit
+	refindex := b.refindex
+	archive := b.Conf.ArchiveFolder
+	images := transaction.OpenImages(b.Conf.DataPath("images"), b.Conf.Url+"/images")
+	unlockPrefix := Spf("%s/unlock/%s", b.Conf.Url, b.Conf.Docprefix)
+	b.mu.RUnlock()
+	tx = transaction.Start(repo)
+	tx.Aliases = aliases
+	tx.Audit = audit
+	tx.Archive = archive
+	tx.Refs = refindex
+	tx.Images = images
+	tx.UnlockPrefix = unlockPrefix
 	return
 }
 
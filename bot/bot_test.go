@@ -1,11 +1,15 @@
 package bot
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 
 	// "github.com/sergi/go-diff/diffmatchpatch"
 
+	"github.com/stevegt/docbot/google/fakedrive"
+	"github.com/stevegt/docbot/transaction"
 	"github.com/stevegt/docbot/util"
 	. "github.com/stevegt/goadapt"
 )
@@ -31,6 +35,7 @@ func setup(t *testing.T) (b *Bot) {
 	b = &Bot{
 		Confpath: confpath,
 		Credpath: credpath,
+		Sandbox:  transaction.TestSandbox(),
 	}
 	err := b.Init()
 	Tassert(t, err == nil, err)
@@ -38,6 +43,35 @@ func setup(t *testing.T) (b *Bot) {
 	return
 }
 
+// fakeFolder is the folder ID fakeBot's config names.
+const fakeFolder = "folder"
+
+// fakeBot returns a bot whose folder is on a fake Drive server, with
+// conf overriding keys of the default config.
+func fakeBot(t *testing.T, conf string) (b *Bot, fd *fakedrive.Server) {
+	fd = fakedrive.New()
+	t.Cleanup(fd.Close)
+	fd.AddFolder(fakeFolder, "docs")
+	dir := t.TempDir()
+	confpath := filepath.Join(dir, "docbot.conf")
+	buf := Spf(`{
+	"folderid": %q,
+	"docprefix": "mcp",
+	"template": "mcp-template",
+	"session_template": "session-template",
+	"minnextnum": 100,
+	"url": "http://localhost:8080",
+	"listen": ":8080",
+	"datadir": %q%s
+}`, fakeFolder, dir, conf)
+	err := ioutil.WriteFile(confpath, []byte(buf), 0644)
+	Tassert(t, err == nil, err)
+	b = &Bot{Confpath: confpath, ClientOptions: fd.Options()}
+	err = b.Init()
+	Tassert(t, err == nil, err)
+	return
+}
+
 // clean up from previous test
 func cleanup(t *testing.T, b *Bot) {
 	for i := 0; i < 5; i++ {
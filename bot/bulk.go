@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// BulkItem is one document made by CreateBulk.
+type BulkItem struct {
+	Num   int
+	Name  string
+	Title string
+	Opts  *transaction.DocOpts
+	// Node is the created document, or nil in a dry run.
+	Node *google.Node
+}
+
+// DocTemplate returns the configured template for a doctype.
+func (c *Conf) DocTemplate(doctype string) string {
+	switch doctype {
+	case "misc":
+		return c.Template
+	case "nomcon":
+		return c.SessionTemplate
+	case "cswg":
+		return c.CSWGTemplate
+	}
+	return ""
+}
+
+// DocName returns the filename the index page's create forms would
+// give a document of doctype, e.g. mcp-17-nomcon-2026-tools.  year is
+// only used for nomcon.
+func (c *Conf) DocName(doctype string, num, year int, title string) string {
+	return c.clipName(doctype, num, docSlug(doctype, year, title))
+}
+
+// sessionYear returns the year of a session: SESSION_YEAR if given,
+// else the year of SESSION_DATE, else the current year.
+func sessionYear(row map[string]string, now time.Time) int {
+	if y, err := strconv.Atoi(row["SESSION_YEAR"]); err == nil {
+		return y
+	}
+	if t, err := transaction.ParseDate(row["SESSION_DATE"]); err == nil {
+		return t.Year()
+	}
+	return now.Year()
+}
+
+// CreateBulk makes a document of doctype for each row of placeholder
+// values, as read by ReadSchedule, numbered consecutively from the
+// next free number.  Every row is checked before anything is created,
+// and each number again just before its document is made.  If a
+// creation fails, or a number has been taken meanwhile, the documents
+// already made are deleted again.  If dryRun is true, nothing is changed and the returned
+// items show what would be done.
+func (b *Bot) CreateBulk(tx *transaction.Transaction, doctype string, rows []map[string]string, creator string, dryRun bool) (items []*BulkItem, err error) {
+	conf := b.CurrentConf()
+	started := false
+	defer func() {
+		if err != nil && started {
+			err = fmt.Errorf("%w; rolled back %d documents", err, rollback(tx, items))
+		}
+	}()
+	defer Return(&err)
+
+	tmpl := conf.DocTemplate(doctype)
+	Assert(tmpl != "", "no template configured for doctype %q", doctype)
+	Assert(len(rows) > 0, "no sessions in schedule")
+	next, err := tx.NextNum()
+	Ck(err)
+	now := time.Now()
+	for i, row := range rows {
+		title := row["SESSION_TITLE"]
+		for _, k := range []string{"CSWG_TITLE", "TITLE"} {
+			if title == "" {
+				title = row[k]
+			}
+		}
+		Assert(title != "", "session %d: no title", i+1)
+		num := next + i
+		vars := make(map[string]string)
+		for k, v := range row {
+			vars[k] = v
+		}
+		year := sessionYear(row, now)
+		if doctype == "nomcon" && vars["SESSION_YEAR"] == "" {
+			vars["SESSION_YEAR"] = strconv.Itoa(year)
+		}
+		item := &BulkItem{
+			Num:   num,
+			Name:  conf.DocName(doctype, num, year, title),
+			Title: title,
+			Opts: &transaction.DocOpts{
+				Template:     tmpl,
+				Title:        title,
+				UnlockPrefix: Spf("%s/unlock/%s", conf.Url, conf.Docprefix),
+				DocPrefix:    Spf("%s/doc/%s", conf.Url, conf.Docprefix),
+				Creator:      creator,
+				Vars:         vars,
+			},
+		}
+		item.Opts.Filename = item.Name
+		existing, err := tx.GetByName(item.Name)
+		Ck(err)
+		Assert(existing == nil, "already exists: %s", item.Name)
+		err = tx.Check(item.Opts)
+		Ck(err, "session %d: %s", i+1, title)
+		items = append(items, item)
+	}
+	if dryRun {
+		return
+	}
+
+	started = true
+	for _, item := range items {
+		// the transaction lock only holds within this process, so
+		// check that nobody else has taken the number meanwhile
+		tx.Refresh()
+		held, err := tx.GetByNum(item.Num)
+		Ck(err)
+		if held != nil {
+			return items, fmt.Errorf("number %d was taken by %s during the run", item.Num, held.Name())
+		}
+		item.Node, err = tx.OpenCreateOpts(item.Opts)
+		Ck(err, item.Name)
+		err = tx.Unlock(item.Node)
+		Ck(err, item.Name)
+		log.Printf("created %s", item.Name)
+	}
+	return
+}
+
+// rollback deletes the documents made for items, including any
+// half-made one, and returns how many it deleted.
+func rollback(tx *transaction.Transaction, items []*BulkItem) (n int) {
+	for _, item := range items {
+		node := item.Node
+		if node == nil {
+			// the copy may have been made before the failure
+			var err error
+			node, err = tx.GetByName(item.Name)
+			if err != nil || node == nil {
+				continue
+			}
+		}
+		err := tx.Purge(node)
+		if err != nil {
+			log.Printf("rollback: %s: %v", item.Name, err)
+			continue
+		}
+		item.Node = nil
+		n++
+	}
+	return
+}
+
+// WriteBulkCSV writes the numbers, names and links of items, e.g. for
+// a conference program.  The URL columns are empty in a dry run.
+func (b *Bot) WriteBulkCSV(w io.Writer, items []*BulkItem) (err error) {
+	defer Return(&err)
+	conf := b.CurrentConf()
+	cw := csv.NewWriter(w)
+	err = cw.Write([]string{"num", "name", "title", "date", "url", "doc_url"})
+	Ck(err)
+	for _, item := range items {
+		url, docURL := "", ""
+		if item.Node != nil {
+			url = Spf("%s/doc/%s-%d", conf.Url, conf.Docprefix, item.Num)
+			docURL = item.Node.URL()
+		}
+		err = cw.Write([]string{
+			strconv.Itoa(item.Num), item.Name, item.Title,
+			item.Opts.Vars["SESSION_DATE"], url, docURL,
+		})
+		Ck(err)
+	}
+	cw.Flush()
+	return cw.Error()
+}
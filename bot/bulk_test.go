@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/google/fakedrive"
+	. "github.com/stevegt/goadapt"
+)
+
+// bulkBot returns a fake-backed bot with a misc template and an
+// unrelated document numbered 99.
+func bulkBot(t *testing.T) (b *Bot, fd *fakedrive.Server) {
+	b, fd = fakeBot(t, "")
+	fd.AddDoc(fakeFolder, "mcp-template", fakedrive.Doc("Name: {{NAME}}", "{{TITLE}}", "{{UNLOCK_URL}}"))
+	fd.AddDoc(fakeFolder, "mcp-99-old", nil)
+	return
+}
+
+var bulkRows = []map[string]string{
+	{"SESSION_TITLE": "Tools"},
+	{"SESSION_TITLE": "Safety"},
+	{"SESSION_TITLE": "Funding"},
+}
+
+func bulkCreate(b *Bot, dryRun bool) (items []*BulkItem, err error) {
+	tx := b.StartTransaction()
+	defer tx.Close()
+	return b.CreateBulk(tx, "misc", bulkRows, "tester", dryRun)
+}
+
+func TestCreateBulk(t *testing.T) {
+	b, fd := bulkBot(t)
+	before := fd.Titles(fakeFolder)
+
+	items, err := bulkCreate(b, true)
+	Tassert(t, err == nil, err)
+	Tassert(t, len(items) == 3, items)
+	for i, item := range items {
+		Tassert(t, item.Num == 100+i, item.Num)
+		Tassert(t, item.Node == nil, item.Name)
+	}
+	Tassert(t, items[0].Name == "mcp-100-tools", items[0].Name)
+	Tassert(t, strings.Join(fd.Titles(fakeFolder), " ") == strings.Join(before, " "), fd.Titles(fakeFolder))
+
+	items, err = bulkCreate(b, false)
+	Tassert(t, err == nil, err)
+	want := append(before, "mcp-100-tools", "mcp-101-safety", "mcp-102-funding")
+	Tassert(t, strings.Join(fd.Titles(fakeFolder), " ") == strings.Join(want, " "), fd.Titles(fakeFolder))
+	for _, item := range items {
+		Tassert(t, item.Node != nil && item.Node.Name() == item.Name, item.Name)
+		Tassert(t, len(fd.Updates(item.Node.Id())) > 0, item.Name)
+	}
+
+	// the next run continues the numbering
+	items, err = bulkCreate(b, true)
+	Tassert(t, err == nil, err)
+	Tassert(t, items[0].Num == 103, items[0].Num)
+}
+
+func TestCreateBulkRollback(t *testing.T) {
+	copies := func(r *http.Request) bool {
+		return r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/copy")
+	}
+	cases := []struct {
+		name string
+		// fail is the fake's Fail hook, given the fake and the number
+		// of copies made so far
+		fail func(fd *fakedrive.Server, n int, r *http.Request) bool
+		// extra is what the failure leaves in the folder
+		extra []string
+		err   string
+	}{
+		{
+			name: "copy fails",
+			fail: func(fd *fakedrive.Server, n int, r *http.Request) bool {
+				return copies(r) && n == 2
+			},
+			err: "injected failure",
+		},
+		{
+			name: "fill fails after the copy",
+			fail: func(fd *fakedrive.Server, n int, r *http.Request) bool {
+				return strings.HasSuffix(r.URL.Path, ":batchUpdate") && n == 2
+			},
+			err: "injected failure",
+		},
+		{
+			name: "unlock fails",
+			fail: func(fd *fakedrive.Server, n int, r *http.Request) bool {
+				return strings.HasSuffix(r.URL.Path, "/permissions") && n == 3
+			},
+			err: "injected failure",
+		},
+		{
+			name: "number taken by another process",
+			fail: func(fd *fakedrive.Server, n int, r *http.Request) bool {
+				if copies(r) && n == 1 {
+					fd.AddDoc(fakeFolder, "mcp-101-other", nil)
+				}
+				return false
+			},
+			extra: []string{"mcp-101-other"},
+			err:   "number 101 was taken by mcp-101-other",
+		},
+	}
+	for _, c := range cases {
+		b, fd := bulkBot(t)
+		before := fd.Titles(fakeFolder)
+		n := 0
+		fd.Fail = func(r *http.Request) bool {
+			if copies(r) {
+				n++
+			}
+			return c.fail(fd, n, r)
+		}
+		items, err := bulkCreate(b, false)
+		Tassert(t, err != nil, c.name)
+		Tassert(t, strings.Contains(err.Error(), c.err), c.name, err)
+		Tassert(t, strings.Contains(err.Error(), "rolled back"), c.name, err)
+		for _, item := range items {
+			Tassert(t, item.Node == nil, c.name, item.Name)
+		}
+		fd.Fail = nil
+		want := append(before, c.extra...)
+		Tassert(t, strings.Join(fd.Titles(fakeFolder), " ") == strings.Join(want, " "), c.name, fd.Titles(fakeFolder))
+	}
+}
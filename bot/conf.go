@@ -0,0 +1,359 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	. "github.com/stevegt/goadapt"
+	"gopkg.in/yaml.v3"
+)
+
+// Conf is the docbot configuration.  It can be written as JSON, YAML
+// or TOML; the format is chosen by the file extension.  Every field
+// can be overridden by an environment variable named DOCBOT_ followed
+// by the upper-cased key, e.g. DOCBOT_FOLDERID or
+// DOCBOT_SESSION_TEMPLATE.
+type Conf struct {
+	Folderid        string `json:"folderid" yaml:"folderid" toml:"folderid"`
+	Docprefix       string `json:"docprefix" yaml:"docprefix" toml:"docprefix"`
+	Template        string `json:"template" yaml:"template" toml:"template"`
+	SessionTemplate string `json:"session_template" yaml:"session_template" toml:"session_template"`
+	CSWGTemplate    string `json:"cswg_template" yaml:"cswg_template" toml:"cswg_template"`
+	Url             string `json:"url" yaml:"url" toml:"url"`
+	Listen          string `json:"listen" yaml:"listen" toml:"listen"`
+	MinNextNum      int    `json:"minnextnum" yaml:"minnextnum" toml:"minnextnum"`
+	// TemplateDir optionally holds *.html files that override the
+	// built-in web templates of the same name.
+	TemplateDir string `json:"template_dir" yaml:"template_dir" toml:"template_dir"`
+	// Datadir holds docbot's local state, such as the alias table.
+	// Defaults to the current directory.
+	Datadir string `json:"datadir" yaml:"datadir" toml:"datadir"`
+	// ArchiveFolder optionally names a Drive folder that deleted
+	// documents are moved to instead of the Drive trash.
+	ArchiveFolder string `json:"archive_folder" yaml:"archive_folder" toml:"archive_folder"`
+	// TrashRetention is the number of days a deleted document is kept
+	// before "docbot trash purge" removes it for good.  Defaults to 30.
+	TrashRetention int `json:"trash_retention" yaml:"trash_retention" toml:"trash_retention"`
+	// DocPage makes /doc/<key> show docbot's page about the document
+	// instead of redirecting straight to Google Docs.
+	DocPage bool `json:"doc_page" yaml:"doc_page" toml:"doc_page"`
+	// Production marks a live deployment.  A bot with a Sandbox, as
+	// used by tests, refuses to load a production config.
+	Production bool `json:"production" yaml:"production" toml:"production"`
+	// MaxNameLen is the longest filename the create forms may make.
+	// Defaults to 100; longer titles lose words from the end.
+	MaxNameLen int `json:"max_name_len" yaml:"max_name_len" toml:"max_name_len"`
+	// ForbiddenChars lists characters that are rejected in requested
+	// filenames and titles instead of being slugified away.
+	ForbiddenChars string `json:"forbidden_chars" yaml:"forbidden_chars" toml:"forbidden_chars"`
+	// FixedNumbers stops the create forms from taking any number but
+	// the next one.
+	FixedNumbers bool `json:"fixed_numbers" yaml:"fixed_numbers" toml:"fixed_numbers"`
+}
+
+// Retention returns how long deleted documents are kept.
+func (c *Conf) Retention() time.Duration {
+	days := c.TrashRetention
+	if days == 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DataPath returns the path of fn within the data directory.
+func (c *Conf) DataPath(fn string) string {
+	return filepath.Join(c.Datadir, fn)
+}
+
+// ConfCheck is the result of a single configuration check.
+type ConfCheck struct {
+	Item string
+	Ok   bool
+	Msg  string
+}
+
+// ConfReport collects the results of all configuration checks.
+type ConfReport struct {
+	Path   string
+	Checks []ConfCheck
+}
+
+func (r *ConfReport) add(item string, ok bool, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, ConfCheck{Item: item, Ok: ok, Msg: Spf(format, args...)})
+}
+
+// Ok returns true if every check passed.
+func (r *ConfReport) Ok() bool {
+	for _, c := range r.Checks {
+		if !c.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+var prefixre = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// confFormat returns "json", "yaml" or "toml" depending on the
+// filename extension.  Anything unrecognized, including the default
+// ".docbot.conf", is treated as JSON.
+func confFormat(fn string) string {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// ReadConf strictly decodes the config file at fn and applies
+// environment overrides.  Unknown keys are an error.  ReadConf does
+// not validate the result; see Conf.Validate.
+func ReadConf(fn string) (conf *Conf, err error) {
+	defer Return(&err)
+	buf, err := ioutil.ReadFile(fn)
+	Ck(err)
+	conf = &Conf{}
+	switch confFormat(fn) {
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(buf))
+		dec.KnownFields(true)
+		err = dec.Decode(conf)
+		if err == io.EOF {
+			err = nil
+		}
+		Ck(err, fn)
+	case "toml":
+		md, err := toml.Decode(string(buf), conf)
+		Ck(err, fn)
+		undecoded := md.Undecoded()
+		Assert(len(undecoded) == 0, "%s: unknown field(s): %v", fn, undecoded)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(conf)
+		Ck(err, fn)
+		Assert(!dec.More(), "%s: trailing data after config object", fn)
+	}
+	err = conf.applyEnv()
+	Ck(err)
+	return
+}
+
+// applyEnv overrides fields from DOCBOT_* environment variables.
+func (c *Conf) applyEnv() (err error) {
+	defer Return(&err)
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		name := "DOCBOT_" + strings.ToUpper(key)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(s)
+		case reflect.Int:
+			n, err := strconv.Atoi(s)
+			Ck(err, name)
+			f.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			Ck(err, name)
+			f.SetBool(b)
+		default:
+			Assert(false, "unhandled kind for %s: %v", name, f.Kind())
+		}
+	}
+	return
+}
+
+// check runs the static (offline) checks and adds them to the report.
+func (c *Conf) check(r *ConfReport) {
+	r.add("folderid", c.Folderid != "", "%q", c.Folderid)
+	r.add("docprefix", prefixre.MatchString(c.Docprefix), "%q", c.Docprefix)
+	r.add("template", c.Template != "", "%q", c.Template)
+
+	u, err := url.Parse(c.Url)
+	switch {
+	case err != nil:
+		r.add("url", false, "%v", err)
+	case u.Scheme != "http" && u.Scheme != "https":
+		r.add("url", false, "%q: scheme must be http or https", c.Url)
+	case u.Host == "":
+		r.add("url", false, "%q: missing host", c.Url)
+	case strings.HasSuffix(c.Url, "/"):
+		r.add("url", false, "%q: must not end with a slash", c.Url)
+	default:
+		r.add("url", true, "%q", c.Url)
+	}
+
+	if c.Listen == "" {
+		r.add("listen", true, "unset, defaulting to :8888")
+	} else {
+		_, port, err := net.SplitHostPort(c.Listen)
+		if err == nil {
+			var n int
+			n, err = strconv.Atoi(port)
+			if err == nil && (n < 0 || n > 65535) {
+				err = fmt.Errorf("port out of range")
+			}
+		}
+		if err != nil {
+			r.add("listen", false, "%q: %v", c.Listen, err)
+		} else {
+			r.add("listen", true, "%q", c.Listen)
+		}
+	}
+
+	r.add("minnextnum", c.MinNextNum >= 0, "%d", c.MinNextNum)
+	if c.MaxNameLen != 0 && c.MaxNameLen < c.minNameLen() {
+		r.add("max_name_len", false, "%d: must be at least %d to fit the prefix, number and doctype segments", c.MaxNameLen, c.minNameLen())
+	} else {
+		r.add("max_name_len", true, "%d", c.MaxNameLength())
+	}
+	r.add("trash_retention", c.TrashRetention >= 0, "%d days", c.Retention()/(24*time.Hour))
+	switch {
+	case c.ArchiveFolder == "":
+	case c.ArchiveFolder == c.Folderid:
+		// Rm would move documents within the folder
+		r.add("archive_folder", false, "%q: must not be the document folder", c.ArchiveFolder)
+	default:
+		r.add("archive_folder", true, "%q", c.ArchiveFolder)
+	}
+
+	if c.Datadir != "" {
+		fi, err := os.Stat(c.Datadir)
+		switch {
+		case err != nil:
+			r.add("datadir", false, "%v", err)
+		case !fi.IsDir():
+			r.add("datadir", false, "%q: not a directory", c.Datadir)
+		default:
+			r.add("datadir", true, "%q", c.Datadir)
+		}
+	}
+
+	if c.TemplateDir != "" {
+		fi, err := os.Stat(c.TemplateDir)
+		switch {
+		case err != nil:
+			r.add("template_dir", false, "%v", err)
+		case !fi.IsDir():
+			r.add("template_dir", false, "%q: not a directory", c.TemplateDir)
+		default:
+			r.add("template_dir", true, "%q", c.TemplateDir)
+		}
+	}
+}
+
+// Validate runs the static checks and returns an error describing
+// every failure.
+func (c *Conf) Validate() (err error) {
+	r := &ConfReport{}
+	c.check(r)
+	var msgs []string
+	for _, chk := range r.Checks {
+		if !chk.Ok {
+			msgs = append(msgs, Spf("%s: %s", chk.Item, chk.Msg))
+		}
+	}
+	if len(msgs) > 0 {
+		err = fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+	}
+	return
+}
+
+// LoadConf reads and validates the config file at fn.
+func (b *Bot) LoadConf(fn string) (err error) {
+	defer Return(&err)
+	conf, err := ReadConf(fn)
+	Ck(err)
+	err = conf.Validate()
+	Ck(err, fn)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Conf = conf
+	return
+}
+
+// CheckConf checks the config file at b.Confpath, including whether
+// the folder is reachable and every configured template exists in it
+// exactly once.  Problems are recorded in the report rather than
+// returned as errors.
+func (b *Bot) CheckConf() (r *ConfReport) {
+	r = &ConfReport{Path: b.Confpath}
+	conf, err := ReadConf(b.Confpath)
+	if err != nil {
+		r.add("parse", false, "%v", err)
+		return
+	}
+	r.add("parse", true, "%s", confFormat(b.Confpath))
+	conf.check(r)
+	if !r.Ok() {
+		return
+	}
+
+	err = b.Init()
+	if err != nil {
+		r.add("init", false, "%v", err)
+		return
+	}
+	title, err := b.repo.Title()
+	if err != nil {
+		r.add("folder", false, "%s: %v", conf.Folderid, err)
+		return
+	}
+	r.add("folder", true, "%s: %q", conf.Folderid, title)
+
+	tx := b.StartTransaction()
+	defer tx.Close()
+	nodes, err := tx.AllNodes()
+	if err != nil {
+		r.add("folder", false, "listing %s: %v", conf.Folderid, err)
+		return
+	}
+	tmpls := map[string]string{
+		"template":         conf.Template,
+		"session_template": conf.SessionTemplate,
+		"cswg_template":    conf.CSWGTemplate,
+	}
+	for _, item := range []string{"template", "session_template", "cswg_template"} {
+		name := tmpls[item]
+		if name == "" {
+			continue
+		}
+		var count int
+		for _, n := range nodes {
+			if n.Name() == name {
+				count++
+			}
+		}
+		switch count {
+		case 0:
+			r.add(item, false, "%q: not found in folder", name)
+		case 1:
+			r.add(item, true, "%q: found", name)
+		default:
+			r.add(item, false, "%q: %d documents with this name", name, count)
+		}
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestReadConf(t *testing.T) {
+	for _, fn := range []string{
+		"testdata/docbot.conf",
+		"testdata/conf/docbot.yaml",
+		"testdata/conf/docbot.toml",
+	} {
+		conf, err := ReadConf(fn)
+		Tassert(t, err == nil, fn, err)
+		Tassert(t, conf.Folderid == "1HcCIw7ppJZPD9GEHccnkgNYUwhAGCif6", fn, conf.Folderid)
+		Tassert(t, conf.Docprefix == "mcp", fn, conf.Docprefix)
+		Tassert(t, conf.SessionTemplate == "session-template", fn, conf.SessionTemplate)
+		Tassert(t, conf.MinNextNum == 99900, fn, conf.MinNextNum)
+		err = conf.Validate()
+		Tassert(t, err == nil, fn, err)
+	}
+}
+
+func TestReadConfUnknown(t *testing.T) {
+	for _, fn := range []string{
+		"testdata/conf/unknown.conf",
+		"testdata/conf/unknown.yaml",
+		"testdata/conf/unknown.toml",
+	} {
+		_, err := ReadConf(fn)
+		Tassert(t, err != nil, fn)
+	}
+}
+
+func TestConfEnv(t *testing.T) {
+	os.Setenv("DOCBOT_DOCPREFIX", "xyz")
+	os.Setenv("DOCBOT_MINNEXTNUM", "42")
+	defer os.Unsetenv("DOCBOT_DOCPREFIX")
+	defer os.Unsetenv("DOCBOT_MINNEXTNUM")
+	conf, err := ReadConf("testdata/docbot.conf")
+	Tassert(t, err == nil, err)
+	Tassert(t, conf.Docprefix == "xyz", conf.Docprefix)
+	Tassert(t, conf.MinNextNum == 42, conf.MinNextNum)
+
+	os.Setenv("DOCBOT_MINNEXTNUM", "many")
+	_, err = ReadConf("testdata/docbot.conf")
+	Tassert(t, err != nil)
+}
+
+func TestConfValidate(t *testing.T) {
+	conf, err := ReadConf("testdata/conf/invalid.conf")
+	Tassert(t, err == nil, err)
+	err = conf.Validate()
+	Tassert(t, err != nil)
+	for _, item := range []string{"folderid", "docprefix", "url", "listen", "minnextnum", "trash_retention"} {
+		Tassert(t, strings.Contains(err.Error(), item+":"), Spf("%s missing from %v", item, err))
+	}
+	Tassert(t, !strings.Contains(err.Error(), "template:"), err)
+
+	conf, err = ReadConf("testdata/docbot.conf")
+	Tassert(t, err == nil, err)
+	conf.ArchiveFolder = "archive"
+	Tassert(t, conf.Validate() == nil)
+	conf.ArchiveFolder = conf.Folderid
+	err = conf.Validate()
+	Tassert(t, err != nil && strings.Contains(err.Error(), "archive_folder:"), err)
+}
+
+func TestCheckConfParseError(t *testing.T) {
+	b := &Bot{Confpath: "testdata/conf/unknown.conf"}
+	r := b.CheckConf()
+	Tassert(t, !r.Ok())
+	Tassert(t, len(r.Checks) == 1 && r.Checks[0].Item == "parse", r.Checks)
+}
+
+func TestSandboxProduction(t *testing.T) {
+	b := &Bot{
+		Confpath: "testdata/conf/production.conf",
+		Credpath: credpath,
+		Sandbox:  transaction.TestSandbox(),
+	}
+	err := b.Init()
+	Tassert(t, errors.Is(err, google.ErrSandbox), err)
+}
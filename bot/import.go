@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+// ImportItem maps one source document to its place in the series.
+type ImportItem struct {
+	Source  *google.Node
+	Title   string
+	Num     int
+	NewName string
+	// Node is the imported document, or nil in a dry run.
+	Node *google.Node
+}
+
+// importTitle returns the title of a document named name: the name
+// less any <prefix>-<num> it already carries, so that imported
+// documents don't get a second prefix.
+func (c *Conf) importTitle(name string) string {
+	m := c.namere().FindStringSubmatch(name)
+	// the rest must start a new word, not extend the number
+	if m == nil || (m[2] != "" && util.Slug(m[2][:1]) != "") {
+		return name
+	}
+	return strings.Trim(m[2], "-_ ")
+}
+
+// ImportPlan numbers srcs consecutively from next, oldest first, with
+// names breaking ties, and names each <prefix>-<num>-<slug> after its
+// title.  A source already named with the prefix and a number is
+// renumbered like any other.
+func (c *Conf) ImportPlan(srcs []*google.Node, next int) (items []*ImportItem) {
+	srcs = append([]*google.Node{}, srcs...)
+	sort.SliceStable(srcs, func(i, j int) bool {
+		if srcs[i].Created() != srcs[j].Created() {
+			return srcs[i].Created() < srcs[j].Created()
+		}
+		if srcs[i].Name() != srcs[j].Name() {
+			return srcs[i].Name() < srcs[j].Name()
+		}
+		return srcs[i].Id() < srcs[j].Id()
+	})
+	for i, src := range srcs {
+		num := next + i
+		title := c.importTitle(src.Name())
+		item := &ImportItem{
+			Source:  src,
+			Title:   title,
+			Num:     num,
+			NewName: c.DocName("misc", num, 0, title),
+		}
+		if title == "" {
+			item.Title = src.Name()
+		}
+		items = append(items, item)
+	}
+	return
+}
+
+// ImportDocs numbers the Google Docs identified by id -- a single doc or
+// a folder of them -- as ImportPlan does, and copies or moves them
+// into the folder.  If
+// dryRun is true, nothing is changed and the returned items show what
+// would be done.
+func (b *Bot) ImportDocs(tx *transaction.Transaction, id string, move, dryRun bool) (items []*ImportItem, err error) {
+	defer Return(&err)
+	conf := b.CurrentConf()
+	Assert(id != conf.Folderid, "cannot import the docbot folder into itself")
+
+	srcs, err := tx.Sources(id)
+	Ck(err)
+	next, err := tx.NextNum()
+	Ck(err)
+	items = conf.ImportPlan(srcs, next)
+	if dryRun {
+		return
+	}
+	for _, item := range items {
+		item.Node, err = tx.Adopt(item.Source, item.NewName, item.Title, move)
+		Ck(err, item.Source.Id())
+	}
+	return
+}
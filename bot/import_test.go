@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/drive/v2"
+)
+
+func TestImportPlan(t *testing.T) {
+	gf, err := google.NewFolder(nil, "folder", regexp.MustCompile(`^mcp-(\d+)`), 1)
+	Tassert(t, err == nil, err)
+	src := func(id, title, created string) *google.Node {
+		return gf.NewNode(&drive.File{Id: id, Title: title, CreatedDate: created})
+	}
+	c := &Conf{Docprefix: "mcp"}
+	for _, tc := range []struct {
+		name   string
+		srcs   []*google.Node
+		expect [][3]string // source ID, title, new name
+	}{
+		{"empty", nil, nil},
+		{
+			"oldest first, then by name",
+			[]*google.Node{
+				src("c", "Zebra notes", "2022-03-01T00:00:00Z"),
+				src("b", "Beta", "2022-01-01T00:00:00Z"),
+				src("a", "Alpha", "2022-01-01T00:00:00Z"),
+			},
+			[][3]string{
+				{"a", "Alpha", "mcp-17-alpha"},
+				{"b", "Beta", "mcp-18-beta"},
+				{"c", "Zebra notes", "mcp-19-zebra-notes"},
+			},
+		},
+		{
+			"existing prefix is replaced, not doubled",
+			[]*google.Node{
+				src("a", "mcp-5-why-numbered-docs", "2022-01-01T00:00:00Z"),
+				src("b", "MCP-6 Tools", "2022-01-02T00:00:00Z"),
+				src("c", "mcp-7", "2022-01-03T00:00:00Z"),
+				src("d", "mcp-8x list", "2022-01-04T00:00:00Z"),
+			},
+			[][3]string{
+				{"a", "why-numbered-docs", "mcp-17-why-numbered-docs"},
+				{"b", "Tools", "mcp-18-tools"},
+				{"c", "mcp-7", "mcp-19"},
+				{"d", "mcp-8x list", "mcp-20-mcp-8x-list"},
+			},
+		},
+	} {
+		items := c.ImportPlan(tc.srcs, 17)
+		Tassert(t, len(items) == len(tc.expect), tc.name, items)
+		for i, e := range tc.expect {
+			got := [3]string{items[i].Source.Id(), items[i].Title, items[i].NewName}
+			Tassert(t, got == e, Spf("%s: %d: got %q want %q", tc.name, i, got, e))
+			Tassert(t, items[i].Num == 17+i, tc.name, items[i].Num)
+		}
+	}
+
+	// the plan doesn't depend on the order Drive lists the sources in
+	a := src("a", "A", "2022-01-01T00:00:00Z")
+	b := src("b", "B", "2022-01-01T00:00:00Z")
+	srcs := []*google.Node{b, a}
+	p1 := c.ImportPlan(srcs, 1)
+	p2 := c.ImportPlan([]*google.Node{a, b}, 1)
+	Tassert(t, p1[0].NewName == p2[0].NewName && p1[1].NewName == p2[1].NewName, p1, p2)
+	Tassert(t, srcs[0] == b, "ImportPlan must not reorder its argument")
+}
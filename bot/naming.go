@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+// ErrBadName is returned for a requested filename that breaks the
+// naming policy.
+var ErrBadName = errors.New("bad filename")
+
+// defaultMaxNameLen is the longest filename allowed if max_name_len
+// isn't set.
+const defaultMaxNameLen = 100
+
+// doctypeSegments matches the part of a filename after the number
+// that each doctype requires, e.g. mcp-17-nomcon-2026-tools.
+var doctypeSegments = map[string]*regexp.Regexp{
+	"nomcon": regexp.MustCompile(`^nomcon-(\d{4})-`),
+	"cswg":   regexp.MustCompile(`^cswg-workshop-`),
+}
+
+// MaxNameLength returns the longest filename allowed.
+func (c *Conf) MaxNameLength() int {
+	if c.MaxNameLen == 0 {
+		return defaultMaxNameLen
+	}
+	return c.MaxNameLen
+}
+
+// namere matches a filename with the configured prefix, ignoring case,
+// and captures its number and the rest of the name.
+func (c *Conf) namere() *regexp.Regexp {
+	return regexp.MustCompile(`^(?i)` + regexp.QuoteMeta(c.Docprefix) + `-(\d+)(.*)$`)
+}
+
+// docSlug returns the part of a doctype's filename after the number.
+func docSlug(doctype string, year int, title string) string {
+	switch doctype {
+	case "nomcon":
+		return util.Slug(Spf("nomcon %d %s", year, title))
+	case "cswg":
+		return util.Slug("cswg workshop " + title)
+	}
+	return util.Slug(title)
+}
+
+// maxNumDigits is the number of digits of document number that
+// max_name_len must leave room for.
+const maxNumDigits = 6
+
+// minNameLen returns the smallest max_name_len that leaves room for
+// the prefix, a number, and the longest required doctype segment
+// followed by one character of title.
+func (c *Conf) minNameLen() (n int) {
+	for doctype := range doctypeSegments {
+		if l := len(docSlug(doctype, 9999, "")) + 2; l > n {
+			n = l
+		}
+	}
+	return len(c.Docprefix) + 1 + maxNumDigits + 1 + n
+}
+
+// clipName joins prefix, num and slug, cutting words off the end of
+// slug to keep the name within the maximum length.  The segments
+// doctype requires, such as nomcon-2026, are never cut, nor is all of
+// the word after them; if need be that word is shortened instead.
+func (c *Conf) clipName(doctype string, num int, slug string) string {
+	name := Spf("%s-%d", c.Docprefix, num)
+	max := c.MaxNameLength()
+	keep := 0
+	if re := doctypeSegments[doctype]; re != nil {
+		if loc := re.FindStringIndex(slug); loc != nil {
+			keep = loc[1]
+		}
+	}
+	for slug != "" && len(name)+1+len(slug) > max {
+		i := strings.LastIndex(slug, "-")
+		if keep > 0 && i < keep {
+			n := max - len(name) - 1
+			if n < keep+1 {
+				n = keep + 1
+			}
+			slug = slug[:n]
+			break
+		}
+		if i < 0 {
+			slug = ""
+			break
+		}
+		slug = slug[:i]
+	}
+	if slug == "" {
+		return name
+	}
+	return name + "-" + slug
+}
+
+// NameRequest is a filename requested from a create form.
+type NameRequest struct {
+	// Doctype is misc, nomcon or cswg, or "" for a document made
+	// from some other template, which needs no particular segments.
+	Doctype string
+	// Filename is as submitted; if it has nothing after the number,
+	// the rest of the name is made from Title.
+	Filename string
+	Title    string
+	// Year is the nomcon year.
+	Year    int
+	NextNum int
+}
+
+// Filename applies the naming policy to a requested filename and
+// returns the name to create and its number.  The part after the number is
+// slugified, as util.Slug does, and cut to the maximum length.  The
+// request fails with ErrBadName if the filename or title contains a
+// forbidden character, if the filename doesn't start with the
+// document prefix and a number, if fixed_numbers is set and the
+// number isn't the next one, or if the name lacks the segments its
+// doctype requires, such as nomcon-<year>.
+func (c *Conf) Filename(req NameRequest) (name string, num int, err error) {
+	bad := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrBadName, Spf(format, args...))
+	}
+	if c.ForbiddenChars != "" {
+		for _, v := range []string{req.Filename, req.Title} {
+			if i := strings.IndexAny(v, c.ForbiddenChars); i >= 0 {
+				return "", 0, bad("%q: %q is not allowed", v, v[i:i+1])
+			}
+		}
+	}
+
+	num = req.NextNum
+	var slug string
+	if fn := strings.TrimSpace(req.Filename); fn != "" {
+		m := c.namere().FindStringSubmatch(fn)
+		if m == nil {
+			return "", 0, bad("%q: must start with %s-<number>", fn, c.Docprefix)
+		}
+		// the rest must start a new word, not extend the number
+		if m[2] != "" && util.Slug(m[2][:1]) != "" {
+			return "", 0, bad("%q: must start with %s-<number>", fn, c.Docprefix)
+		}
+		num, err = strconv.Atoi(m[1])
+		if err != nil || num < 1 {
+			return "", 0, bad("%q: bad number", fn)
+		}
+		slug = util.Slug(m[2])
+	}
+	if c.FixedNumbers && num != req.NextNum {
+		return "", 0, bad("the next document number is %d, not %d", req.NextNum, num)
+	}
+	if slug == "" {
+		slug = docSlug(req.Doctype, req.Year, req.Title)
+	}
+
+	name = c.clipName(req.Doctype, num, slug)
+	if len(name) > c.MaxNameLength() {
+		return "", 0, bad("%q is longer than %d bytes", name, c.MaxNameLength())
+	}
+	slug = strings.TrimPrefix(name, Spf("%s-%d-", c.Docprefix, num))
+	if re := doctypeSegments[req.Doctype]; re != nil {
+		m := re.FindStringSubmatch(slug)
+		if m == nil {
+			return "", 0, bad("%s filenames need \"%s-<title>\" after the number", req.Doctype, docSlug(req.Doctype, req.Year, ""))
+		}
+		if req.Doctype == "nomcon" && req.Year > 0 && m[1] != strconv.Itoa(req.Year) {
+			return "", 0, bad("filename year %s doesn't match session year %d", m[1], req.Year)
+		}
+	}
+	if req.Doctype != "" && util.Doctype(name) != req.Doctype {
+		return "", 0, bad("%q looks like a %s filename, not %s", name, util.Doctype(name), req.Doctype)
+	}
+	return
+}
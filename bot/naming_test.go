@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestFilename(t *testing.T) {
+	c := &Conf{Docprefix: "mcp", ForbiddenChars: "/"}
+	for _, tc := range []struct {
+		req  NameRequest
+		want string
+	}{
+		{NameRequest{Doctype: "misc", Filename: "mcp-17-Why Numbered Docs?", NextNum: 17}, "mcp-17-why-numbered-docs"},
+		{NameRequest{Doctype: "misc", Filename: "MCP-17", Title: "Tools", NextNum: 17}, "mcp-17-tools"},
+		{NameRequest{Doctype: "misc", Title: "Tools", NextNum: 17}, "mcp-17-tools"},
+		{NameRequest{Doctype: "misc", Filename: "mcp-5-old", NextNum: 17}, "mcp-5-old"},
+		{NameRequest{Doctype: "nomcon", Filename: "mcp-17", Title: "Keynote", Year: 2026, NextNum: 17}, "mcp-17-nomcon-2026-keynote"},
+		{NameRequest{Doctype: "nomcon", Filename: "mcp-17-nomcon-2026-Key note", Year: 2026, NextNum: 17}, "mcp-17-nomcon-2026-key-note"},
+		{NameRequest{Doctype: "cswg", Title: "Tools", NextNum: 17}, "mcp-17-cswg-workshop-tools"},
+		{NameRequest{Filename: "mcp-17-nomcon-2026-x", NextNum: 17}, "mcp-17-nomcon-2026-x"},
+	} {
+		got, num, err := c.Filename(tc.req)
+		Tassert(t, err == nil, tc.req, err)
+		Tassert(t, got == tc.want, Spf("%v: got %q want %q", tc.req, got, tc.want))
+		Tassert(t, strings.HasPrefix(got, Spf("mcp-%d", num)), got, num)
+	}
+
+	for _, req := range []NameRequest{
+		{Doctype: "misc", Filename: "foo-17-x", NextNum: 17},
+		{Doctype: "misc", Filename: "mcp-17x", NextNum: 17},
+		{Doctype: "misc", Filename: "mcp-0-x", NextNum: 17},
+		{Doctype: "misc", Filename: "mcp-17-a/b", NextNum: 17},
+		{Doctype: "misc", Title: "a/b", NextNum: 17},
+		{Doctype: "misc", Filename: "mcp-17-nomcon-2026-x", NextNum: 17},
+		{Doctype: "nomcon", Filename: "mcp-17-keynote", Year: 2026, NextNum: 17},
+		{Doctype: "nomcon", Filename: "mcp-17-nomcon-2025-keynote", Year: 2026, NextNum: 17},
+		{Doctype: "nomcon", Year: 2026, NextNum: 17},
+		{Doctype: "cswg", Filename: "mcp-17-tools", NextNum: 17},
+	} {
+		_, _, err := c.Filename(req)
+		Tassert(t, errors.Is(err, ErrBadName), req, err)
+	}
+
+	c.FixedNumbers = true
+	_, _, err := c.Filename(NameRequest{Doctype: "misc", Filename: "mcp-5-old", NextNum: 17})
+	Tassert(t, errors.Is(err, ErrBadName), err)
+	_, _, err = c.Filename(NameRequest{Doctype: "misc", Filename: "mcp-17-new", NextNum: 17})
+	Tassert(t, err == nil, err)
+}
+
+func TestMaxNameLength(t *testing.T) {
+	c := &Conf{Docprefix: "mcp", MaxNameLen: 30}
+	name, _, err := c.Filename(NameRequest{Doctype: "nomcon", Title: "A very long session title indeed", Year: 2026, NextNum: 17})
+	Tassert(t, err == nil, err)
+	Tassert(t, name == "mcp-17-nomcon-2026-a-very-long", name)
+	name = c.DocName("misc", 17, 0, strings.Repeat("word ", 20))
+	Tassert(t, name == "mcp-17-word-word-word-word", name)
+	// the required segments and the start of the title are never cut
+	c.MaxNameLen = 20
+	name, _, err = c.Filename(NameRequest{Doctype: "nomcon", Title: "Keynote", Year: 2026, NextNum: 17})
+	Tassert(t, err == nil && name == "mcp-17-nomcon-2026-k", name, err)
+	name = c.DocName("cswg", 17, 0, "Tools and toys")
+	Tassert(t, name == "mcp-17-cswg-workshop-t", name)
+	name = c.DocName("misc", 17, 0, "Tools and toys")
+	Tassert(t, name == "mcp-17-tools-and", name)
+	// but a name that still doesn't fit is refused
+	_, _, err = c.Filename(NameRequest{Doctype: "cswg", Title: "Tools", NextNum: 17})
+	Tassert(t, errors.Is(err, ErrBadName), err)
+
+	// max_name_len must leave room for the longest required segments
+	c = &Conf{Folderid: "f", Docprefix: "mcp", Template: "t", Url: "http://x", MaxNameLen: 25}
+	err = c.Validate()
+	Tassert(t, err != nil && strings.Contains(err.Error(), "max_name_len:"), err)
+	c.MaxNameLen = c.minNameLen()
+	Tassert(t, c.Validate() == nil, c.Validate())
+	name = c.DocName("cswg", 999999, 0, "Tools")
+	Tassert(t, name == "mcp-999999-cswg-workshop-t" && len(name) <= c.MaxNameLen, name)
+	name, _, err = c.Filename(NameRequest{Doctype: "nomcon", Title: "Keynote", Year: 2026, NextNum: 999999})
+	Tassert(t, err == nil && len(name) <= c.MaxNameLen, name, err)
+}
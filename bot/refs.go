@@ -0,0 +1,21 @@
+package bot
+
+import (
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// UpdateRefs refreshes the cross-reference index from the folder and
+// saves it.
+func (b *Bot) UpdateRefs(tx *transaction.Transaction) (idx *transaction.RefIndex, fetched int, err error) {
+	defer Return(&err)
+	Assert(tx.Refs != nil)
+	conf := b.CurrentConf()
+	idx, err = tx.Refs.Load()
+	Ck(err)
+	fetched, err = tx.UpdateRefs(idx, conf.Docprefix, conf.Url)
+	Ck(err)
+	err = tx.Refs.Save(idx)
+	Ck(err)
+	return
+}
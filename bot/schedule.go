@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// scheduleColumns maps common schedule column names, after
+// transaction.HeaderField, to the placeholders the session form
+// fills.  Other columns are passed through as placeholders of the
+// same name.
+var scheduleColumns = map[string]string{
+	"TITLE":       "SESSION_TITLE",
+	"SESSION":     "SESSION_TITLE",
+	"DATE":        "SESSION_DATE",
+	"START":       "SESSION_TIME",
+	"TIME":        "SESSION_TIME",
+	"SPEAKER":     "SESSION_SPEAKERS",
+	"SPEAKERS":    "SESSION_SPEAKERS",
+	"DESCRIPTION": "SESSION_DESCRIPTION",
+	"ROOM":        "SESSION_LOCATION",
+	"LOCATION":    "SESSION_LOCATION",
+}
+
+// scheduleColumn returns the placeholder name for a column heading.
+func scheduleColumn(heading string) string {
+	name := transaction.HeaderField(heading)
+	if mapped, ok := scheduleColumns[name]; ok {
+		return mapped
+	}
+	return name
+}
+
+// ReadSchedule reads the sessions in a .csv or .ics file.  Each
+// session is a set of placeholder values; see ParseCSV and ParseICS.
+func ReadSchedule(fn string) (rows []map[string]string, err error) {
+	defer Return(&err)
+	f, err := os.Open(fn)
+	Ck(err)
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".csv":
+		return ParseCSV(f)
+	case ".ics":
+		return ParseICS(f)
+	}
+	return nil, fmt.Errorf("%s: schedule must be a .csv or .ics file", fn)
+}
+
+// ParseCSV reads a schedule with a heading row.  Headings such as
+// "Title", "Date" and "Speakers" fill the session placeholders
+// SESSION_TITLE, SESSION_DATE and SESSION_SPEAKERS; any other heading
+// is upper-cased, with spaces turned into underscores, and fills the
+// placeholder of that name.  A "Time" or "Start" column is joined to
+// the date; see joinSessionTime.  Blank rows are skipped.
+func ParseCSV(r io.Reader) (rows []map[string]string, err error) {
+	defer Return(&err)
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	recs, err := cr.ReadAll()
+	Ck(err)
+	if len(recs) == 0 {
+		return
+	}
+	var names []string
+	for _, h := range recs[0] {
+		names = append(names, scheduleColumn(strings.TrimPrefix(h, "\ufeff")))
+	}
+	for i, rec := range recs[1:] {
+		row := make(map[string]string)
+		for j, v := range rec {
+			v = strings.TrimSpace(v)
+			if j >= len(names) || names[j] == "" || v == "" {
+				continue
+			}
+			Assert(row[names[j]] == "", "row %d: more than one column fills %s", i+2, names[j])
+			row[names[j]] = v
+		}
+		joinSessionTime(row)
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return
+}
+
+// joinSessionTime moves a row's SESSION_TIME into SESSION_DATE, so a
+// schedule may give the date and time in separate columns.  The time
+// is appended to the date unless it is a full date itself or there is
+// no date.
+func joinSessionTime(row map[string]string) {
+	tm, ok := row["SESSION_TIME"]
+	if !ok {
+		return
+	}
+	delete(row, "SESSION_TIME")
+	date := row["SESSION_DATE"]
+	if _, err := transaction.ParseDate(tm); date == "" || err == nil {
+		row["SESSION_DATE"] = tm
+		return
+	}
+	row["SESSION_DATE"] = date + " " + tm
+}
+
+// ParseICS reads the VEVENTs of an iCalendar file.  SUMMARY fills
+// SESSION_TITLE, DTSTART fills SESSION_DATE as "2006-01-02 15:04" (or
+// "2006-01-02" for all-day events) and DTEND likewise fills
+// SESSION_END, ORGANIZER and ATTENDEE common names fill
+// SESSION_SPEAKERS, and DESCRIPTION, LOCATION, URL and UID fill
+// SESSION_DESCRIPTION, SESSION_LOCATION, SESSION_URL and SESSION_UID.
+func ParseICS(r io.Reader) (rows []map[string]string, err error) {
+	defer Return(&err)
+	lines, err := icsLines(r)
+	Ck(err)
+	var row map[string]string
+	var speakers []string
+	// nested counts open components, such as alarms, inside an event
+	nested := 0
+	for _, line := range lines {
+		name, params, value := icsProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			row = make(map[string]string)
+			speakers = nil
+		case row != nil && name == "BEGIN":
+			nested++
+		case row != nil && name == "END" && nested > 0:
+			nested--
+		case nested > 0:
+		case name == "END" && value == "VEVENT":
+			if row != nil {
+				if len(speakers) > 0 {
+					row["SESSION_SPEAKERS"] = strings.Join(speakers, ", ")
+				}
+				rows = append(rows, row)
+			}
+			row = nil
+		case row == nil:
+		case name == "SUMMARY":
+			row["SESSION_TITLE"] = icsText(value)
+		case name == "DTSTART":
+			row["SESSION_DATE"], err = icsDate(value)
+			Ck(err)
+		case name == "DTEND":
+			row["SESSION_END"], err = icsDate(value)
+			Ck(err)
+		case name == "ORGANIZER" || name == "ATTENDEE":
+			if cn := params["CN"]; cn != "" {
+				speakers = append(speakers, cn)
+			}
+		case name == "DESCRIPTION" || name == "LOCATION" || name == "URL" || name == "UID":
+			row["SESSION_"+name] = icsText(value)
+		}
+	}
+	return
+}
+
+// icsLines returns the unfolded content lines of an iCalendar file.
+func icsLines(r io.Reader) (lines []string, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+// icsProperty splits a content line such as
+// `ATTENDEE;CN="Ann Arms";ROLE=CHAIR:mailto:ann@example.com`.
+func icsProperty(line string) (name string, params map[string]string, value string) {
+	params = make(map[string]string)
+	// the value starts at the first colon outside quotes
+	quoted := false
+	i := 0
+	for ; i < len(line); i++ {
+		if line[i] == '"' {
+			quoted = !quoted
+		}
+		if line[i] == ':' && !quoted {
+			break
+		}
+	}
+	head := line[:i]
+	if i < len(line) {
+		value = line[i+1:]
+	}
+	parts := strings.Split(head, ";")
+	name = strings.ToUpper(parts[0])
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return
+}
+
+// icsText unescapes a TEXT value.
+func icsText(v string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(v)
+}
+
+// icsDate converts a DTSTART or DTEND value.  Times with a TZID are kept as
+// local wall-clock times; UTC times are given in UTC.
+func icsDate(v string) (string, error) {
+	if t, err := time.Parse("20060102", v); err == nil {
+		return t.Format("2006-01-02"), nil
+	}
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.Format("2006-01-02 15:04"), nil
+		}
+	}
+	return "", fmt.Errorf("cannot parse DTSTART %q", v)
+}
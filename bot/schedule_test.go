@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestReadScheduleCSV(t *testing.T) {
+	rows, err := ReadSchedule("testdata/schedule/schedule.csv")
+	Tassert(t, err == nil, err)
+	Tassert(t, len(rows) == 2, rows)
+	Tassert(t, rows[0]["SESSION_TITLE"] == "Tools, and toys", rows[0])
+	Tassert(t, rows[0]["SESSION_SPEAKERS"] == "Ann Arms\nBob Barker", rows[0])
+	Tassert(t, rows[0]["SESSION_LOCATION"] == "Hall A" && rows[0]["TRACK"] == "main", rows[0])
+	Tassert(t, len(rows[1]) == 2 && rows[1]["SESSION_DATE"] == "2026-10-20", rows[1])
+
+	_, err = ReadSchedule("testdata/docbot.conf")
+	Tassert(t, err != nil)
+}
+
+func TestReadScheduleCSVTime(t *testing.T) {
+	rows, err := ReadSchedule("testdata/schedule/schedule-time.csv")
+	Tassert(t, err == nil, err)
+	Tassert(t, len(rows) == 3, rows)
+	Tassert(t, rows[0]["SESSION_DATE"] == "2026-10-19 09:00", rows[0])
+	Tassert(t, rows[1]["SESSION_DATE"] == "2026-10-20", rows[1])
+	Tassert(t, rows[2]["SESSION_DATE"] == "2026-10-21 14:30", rows[2])
+	for _, row := range rows {
+		_, ok := row["SESSION_TIME"]
+		Tassert(t, !ok, row)
+	}
+}
+
+func TestReadScheduleICS(t *testing.T) {
+	rows, err := ReadSchedule("testdata/schedule/schedule.ics")
+	Tassert(t, err == nil, err)
+	Tassert(t, len(rows) == 3, rows)
+	expect := map[string]string{
+		"SESSION_TITLE":       "Tools, and toys",
+		"SESSION_DATE":        "2026-10-19 09:00",
+		"SESSION_END":         "2026-10-19 10:30",
+		"SESSION_SPEAKERS":    "Arms, Ann, Bob Barker",
+		"SESSION_DESCRIPTION": "Line one\nline two that is folded across lines",
+		"SESSION_LOCATION":    "Hall A",
+		"SESSION_UID":         "s1@example.com",
+	}
+	Tassert(t, len(rows[0]) == len(expect), rows[0])
+	for k, v := range expect {
+		Tassert(t, rows[0][k] == v, Spf("%s: %q", k, rows[0][k]))
+	}
+	Tassert(t, rows[1]["SESSION_DATE"] == "2026-10-20", rows[1])
+	Tassert(t, rows[2]["SESSION_DATE"] == "2026-10-21 17:00", rows[2])
+}
+
+func TestDocName(t *testing.T) {
+	c := &Conf{Docprefix: "mcp"}
+	Tassert(t, c.DocName("nomcon", 17, 2026, "Tools, and toys") == "mcp-17-nomcon-2026-tools-and-toys")
+	Tassert(t, c.DocName("cswg", 18, 0, "Intro") == "mcp-18-cswg-workshop-intro")
+	Tassert(t, c.DocName("misc", 19, 0, "?") == "mcp-19")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	Tassert(t, sessionYear(map[string]string{"SESSION_DATE": "2026-10-19 09:00"}, now) == 2026)
+	Tassert(t, sessionYear(map[string]string{"SESSION_YEAR": "2027", "SESSION_DATE": "2026-10-19"}, now) == 2027)
+	Tassert(t, sessionYear(nil, now) == 2025)
+}
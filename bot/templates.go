@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"sort"
+	"time"
+
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// TemplateEntry is a template document and the config keys, if any,
+// that refer to it.
+type TemplateEntry struct {
+	*transaction.TemplateInfo
+	Roles []string
+}
+
+// TemplateReport lists the available templates and any problems
+// with them.
+type TemplateReport struct {
+	Templates []*TemplateEntry
+	Warnings  []string
+}
+
+// configured returns the configured template names keyed by config
+// key, omitting unset keys.
+func (c *Conf) configured() (tmpls map[string]string) {
+	tmpls = make(map[string]string)
+	for k, v := range map[string]string{
+		"template":         c.Template,
+		"session_template": c.SessionTemplate,
+		"cswg_template":    c.CSWGTemplate,
+	} {
+		if v != "" {
+			tmpls[k] = v
+		}
+	}
+	return
+}
+
+// ListTemplates discovers the template documents in the folder and
+// checks them against the config.  If detail is true, each template
+// is also fetched to find its placeholders and headers.
+func (b *Bot) ListTemplates(tx *transaction.Transaction, detail bool) (r *TemplateReport, err error) {
+	defer Return(&err)
+	r = &TemplateReport{}
+	conf := b.CurrentConf()
+	cfg := conf.configured()
+	var keys, names []string
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		names = append(names, cfg[k])
+	}
+
+	nodes, err := tx.Templates(names...)
+	Ck(err)
+
+	count := make(map[string]int)
+	for _, n := range nodes {
+		count[n.Name()]++
+	}
+	for _, k := range keys {
+		if count[cfg[k]] == 0 {
+			r.Warnings = append(r.Warnings, Spf("%s: configured template %q not found", k, cfg[k]))
+		}
+	}
+	warned := make(map[string]bool)
+	for _, n := range nodes {
+		if count[n.Name()] > 1 && !warned[n.Name()] {
+			warned[n.Name()] = true
+			r.Warnings = append(r.Warnings, Spf("%q: %d documents with this name", n.Name(), count[n.Name()]))
+		}
+	}
+
+	for _, n := range nodes {
+		e := &TemplateEntry{TemplateInfo: &transaction.TemplateInfo{Node: n}}
+		for _, k := range keys {
+			if cfg[k] == n.Name() {
+				e.Roles = append(e.Roles, k)
+			}
+		}
+		if detail {
+			e.TemplateInfo, err = tx.TemplateInfo(n)
+			Ck(err, n.Name())
+			r.Warnings = append(r.Warnings, e.problems()...)
+		}
+		r.Templates = append(r.Templates, e)
+	}
+	return
+}
+
+// Template returns the entry for the template named name, or nil.
+func (r *TemplateReport) Template(name string) *TemplateEntry {
+	for _, e := range r.Templates {
+		if e.Node.Name() == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// problems returns warnings about the template's placeholders.
+func (e *TemplateEntry) problems() (msgs []string) {
+	name := e.Node.Name()
+	if e.Legacy {
+		msgs = append(msgs, Spf("%q: no {{NAME}} placeholders; using legacy bare-word replacement", name))
+	}
+	if _, ok := e.Headers["Name"]; !ok {
+		msgs = append(msgs, Spf("%q: no Name: header", name))
+	}
+	// a format that contains no layout elements would replace the
+	// value with the literal format text; the reference time differs
+	// from the layout's in every element, so any element changes it
+	ref := time.Date(1999, 11, 28, 22, 33, 44, 0, time.UTC)
+	for _, ph := range e.Placeholders {
+		if transaction.DateFormat(ph.Format) && ref.Format(ph.Format) == ph.Format {
+			msgs = append(msgs, Spf("%q: %s: format has no date layout elements", name, ph.Token))
+		}
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/google/fakedrive"
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/drive/v2"
+)
+
+func TestTemplateProblems(t *testing.T) {
+	gf, err := google.NewFolder(nil, "folder", regexp.MustCompile(`^mcp-(\d+)`), 1)
+	Tassert(t, err == nil, err)
+	e := &TemplateEntry{TemplateInfo: &transaction.TemplateInfo{
+		Node:    gf.NewNode(&drive.File{Id: "t", Title: "session-template"}),
+		Headers: map[string]string{"Name": "{{NAME}}"},
+		Placeholders: google.ParsePlaceholders(
+			"{{SESSION_DATE|Jan 2, 2006}} {{SESSION_SPEAKERS|list}} {{TITLE}} {{SESSION_END|soon}}"),
+	}}
+	msgs := e.problems()
+	Tassert(t, len(msgs) == 1, msgs)
+	Tassert(t, strings.Contains(msgs[0], "{{SESSION_END|soon}}"), msgs)
+}
+
+func TestListTemplates(t *testing.T) {
+	b, fd := fakeBot(t, `, "cswg_template": "mcp-template"`)
+	fd.AddDoc(fakeFolder, "mcp-template", fakedrive.Doc("Name: {{NAME}}", "", "{{TITLE}} in {{SESSION_LOCATION}}"))
+	fd.AddDoc(fakeFolder, "workshop-template", nil)
+	fd.AddDoc(fakeFolder, "workshop-template", nil)
+	intro := fd.AddDoc(fakeFolder, "intro", fakedrive.Doc("Welcome NAME"))
+	fd.SetProperty(intro.Id, transaction.TemplateProperty, "true")
+	fd.AddDoc(fakeFolder, "mcp-5-foo", nil)
+
+	tx := b.StartTransaction()
+	defer tx.Close()
+	for _, detail := range []bool{false, true} {
+		r, err := b.ListTemplates(tx, detail)
+		Tassert(t, err == nil, err)
+		var names []string
+		for _, e := range r.Templates {
+			names = append(names, e.Node.Name())
+		}
+		Tassert(t, strings.Join(names, " ") == "intro mcp-template workshop-template workshop-template", names)
+
+		e := r.Template("mcp-template")
+		Tassert(t, strings.Join(e.Roles, " ") == "cswg_template template", e.Roles)
+		Tassert(t, len(r.Template("intro").Roles) == 0, r.Template("intro").Roles)
+
+		want := []string{
+			`session_template: configured template "session-template" not found`,
+			`"workshop-template": 2 documents with this name`,
+		}
+		if detail {
+			Tassert(t, e.Headers["Name"] == "{{NAME}}", e.Headers)
+			Tassert(t, strings.Join(e.Inputs, " ") == "SESSION_LOCATION", e.Inputs)
+			want = append(want,
+				`"intro": no {{NAME}} placeholders; using legacy bare-word replacement`,
+				`"intro": no Name: header`,
+			)
+		}
+		for _, w := range want {
+			found := false
+			for _, msg := range r.Warnings {
+				found = found || msg == w
+			}
+			Tassert(t, found, detail, w, r.Warnings)
+		}
+		if detail {
+			// each workshop-template lacks placeholders and a header
+			Tassert(t, len(r.Warnings) == len(want)+4, r.Warnings)
+		} else {
+			Tassert(t, len(r.Warnings) == len(want), r.Warnings)
+		}
+	}
+}
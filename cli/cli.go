@@ -2,10 +2,19 @@ package cli
 
 import (
 	"embed"
+	"encoding/json"
 	"os"
+	"os/user"
+	"strconv"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/stevegt/docbot/bot"
+	"github.com/stevegt/docbot/export"
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	"github.com/stevegt/docbot/util"
 	. "github.com/stevegt/goadapt"
 )
 
@@ -15,26 +24,115 @@ var fs embed.FS
 func Run(b *bot.Bot) (err error) {
 	defer Return(&err)
 
+	t, err := template.ParseFS(fs, "template/*")
+	Ck(err)
+
+	// config check must be able to report on a config that Init
+	// would reject
+	if b.Config && b.Check {
+		r := b.CheckConf()
+		err = t.ExecuteTemplate(os.Stdout, "config.txt", r)
+		Ck(err)
+		Assert(r.Ok(), "config check failed: %s", b.Confpath)
+		return
+	}
+
 	err = b.Init()
 	Ck(err)
 
+	// restore may target another folder, so it manages its own
+	// transaction
+	if b.Restore && !b.Trash {
+		items, err := b.RestoreFrom(b.Src, b.Folderid, b.DryRun)
+		Ck(err)
+		err = t.ExecuteTemplate(os.Stdout, "restore.txt", items)
+		Ck(err)
+		return nil
+	}
+
+	tx := b.StartTransaction()
+	defer tx.Close()
+	tx.Actor = actor()
+
 	var tname string
 	switch true {
+	case b.Templates:
+		return templates(b, t, tx)
+	case b.Rename:
+		node, err := tx.GetByName(b.Name)
+		Ck(err)
+		Assert(node != nil, "not found: %s", b.Name)
+		_, err = tx.Rename(node, b.Newname)
+		Ck(err)
+		return nil
+	case b.Dedupe:
+		return dedupe(b, t, tx)
+	case b.Alias:
+		return alias(b, t, tx)
+	case b.Import:
+		items, err := b.ImportDocs(tx, b.Id, b.Move, b.DryRun)
+		Ck(err)
+		err = t.ExecuteTemplate(os.Stdout, "import.txt", items)
+		Ck(err)
+		return nil
+	case b.Trash:
+		return trash(b, t, tx)
+	case b.Refs:
+		return refs(b, t, tx)
+	case b.Set:
+		return setFields(b, tx)
+	case b.Drift:
+		return drift(b, t, tx)
+	case b.BulkCreate:
+		return bulkCreate(b, tx)
+	case b.Sessions:
+		return sessions(b, t, tx)
+	case b.Export:
+		return exportDocs(b, tx)
+	case b.Backup:
+		m, err := b.BackupTo(tx, b.Dest, b.Incremental)
+		Ck(err)
+		err = t.ExecuteTemplate(os.Stdout, "backup.txt", m)
+		Ck(err)
+		return nil
 	case b.Ls:
 		tname = "ls.txt"
 	default:
 		Assert(false, "unhandled: %#v", b)
 	}
 
-	t, err := template.ParseFS(fs, "template/*")
+	err = t.ExecuteTemplate(os.Stdout, tname, tx)
 	Ck(err)
 
-	tx := b.StartTransaction()
-	defer tx.Close()
+	return
+}
 
-	err = t.ExecuteTemplate(os.Stdout, tname, tx)
+func templates(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	r, err := b.ListTemplates(tx, b.Show || b.Validate)
 	Ck(err)
-
+	switch true {
+	case b.Show:
+		e := r.Template(b.Name)
+		if e == nil {
+			// not discovered as a template, but show it anyway
+			node, err := tx.GetByName(b.Name)
+			Ck(err)
+			Assert(node != nil, "not found: %s", b.Name)
+			info, err := tx.TemplateInfo(node)
+			Ck(err)
+			e = &bot.TemplateEntry{TemplateInfo: info}
+		}
+		err = t.ExecuteTemplate(os.Stdout, "template.txt", e)
+		Ck(err)
+	case b.Validate:
+		err = t.ExecuteTemplate(os.Stdout, "templates.txt", r)
+		Ck(err)
+		Assert(len(r.Warnings) == 0, "template validation failed")
+	default:
+		err = t.ExecuteTemplate(os.Stdout, "templates.txt", r)
+		Ck(err)
+	}
 	return
 }
 
@@ -52,3 +150,284 @@ func ls(b *bot.Bot) (out []byte, err error) {
 	return
 }
 */
+
+func dedupe(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	plan, err := tx.Duplicates()
+	Ck(err)
+	err = t.ExecuteTemplate(os.Stdout, "dedupe.txt", plan)
+	Ck(err)
+	if !b.Apply {
+		return
+	}
+	for _, p := range plan {
+		_, err = tx.Rename(p.Node, p.NewName)
+		Ck(err)
+	}
+	return
+}
+
+func alias(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	Assert(tx.Aliases != nil)
+	switch true {
+	case b.Add:
+		err = tx.CheckAlias(b.AliasName)
+		Ck(err)
+		nodes, err := tx.Resolve(b.Name)
+		Ck(err)
+		Assert(len(nodes) == 1, "%s matches %d documents", b.Name, len(nodes))
+		err = tx.Aliases.Add(b.AliasName, nodes[0].Id())
+		Ck(err)
+	case b.Rm:
+		err = tx.Aliases.Rm(b.AliasName)
+		Ck(err)
+	default:
+		infos, err := tx.AliasList()
+		Ck(err)
+		err = t.ExecuteTemplate(os.Stdout, "alias.txt", infos)
+		Ck(err)
+	}
+	return
+}
+
+// actor returns the name recorded in the audit log for changes made
+// from the command line.
+func actor() string {
+	u, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER")
+	}
+	return u.Username
+}
+
+func trash(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	switch true {
+	case b.Restore:
+		node, err := tx.Untrash(b.Name)
+		Ck(err)
+		Pl(node.URL())
+	case b.Purge:
+		entries, err := tx.TrashList()
+		Ck(err)
+		retention := b.CurrentConf().Retention()
+		now := time.Now()
+		for _, e := range entries {
+			if !b.All && !e.Expired(retention, now) {
+				continue
+			}
+			err = tx.Purge(e.Node)
+			Ck(err)
+			Pf("purged %s\n", e.Node.Name())
+		}
+	default:
+		entries, err := tx.TrashList()
+		Ck(err)
+		err = t.ExecuteTemplate(os.Stdout, "trash.txt", entries)
+		Ck(err)
+	}
+	return
+}
+
+func refs(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	Assert(tx.Refs != nil)
+	if b.Update {
+		idx, fetched, err := b.UpdateRefs(tx)
+		Ck(err)
+		Pf("indexed %d documents, %d fetched\n", len(idx.Docs), fetched)
+		return nil
+	}
+	idx, err := tx.Refs.Load()
+	Ck(err)
+	Assert(idx.Updated != "", "no reference index: run 'docbot refs update'")
+	switch true {
+	case b.Backlinks:
+		nodes, err := tx.Resolve(b.Name)
+		Ck(err)
+		Assert(len(nodes) == 1, "%s matches %d documents", b.Name, len(nodes))
+		Assert(nodes[0].Num() > 0, "not a numbered document: %s", nodes[0].Name())
+		for _, e := range idx.Backlinks(nodes[0].Num()) {
+			if e.Id != nodes[0].Id() {
+				Pl(e.Name)
+			}
+		}
+	case b.Dangling:
+		err = t.ExecuteTemplate(os.Stdout, "dangling.txt", idx.Dangling())
+		Ck(err)
+	case b.Graph:
+		g := idx.Graph()
+		if b.Json {
+			buf, err := json.MarshalIndent(g, "", "  ")
+			Ck(err)
+			Pl(string(buf))
+		} else {
+			Pf("%s", g.DOT(b.CurrentConf().Url))
+		}
+	}
+	return
+}
+
+func setFields(b *bot.Bot, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	nodes, err := tx.Resolve(b.Name)
+	Ck(err)
+	Assert(len(nodes) == 1, "%s matches %d documents", b.Name, len(nodes))
+	vals := make(map[string]string)
+	for _, a := range b.Assignments {
+		parts := strings.SplitN(a, "=", 2)
+		Assert(len(parts) == 2, "expected Key=value: %q", a)
+		vals[transaction.HeaderField(parts[0])] = parts[1]
+	}
+	set, err := tx.SetFields(nodes[0], vals)
+	Ck(err)
+	Pf("%s: set %s\n", nodes[0].Name(), strings.Join(set, ", "))
+	return
+}
+
+// driftEntry is a document whose fields have drifted.
+type driftEntry struct {
+	Node   *google.Node
+	Drifts []transaction.Drift
+}
+
+func drift(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	var nodes []*google.Node
+	if b.Name != "" {
+		nodes, err = tx.Resolve(b.Name)
+		Ck(err)
+		Assert(len(nodes) == 1, "%s matches %d documents", b.Name, len(nodes))
+	} else {
+		all, err := tx.AllNodes()
+		Ck(err)
+		for _, n := range all {
+			if n.MimeType() == google.DocMimeType && n.Num() > 0 && !transaction.IsTemplate(n) {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	var entries []driftEntry
+	for _, n := range nodes {
+		drifts, err := tx.Drift(n)
+		Ck(err)
+		if len(drifts) > 0 {
+			entries = append(entries, driftEntry{n, drifts})
+		}
+	}
+	err = t.ExecuteTemplate(os.Stdout, "drift.txt", entries)
+	Ck(err)
+	return
+}
+
+func bulkCreate(b *bot.Bot, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	rows, err := bot.ReadSchedule(b.Schedule)
+	Ck(err)
+	items, err := b.CreateBulk(tx, b.Type, rows, actor(), b.DryRun)
+	Ck(err)
+	w := os.Stdout
+	if b.Output != "" {
+		w, err = os.Create(b.Output)
+		Ck(err)
+		defer w.Close()
+	}
+	err = b.WriteBulkCSV(w, items)
+	Ck(err)
+	if b.DryRun {
+		Fpf(os.Stderr, "dry run: %d documents not created\n", len(items))
+	}
+	return
+}
+
+// sessionEntry is a document whose session sessions update records.
+type sessionEntry struct {
+	Node    *google.Node
+	Session *transaction.Session
+}
+
+func sessions(b *bot.Bot, t *template.Template, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	all, err := tx.AllNodes()
+	Ck(err)
+	var entries []sessionEntry
+	for _, n := range all {
+		if n.MimeType() != google.DocMimeType || n.Num() == 0 || transaction.IsTemplate(n) {
+			continue
+		}
+		if util.Doctype(n.Name()) != "nomcon" || transaction.SessionFromProperties(n.Property) != nil {
+			continue
+		}
+		txt, err := tx.Doc2txt(n)
+		Ck(err)
+		sess := transaction.SessionFromText(txt)
+		if sess == nil {
+			continue
+		}
+		if !b.DryRun {
+			_, err = tx.SetSession(n, sess)
+			Ck(err, n.Name())
+		}
+		entries = append(entries, sessionEntry{n, sess})
+	}
+	err = t.ExecuteTemplate(os.Stdout, "sessions.txt", entries)
+	Ck(err)
+	if b.DryRun {
+		Fpf(os.Stderr, "dry run: %d documents not updated\n", len(entries))
+	}
+	return
+}
+
+func exportDocs(b *bot.Bot, tx *transaction.Transaction) (err error) {
+	defer Return(&err)
+	conf := b.CurrentConf()
+	ok := false
+	for _, f := range export.Formats {
+		ok = ok || f == b.Format
+	}
+	Assert(ok, "unknown export format: %q", b.Format)
+
+	var nodes []*google.Node
+	output := b.Output
+	title := b.Title
+	if b.Name != "" {
+		nodes, err = tx.Resolve(b.Name)
+		Ck(err)
+		Assert(len(nodes) == 1, "%s matches %d documents", b.Name, len(nodes))
+		if output == "" {
+			output = nodes[0].Name() + "." + b.Format
+		}
+	} else {
+		f := &export.Filter{Doctype: b.Doctype, Tag: b.Tag}
+		for _, p := range []struct {
+			s string
+			n *int
+		}{{b.From, &f.From}, {b.To, &f.To}} {
+			if p.s != "" {
+				*p.n, err = strconv.Atoi(p.s)
+				Ck(err)
+			}
+		}
+		nodes, err = export.Select(tx, f)
+		Ck(err)
+		if output == "" {
+			output = f.Filename(conf.Docprefix, b.Format)
+		}
+		if title == "" {
+			title = Spf("%s documents", conf.Docprefix)
+		}
+	}
+
+	book, err := export.Build(tx, nodes, title, b.Tag)
+	Ck(err)
+	fh, err := os.Create(output)
+	Ck(err)
+	defer fh.Close()
+	err = export.Write(fh, book, b.Format)
+	Ck(err)
+	err = fh.Close()
+	Ck(err)
+	Pf("wrote %s: %d documents\n", output, len(book.Chapters))
+	return
+}
@@ -0,0 +1,246 @@
+package export
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// span is a run of text with one style.
+type span struct {
+	text   string
+	bold   bool
+	italic bool
+	code   bool
+	link   string
+}
+
+type blockKind int
+
+const (
+	bPara blockKind = iota
+	bHeading
+	bItem
+	bRule
+	bImage
+	bTable
+)
+
+// block is a unit of page layout, flattened from google.HTML output.
+type block struct {
+	kind  blockKind
+	spans []span
+	// level is the heading level, or the list depth starting at 0
+	level  int
+	marker string
+	src    string
+	rows   [][][]span
+}
+
+// parseBlocks flattens a page rendered by google.HTML into blocks.
+func parseBlocks(buf []byte) (blocks []block, err error) {
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return
+	}
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return
+	}
+	p := &blockParser{}
+	p.children(body, 0)
+	return p.blocks, nil
+}
+
+// findElement returns the first element of type a in n's subtree.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+type blockParser struct {
+	blocks []block
+	// images are found while collecting inline content and emitted
+	// after the block that contains them
+	images []string
+}
+
+func (p *blockParser) children(n *html.Node, depth int) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		p.node(c, depth)
+	}
+}
+
+func (p *blockParser) node(n *html.Node, depth int) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level, _ := strconv.Atoi(n.Data[1:])
+		p.add(block{kind: bHeading, level: level, spans: p.inline(n, span{bold: true})})
+	case atom.P:
+		p.add(block{kind: bPara, spans: p.inline(n, span{})})
+	case atom.Ul, atom.Ol:
+		num := 0
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+				continue
+			}
+			num++
+			marker := "•"
+			if n.DataAtom == atom.Ol {
+				marker = Spf("%d.", num)
+			}
+			p.add(block{kind: bItem, level: depth, marker: marker, spans: p.inline(li, span{})})
+			for c := li.FirstChild; c != nil; c = c.NextSibling {
+				if c.DataAtom == atom.Ul || c.DataAtom == atom.Ol {
+					p.node(c, depth+1)
+				}
+			}
+		}
+	case atom.Table:
+		b := block{kind: bTable}
+		for _, tr := range elements(n, atom.Tr) {
+			var row [][]span
+			for _, td := range elements(tr, atom.Td) {
+				row = append(row, p.cell(td))
+			}
+			b.rows = append(b.rows, row)
+		}
+		p.add(b)
+	case atom.Hr:
+		p.add(block{kind: bRule})
+	case atom.Img:
+		p.add(block{kind: bImage, src: attr(n, "src")})
+	default:
+		p.children(n, depth)
+	}
+}
+
+// add appends b, dropping empty text blocks, followed by any images
+// found in it.
+func (p *blockParser) add(b block) {
+	switch b.kind {
+	case bPara, bHeading, bItem:
+		if b.kind == bItem || strings.TrimSpace(spansText(b.spans)) != "" {
+			p.blocks = append(p.blocks, b)
+		}
+	default:
+		p.blocks = append(p.blocks, b)
+	}
+	for _, src := range p.images {
+		p.blocks = append(p.blocks, block{kind: bImage, src: src})
+	}
+	p.images = nil
+}
+
+// elements returns the elements of type a below n, not descending
+// into nested tables.
+func elements(n *html.Node, a atom.Atom) (els []*html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch {
+		case c.DataAtom == a:
+			els = append(els, c)
+		case c.DataAtom != atom.Table:
+			els = append(els, elements(c, a)...)
+		}
+	}
+	return
+}
+
+// cell flattens a table cell's content, one line per block.  Images
+// in cells are dropped.
+func (p *blockParser) cell(td *html.Node) (spans []span) {
+	sub := &blockParser{}
+	sub.children(td, 0)
+	for _, b := range sub.blocks {
+		if len(spans) > 0 {
+			spans = append(spans, span{text: "\n"})
+		}
+		if b.marker != "" {
+			spans = append(spans, span{text: b.marker + " "})
+		}
+		spans = append(spans, b.spans...)
+	}
+	return
+}
+
+// inline collects the text under n, not including nested lists.
+func (p *blockParser) inline(n *html.Node, st span) (spans []span) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			s := st
+			s.text = c.Data
+			spans = append(spans, s)
+		case html.ElementNode:
+			s := st
+			switch c.DataAtom {
+			case atom.Ul, atom.Ol:
+				continue
+			case atom.Br:
+				spans = append(spans, span{text: "\n"})
+				continue
+			case atom.Img:
+				p.images = append(p.images, attr(c, "src"))
+				continue
+			case atom.Strong, atom.B:
+				s.bold = true
+			case atom.Em, atom.I:
+				s.italic = true
+			case atom.Code:
+				s.code = true
+			case atom.A:
+				href := attr(c, "href")
+				if strings.HasPrefix(href, "#fnref-") {
+					// footnote back links only make sense on screen
+					continue
+				}
+				if !strings.HasPrefix(href, "#") {
+					s.link = href
+				}
+			case atom.Sup:
+				// footnote references
+				inner := p.inline(c, s)
+				spans = append(spans, span{text: "["})
+				spans = append(spans, inner...)
+				spans = append(spans, span{text: "]"})
+				continue
+			}
+			spans = append(spans, p.inline(c, s)...)
+		}
+	}
+	return
+}
+
+func spansText(spans []span) string {
+	var sb strings.Builder
+	for _, s := range spans {
+		sb.WriteString(s.text)
+	}
+	return sb.String()
+}
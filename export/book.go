@@ -0,0 +1,180 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{"pdf", "epub"}
+
+// Filter selects the documents for a collection.  Zero values match
+// everything.
+type Filter struct {
+	Doctype string
+	From    int
+	To      int
+	// Tag matches documents whose Tags: header includes it.
+	Tag string
+}
+
+// match returns true if a document named name with number num passes
+// f's doctype and number range.  The tag is checked separately, since
+// it needs the document's text.
+func (f *Filter) match(name string, num int) bool {
+	if num == 0 {
+		return false
+	}
+	if f.Doctype != "" && util.Doctype(name) != f.Doctype {
+		return false
+	}
+	if f.From > 0 && num < f.From {
+		return false
+	}
+	if f.To > 0 && num > f.To {
+		return false
+	}
+	return true
+}
+
+// Filename returns a default output filename for f, e.g.
+// "mcp-nomcon-tools.pdf".
+func (f *Filter) Filename(docprefix, format string) string {
+	parts := []string{docprefix}
+	if f.Doctype != "" {
+		parts = append(parts, f.Doctype)
+	}
+	if f.From > 0 || f.To > 0 {
+		parts = append(parts, Spf("%d-%d", f.From, f.To))
+	}
+	if f.Tag != "" {
+		parts = append(parts, util.Slug(f.Tag))
+	}
+	return strings.Join(parts, "-") + "." + format
+}
+
+// Chapter is one document in a Book.
+type Chapter struct {
+	Name  string
+	Num   int
+	Title string
+	URL   string
+	// HTML is the document rendered by google.HTML.
+	HTML []byte
+}
+
+// Book is a set of documents to be exported as one file.
+type Book struct {
+	Title    string
+	Subtitle string
+	Created  time.Time
+	Chapters []*Chapter
+	// Image returns the content of an image in a chapter's HTML, or
+	// nil if it is not available.
+	Image func(src string) []byte
+}
+
+// Build renders nodes into a book titled title, in number order.  If
+// tag is not "", documents whose Tags: header doesn't include it are
+// left out.
+func Build(tx *transaction.Transaction, nodes []*google.Node, title, tag string) (book *Book, err error) {
+	defer Return(&err)
+	book = &Book{Title: title, Created: time.Now().UTC()}
+	book.Image = func(src string) []byte {
+		if tx.Images == nil {
+			return nil
+		}
+		fn := tx.Images.File(src)
+		if fn == "" {
+			return nil
+		}
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil
+		}
+		return buf
+	}
+
+	sorted := append([]*google.Node{}, nodes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Num() < sorted[j].Num() })
+	for _, node := range sorted {
+		doc, err := tx.Document(node)
+		Ck(err, node.Name())
+		headers := google.ParseHeaders(google.Text(doc))
+		if tag != "" && !util.HasTag(util.SplitTags(headers["Tags"]), tag) {
+			continue
+		}
+		c := &Chapter{
+			Name:  node.Name(),
+			Num:   node.Num(),
+			Title: headers["Title"],
+			URL:   node.URL(),
+		}
+		if c.Title == "" {
+			c.Title = util.Title(node.Name())
+		}
+		c.HTML, err = tx.HTML(doc)
+		Ck(err, node.Name())
+		book.Chapters = append(book.Chapters, c)
+	}
+	Assert(len(book.Chapters) > 0, "no documents to export")
+	if len(book.Chapters) == 1 && book.Title == "" {
+		book.Title = book.Chapters[0].Title
+		book.Subtitle = book.Chapters[0].Name
+	}
+	if book.Subtitle == "" {
+		book.Subtitle = Spf("%d documents", len(book.Chapters))
+	}
+	return
+}
+
+// Select returns the documents in the folder that pass f's doctype
+// and number range.
+func Select(tx *transaction.Transaction, f *Filter) (nodes []*google.Node, err error) {
+	defer Return(&err)
+	all, err := tx.AllNodes()
+	Ck(err)
+	for _, node := range all {
+		if node.MimeType() == google.DocMimeType && f.match(node.Name(), node.Num()) {
+			nodes = append(nodes, node)
+		}
+	}
+	return
+}
+
+// imageType returns the MIME type of an image from the extension of
+// its src, as given by transaction.Images.
+func imageType(src string) string {
+	switch strings.ToLower(path.Ext(src)) {
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	}
+	return ""
+}
+
+// Write writes book to w in format, one of Formats.
+func Write(w io.Writer, book *Book, format string) (err error) {
+	switch format {
+	case "pdf":
+		return WritePDF(w, book)
+	case "epub":
+		return WriteEPUB(w, book)
+	}
+	return fmt.Errorf("unknown export format: %q", format)
+}
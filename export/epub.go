@@ -0,0 +1,238 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/xml"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const epubCSS = `body { font-family: serif; line-height: 1.4; }
+h1, h2, h3, h4, h5, h6 { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td { border: 1px solid #888; padding: 0.2em 0.4em; vertical-align: top; }
+img { max-width: 100%; }
+.source { font-size: 0.8em; color: #555; }
+.cover { text-align: center; margin-top: 30%; }
+`
+
+var epubTemplates = template.Must(template.New("opf").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">{{.Id}}</dc:identifier>
+    <dc:title>{{.Book.Title}}</dc:title>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+    <item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+    {{- range .Files}}
+    <item id="{{.Id}}" href="{{.Href}}" media-type="{{.Type}}"/>
+    {{- end}}
+  </manifest>
+  <spine>
+    <itemref idref="cover"/>
+    <itemref idref="nav"/>
+    {{- range .Chapters}}
+    <itemref idref="{{.Id}}"/>
+    {{- end}}
+  </spine>
+</package>
+{{define "page"}}<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+<title>{{.Title}}</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+{{end}}
+{{define "cover"}}<div class="cover">
+<h1>{{.Title}}</h1>
+<p>{{.Subtitle}}</p>
+<p>{{.Created.Format "2 January 2006"}}</p>
+</div>{{end}}
+{{define "nav"}}<nav epub:type="toc" id="toc">
+<h1>Contents</h1>
+<ol>
+{{- range .}}
+<li><a href="{{.Href}}">{{.Title}}</a></li>
+{{- end}}
+</ol>
+</nav>{{end}}
+{{define "source"}}<p class="source"><a href="{{.URL}}">{{.Name}}</a></p>
+{{end}}`))
+
+type epubFile struct {
+	Id, Href, Type, Title string
+}
+
+// WriteEPUB writes book as an EPUB 3 file with a cover page, a table
+// of contents, and one XHTML file per chapter.  Images are included
+// in the file.
+func WriteEPUB(w io.Writer, book *Book) (err error) {
+	defer Return(&err)
+	zw := zip.NewWriter(w)
+
+	// the mimetype must come first, uncompressed
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	Ck(err)
+	_, err = f.Write([]byte("application/epub+zip"))
+	Ck(err)
+	put := func(name string, buf []byte) {
+		f, err := zw.Create(name)
+		Ck(err)
+		_, err = f.Write(buf)
+		Ck(err)
+	}
+	page := func(title string, body template.HTML) []byte {
+		var buf bytes.Buffer
+		err := epubTemplates.ExecuteTemplate(&buf, "page", struct {
+			Title string
+			Body  template.HTML
+		}{title, body})
+		Ck(err)
+		return buf.Bytes()
+	}
+	exec := func(name string, data interface{}) template.HTML {
+		var buf bytes.Buffer
+		err := epubTemplates.ExecuteTemplate(&buf, name, data)
+		Ck(err)
+		return template.HTML(buf.String())
+	}
+
+	put("META-INF/container.xml", []byte(epubContainer))
+	put("OEBPS/style.css", []byte(epubCSS))
+	put("OEBPS/cover.xhtml", page(book.Title, exec("cover", book)))
+
+	var files, chapters []epubFile
+	images := make(map[string]string)
+	addImage := func(src string) string {
+		if href, ok := images[src]; ok {
+			return href
+		}
+		ctype := imageType(src)
+		buf := book.Image(src)
+		if ctype == "" || buf == nil {
+			return ""
+		}
+		id := Spf("img%d", len(images)+1)
+		href := "images/" + id + src[strings.LastIndex(src, "."):]
+		put("OEBPS/"+href, buf)
+		files = append(files, epubFile{Id: id, Href: href, Type: ctype})
+		images[src] = href
+		return href
+	}
+	for i, c := range book.Chapters {
+		body, err := xhtmlBody(c.HTML, addImage)
+		Ck(err, c.Name)
+		ch := epubFile{
+			Id:    Spf("ch%d", i+1),
+			Href:  Spf("ch%d.xhtml", i+1),
+			Type:  "application/xhtml+xml",
+			Title: c.Title,
+		}
+		put("OEBPS/"+ch.Href, page(c.Title, exec("source", c)+template.HTML(body)))
+		files = append(files, ch)
+		chapters = append(chapters, ch)
+	}
+	put("OEBPS/nav.xhtml", page("Contents", exec("nav", chapters)))
+
+	var opf bytes.Buffer
+	err = epubTemplates.ExecuteTemplate(&opf, "opf", struct {
+		Id       string
+		Book     *Book
+		Modified string
+		Files    []epubFile
+		Chapters []epubFile
+	}{epubId(book), book, book.Created.UTC().Format(time.RFC3339), files, chapters})
+	Ck(err)
+	put("OEBPS/content.opf", opf.Bytes())
+
+	err = zw.Close()
+	Ck(err)
+	return
+}
+
+// epubId derives a stable identifier from the book's contents.
+func epubId(book *Book) string {
+	h := sha256.New()
+	for _, c := range book.Chapters {
+		h.Write([]byte(c.Name + "\n"))
+	}
+	return Spf("urn:docbot:%x", h.Sum(nil)[:16])
+}
+
+// xhtmlBody returns the body of a page rendered by google.HTML as
+// XHTML, with image sources replaced by image(src), or removed if
+// that returns "".
+func xhtmlBody(buf []byte, image func(src string) string) (out string, err error) {
+	defer Return(&err)
+	doc, err := html.Parse(bytes.NewReader(buf))
+	Ck(err)
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return
+	}
+	var imgs []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			imgs = append(imgs, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+	for _, n := range imgs {
+		href := image(attr(n, "src"))
+		if href == "" {
+			n.Parent.RemoveChild(n)
+			continue
+		}
+		for i := range n.Attr {
+			if n.Attr[i].Key == "src" {
+				n.Attr[i].Val = href
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		err = html.Render(&sb, c)
+		Ck(err)
+	}
+	out = sb.String()
+	// make sure the result is well-formed XML
+	d := xml.NewDecoder(strings.NewReader("<body>" + out + "</body>"))
+	for {
+		_, err = d.Token()
+		if err == io.EOF {
+			break
+		}
+		Ck(err)
+	}
+	return out, nil
+}
@@ -0,0 +1,193 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+const chapterHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mcp-17-nomcon-2026-tools</title>
+</head>
+<body>
+<h1>Tools &amp; toys</h1>
+<p>Some <strong>bold</strong> and <a href="https://example.com">a link</a><sup><a href="#fn-a" id="fnref-a">1</a></sup>.<br>Next line.</p>
+<ul>
+<li>one<ol>
+<li>one a</li>
+</ol>
+</li>
+<li>two</li>
+</ul>
+<table>
+<tr>
+<td>
+<p>Time</p>
+</td>
+<td>
+<p>Session</p>
+<ul>
+<li>speaker</li>
+</ul>
+</td>
+</tr>
+</table>
+<p>Photo: <img src="https://docs.example.com/images/doc1/kix.a.png" alt="photo"></p>
+<section>
+<hr>
+<ol>
+<li id="fn-a">A note. <a href="#fnref-a">&#8617;</a></li>
+</ol>
+</section>
+</body>
+</html>
+`
+
+func testBook() *Book {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{255, 0, 0, 255})
+	var pngbuf bytes.Buffer
+	png.Encode(&pngbuf, img)
+	return &Book{
+		Title:    "NOMCON 2026 proceedings",
+		Subtitle: "2 documents",
+		Created:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Chapters: []*Chapter{
+			{Name: "mcp-17-nomcon-2026-tools", Num: 17, Title: "Tools", URL: "https://docs.google.com/d/17", HTML: []byte(chapterHTML)},
+			{Name: "mcp-18-nomcon-2026-café", Num: 18, Title: "Café (and more)", URL: "https://docs.google.com/d/18", HTML: []byte(chapterHTML)},
+		},
+		Image: func(src string) []byte {
+			if strings.HasSuffix(src, "/kix.a.png") {
+				return pngbuf.Bytes()
+			}
+			return nil
+		},
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	blocks, err := parseBlocks([]byte(chapterHTML))
+	Tassert(t, err == nil, err)
+	var kinds []string
+	for _, b := range blocks {
+		kinds = append(kinds, strconv.Itoa(int(b.kind))+b.marker)
+	}
+	// heading, para, 3 items, table, para, image, rule, footnote
+	Tassert(t, strings.Join(kinds, " ") == "1 0 2• 21. 2• 5 0 4 3 21.", kinds)
+	Tassert(t, spansText(blocks[1].spans) == "Some bold and a link[1].\nNext line.", spansText(blocks[1].spans))
+	Tassert(t, blocks[1].spans[3].link == "https://example.com", blocks[1].spans)
+	Tassert(t, blocks[3].level == 1, blocks[3])
+	Tassert(t, spansText(blocks[5].rows[0][1]) == "Session\n• speaker", blocks[5].rows)
+	Tassert(t, spansText(blocks[9].spans) == "A note. ", blocks[9].spans)
+}
+
+func TestWrap(t *testing.T) {
+	lines := wrap([]span{{text: "aaa bbb "}, {text: "ccc", bold: true}, {text: "\nddd"}}, 40, 10)
+	var got []string
+	for _, l := range lines {
+		var ws []string
+		for _, w := range l {
+			ws = append(ws, string(w.text))
+		}
+		got = append(got, strings.Join(ws, "_"))
+	}
+	Tassert(t, strings.Join(got, "|") == "aaa_bbb|ccc|ddd", got)
+
+	// a word longer than the line is broken
+	lines = wrap([]span{{text: strings.Repeat("m", 20)}}, 50, 10)
+	Tassert(t, len(lines) == 4, lines)
+}
+
+func TestPDF(t *testing.T) {
+	var buf bytes.Buffer
+	err := WritePDF(&buf, testBook())
+	Tassert(t, err == nil, err)
+	out := buf.Bytes()
+	Tassert(t, bytes.HasPrefix(out, []byte("%PDF-1.4\n")), out[:20])
+	Tassert(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+
+	// every xref entry points at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	Tassert(t, m != nil)
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	Tassert(t, len(entries) > 10, len(entries))
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		Tassert(t, bytes.HasPrefix(out[off:], []byte(Spf("%d 0 obj\n", i+1))), i+1)
+	}
+
+	// cover, contents, and a page per chapter
+	Tassert(t, bytes.Contains(out, []byte("/Type /Pages /Kids")), "no page tree")
+	Tassert(t, regexp.MustCompile(`/Count 4 >>`).Match(out), "page count")
+	Tassert(t, bytes.Contains(out, []byte("/Subtype /Image /Width 4 /Height 3")), "no image")
+	Tassert(t, bytes.Contains(out, []byte("/URI (https://example.com)")), "no link")
+	Tassert(t, bytes.Contains(out, []byte("/Type /Outlines")), "no outline")
+}
+
+func TestEPUB(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteEPUB(&buf, testBook())
+	Tassert(t, err == nil, err)
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	Tassert(t, err == nil, err)
+	Tassert(t, zr.File[0].Name == "mimetype" && zr.File[0].Method == zip.Store, zr.File[0])
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		Tassert(t, err == nil, err)
+		b, err := ioutil.ReadAll(rc)
+		Tassert(t, err == nil, err)
+		files[f.Name] = string(b)
+	}
+	Tassert(t, files["mimetype"] == "application/epub+zip")
+	opf := files["OEBPS/content.opf"]
+	for _, s := range []string{`href="ch2.xhtml"`, `href="images/img1.png" media-type="image/png"`, `<itemref idref="ch1"/>`} {
+		Tassert(t, strings.Contains(opf, s), s, opf)
+	}
+	Tassert(t, len(files["OEBPS/images/img1.png"]) > 0)
+	Tassert(t, strings.Contains(files["OEBPS/nav.xhtml"], "Café (and more)"), files["OEBPS/nav.xhtml"])
+	Tassert(t, strings.Contains(files["OEBPS/ch1.xhtml"], `<img src="images/img1.png" alt="photo"/>`), files["OEBPS/ch1.xhtml"])
+
+	// every XML file is well-formed
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".xhtml") && !strings.HasSuffix(name, ".opf") && !strings.HasSuffix(name, ".xml") {
+			continue
+		}
+		d := xml.NewDecoder(strings.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			Tassert(t, err == nil, name, err)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := &Filter{Doctype: "nomcon", From: 10, To: 20}
+	Tassert(t, f.match("mcp-12-nomcon-2026-tools", 12))
+	Tassert(t, !f.match("mcp-9-nomcon-2026-tools", 9))
+	Tassert(t, !f.match("mcp-21-nomcon-2026-tools", 21))
+	Tassert(t, !f.match("mcp-12-why", 12))
+	Tassert(t, f.Filename("mcp", "pdf") == "mcp-nomcon-10-20.pdf", f.Filename("mcp", "pdf"))
+	f = &Filter{Tag: "Keynote Talks"}
+	Tassert(t, f.Filename("mcp", "epub") == "mcp-keynote-talks.epub", f.Filename("mcp", "epub"))
+}
@@ -0,0 +1,664 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// A4 in points, and the layout around the text block.
+const (
+	pageW     = 595.0
+	pageH     = 842.0
+	margin    = 56.0
+	textW     = pageW - 2*margin
+	top       = pageH - margin
+	bottom    = margin + 14
+	bodySize  = 11.0
+	smallSize = 9.0
+	leading   = 1.35
+	indent    = 18.0
+	cellPad   = 4.0
+)
+
+// The standard Type 1 fonts used, which PDF readers must provide, so
+// nothing is embedded.
+var pdfFonts = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier"}
+
+// Glyph widths of the printable ASCII characters, in thousandths of
+// the font size, from the Adobe font metrics.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding
+// has.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encode converts s to WinAnsiEncoding, replacing characters it
+// lacks with '?'.
+func encode(s string) []byte {
+	buf := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			buf = append(buf, byte(r))
+		case r == '\t':
+			buf = append(buf, ' ')
+		default:
+			b, ok := winAnsi[r]
+			if !ok {
+				b = '?'
+			}
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+// font returns the resource number of the font for s.
+func font(s span) int {
+	switch {
+	case s.code:
+		return 4
+	case s.bold && s.italic:
+		return 3
+	case s.italic:
+		return 2
+	case s.bold:
+		return 1
+	}
+	return 0
+}
+
+// textWidth returns the width of s in font f at size.
+func textWidth(s []byte, f int, size float64) float64 {
+	total := 0
+	for _, c := range s {
+		switch {
+		case f == 4:
+			total += 600
+		case c < 0x20 || c > 0x7e:
+			total += 556
+		case f == 1 || f == 3:
+			total += helveticaBoldWidths[c-0x20]
+		default:
+			total += helveticaWidths[c-0x20]
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// pdfString returns s as a PDF literal string in WinAnsiEncoding.
+func pdfString(s string) string {
+	return pdfBytes(encode(s))
+}
+
+// pdfBytes returns encoded text as a PDF literal string.
+func pdfBytes(buf []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, c := range buf {
+		switch c {
+		case '(', ')', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// pdfText returns s as a PDF text string for metadata and bookmarks,
+// which may use any Unicode characters.
+func pdfText(s string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		sb.WriteString(Spf("%04X", u))
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// word is a piece of a line of text.
+type word struct {
+	text  []byte
+	font  int
+	size  float64
+	width float64
+	link  string
+	// space is true if the word follows a space
+	space bool
+}
+
+// wrap breaks spans into lines no wider than width.
+func wrap(spans []span, width, size float64) (lines [][]word) {
+	var line []word
+	x := 0.0
+	space := false
+	flush := func() {
+		lines = append(lines, line)
+		line = nil
+		x = 0
+		space = false
+	}
+	for _, s := range spans {
+		f := font(s)
+		for i, para := range strings.Split(s.text, "\n") {
+			if i > 0 {
+				flush()
+			}
+			for j, field := range strings.Split(para, " ") {
+				if j > 0 {
+					space = true
+				}
+				if field == "" {
+					continue
+				}
+				w := word{text: encode(field), font: f, size: size, link: s.link}
+				spaceW := 0.0
+				if space && len(line) > 0 {
+					spaceW = textWidth([]byte(" "), f, size)
+				}
+				w.width = textWidth(w.text, f, size)
+				if x+spaceW+w.width > width && len(line) > 0 {
+					flush()
+					spaceW = 0
+				}
+				// break words longer than a line
+				for w.width > width && len(w.text) > 1 {
+					n := len(w.text) - 1
+					for n > 1 && textWidth(w.text[:n], f, size) > width {
+						n--
+					}
+					head := w
+					head.text = w.text[:n]
+					head.width = textWidth(head.text, f, size)
+					line = append(line, head)
+					flush()
+					w.text = w.text[n:]
+					w.width = textWidth(w.text, f, size)
+					w.space = false
+				}
+				w.space = spaceW > 0
+				line = append(line, w)
+				x += spaceW + w.width
+				space = false
+			}
+		}
+	}
+	if len(line) > 0 {
+		flush()
+	}
+	return
+}
+
+type pdfAnnot struct {
+	rect [4]float64
+	uri  string
+	// page is the target of an internal link when uri is ""
+	page int
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+	annots  []pdfAnnot
+	images  map[int]bool
+}
+
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+}
+
+// pdfDoc lays out pages and then writes them as a PDF file.
+type pdfDoc struct {
+	pages  []*pdfPage
+	images []*pdfImage
+	y      float64
+	// outline lists each chapter's title and first page
+	outline []outlineItem
+}
+
+type outlineItem struct {
+	title string
+	page  int
+}
+
+func (d *pdfDoc) page() *pdfPage {
+	return d.pages[len(d.pages)-1]
+}
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &pdfPage{images: make(map[int]bool)})
+	d.y = top
+}
+
+// need starts a new page unless h points of space are left.
+func (d *pdfDoc) need(h float64) {
+	if d.y-h < bottom {
+		d.newPage()
+	}
+}
+
+func (d *pdfDoc) op(format string, args ...interface{}) {
+	d.page().content.WriteString(Spf(format, args...))
+	d.page().content.WriteByte('\n')
+}
+
+// line draws a line of words with its left edge at x and baseline at
+// y.
+func (d *pdfDoc) line(ws []word, x, y float64) {
+	for _, w := range ws {
+		if w.space {
+			x += textWidth([]byte(" "), w.font, w.size)
+		}
+		d.op("BT /F%d %.1f Tf %.2f %.2f Td %s Tj ET", w.font+1, w.size, x, y, pdfBytes(w.text))
+		if w.link != "" {
+			d.page().annots = append(d.page().annots, pdfAnnot{
+				rect: [4]float64{x, y - w.size*0.2, x + w.width, y + w.size*0.8},
+				uri:  w.link,
+			})
+		}
+		x += w.width
+	}
+}
+
+// text lays out spans as a paragraph at x, width wide.
+func (d *pdfDoc) text(spans []span, x, width, size float64) {
+	lh := size * leading
+	for _, ws := range wrap(spans, width, size) {
+		d.need(lh)
+		d.y -= lh
+		d.line(ws, x, d.y+lh-size)
+	}
+}
+
+var headingSizes = map[int]float64{1: 18, 2: 15, 3: 13}
+
+func (d *pdfDoc) block(b block, image func(src string) []byte) {
+	switch b.kind {
+	case bHeading:
+		size, ok := headingSizes[b.level]
+		if !ok {
+			size = 12
+		}
+		// keep the heading with a few lines of what follows
+		d.need(size*leading + 3*bodySize*leading + 10)
+		d.y -= 10
+		d.text(b.spans, margin, textW, size)
+		d.y -= 4
+	case bPara:
+		d.text(b.spans, margin, textW, bodySize)
+		d.y -= 6
+	case bItem:
+		x := margin + indent*float64(b.level+1)
+		d.need(bodySize * leading)
+		marker := []word{{text: encode(b.marker), size: bodySize}}
+		marker[0].width = textWidth(marker[0].text, 0, bodySize)
+		d.line(marker, x-marker[0].width-5, d.y-bodySize)
+		if len(b.spans) == 0 {
+			d.y -= bodySize * leading
+		}
+		d.text(b.spans, x, textW-(x-margin), bodySize)
+		d.y -= 2
+	case bRule:
+		d.need(12)
+		d.y -= 6
+		d.op("0.5 w %.2f %.2f m %.2f %.2f l S", margin, d.y, pageW-margin, d.y)
+		d.y -= 6
+	case bImage:
+		d.image(image(b.src))
+	case bTable:
+		d.table(b.rows)
+		d.y -= 6
+	}
+}
+
+func (d *pdfDoc) table(rows [][][]span) {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	if cols == 0 {
+		return
+	}
+	colW := textW / float64(cols)
+	lh := bodySize * leading
+	for _, row := range rows {
+		cells := make([][][]word, len(row))
+		n := 1
+		for i, c := range row {
+			cells[i] = wrap(c, colW-2*cellPad, bodySize)
+			if len(cells[i]) > n {
+				n = len(cells[i])
+			}
+		}
+		// rows taller than a page are cut off
+		maxLines := int((top - bottom - 2*cellPad) / lh)
+		if n > maxLines {
+			n = maxLines
+		}
+		h := float64(n)*lh + 2*cellPad
+		d.need(h)
+		for i, lines := range cells {
+			x := margin + float64(i)*colW
+			for j, ws := range lines {
+				if j >= n {
+					break
+				}
+				d.line(ws, x+cellPad, d.y-cellPad-float64(j)*lh-bodySize)
+			}
+		}
+		for i := 0; i < cols; i++ {
+			d.op("0.5 w %.2f %.2f %.2f %.2f re S", margin+float64(i)*colW, d.y-h, colW, h)
+		}
+		d.y -= h
+	}
+}
+
+// image places an image at the original size, at 96 dpi, scaled
+// down to fit.
+func (d *pdfDoc) image(buf []byte) {
+	img := decodeImage(buf)
+	if img == nil {
+		return
+	}
+	w := float64(img.width) * 0.75
+	h := float64(img.height) * 0.75
+	maxH := (top - bottom) * 0.6
+	if w > textW {
+		h *= textW / w
+		w = textW
+	}
+	if h > maxH {
+		w *= maxH / h
+		h = maxH
+	}
+	d.need(h + 6)
+	d.images = append(d.images, img)
+	n := len(d.images)
+	d.page().images[n] = true
+	d.y -= h + 3
+	d.op("q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q", w, h, margin, d.y, n)
+	d.y -= 3
+}
+
+// decodeImage prepares a JPEG, PNG or GIF for embedding, or returns
+// nil if buf isn't one.  JPEGs are embedded as they are; others are
+// flattened onto white and compressed.
+func decodeImage(buf []byte) *pdfImage {
+	if len(buf) == 0 {
+		return nil
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return nil
+	}
+	img := &pdfImage{width: cfg.Width, height: cfg.Height}
+	if format == "jpeg" {
+		switch cfg.ColorModel {
+		case color.GrayModel:
+			img.colorSpace = "/DeviceGray"
+		case color.CMYKModel:
+			img.colorSpace = "/DeviceCMYK"
+		default:
+			img.colorSpace = "/DeviceRGB"
+		}
+		img.filter = "/DCTDecode"
+		img.data = buf
+		return img
+	}
+	m, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil
+	}
+	b := m.Bounds()
+	raw := make([]byte, 0, b.Dx()*b.Dy()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := m.At(x, y).RGBA()
+			// composite onto white
+			white := 0xffff - a
+			raw = append(raw, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+	}
+	img.colorSpace = "/DeviceRGB"
+	img.filter = "/FlateDecode"
+	img.data = deflate(raw)
+	return img
+}
+
+func deflate(buf []byte) []byte {
+	var out bytes.Buffer
+	zw := zlib.NewWriter(&out)
+	zw.Write(buf)
+	zw.Close()
+	return out.Bytes()
+}
+
+// centered draws a line of text centered on the page.
+func (d *pdfDoc) centered(s string, f int, size float64) {
+	for _, ws := range wrap([]span{{text: s, bold: f == 1}}, textW, size) {
+		w := 0.0
+		for i, wd := range ws {
+			w += wd.width
+			if i > 0 && wd.space {
+				w += textWidth([]byte(" "), f, size)
+			}
+		}
+		d.y -= size * leading
+		d.line(ws, (pageW-w)/2, d.y)
+	}
+}
+
+// tocLines is the number of contents entries that fit on a page.
+var tocLines = int(math.Floor((top - bottom - 40) / (bodySize * leading)))
+
+// WritePDF writes book as a PDF with a cover page, a table of
+// contents, and each chapter starting on a new page.
+func WritePDF(w io.Writer, book *Book) (err error) {
+	defer Return(&err)
+	d := &pdfDoc{}
+
+	// chapters first, so the contents can give page numbers
+	tocPages := (len(book.Chapters) + tocLines - 1) / tocLines
+	offset := 1 + tocPages
+	for _, c := range book.Chapters {
+		blocks, err := parseBlocks(c.HTML)
+		Ck(err, c.Name)
+		d.newPage()
+		d.outline = append(d.outline, outlineItem{title: c.Title, page: len(d.pages) - 1 + offset})
+		d.text([]span{{text: c.Name, link: c.URL}}, margin, textW, smallSize)
+		d.y -= 6
+		for _, b := range blocks {
+			d.block(b, book.Image)
+		}
+	}
+	body := d.pages
+	d.pages = nil
+
+	// cover
+	d.newPage()
+	d.y = pageH * 0.65
+	d.centered(book.Title, 1, 26)
+	d.y -= 12
+	d.centered(book.Subtitle, 0, 14)
+	d.y -= 24
+	d.centered(book.Created.Format("2 January 2006"), 0, bodySize)
+
+	// contents
+	for i, item := range d.outline {
+		if i%tocLines == 0 {
+			d.newPage()
+			d.text([]span{{text: "Contents", bold: true}}, margin, textW, 18)
+			d.y -= 14
+		}
+		d.y -= bodySize * leading
+		num := encode(Spf("%d", item.page+1))
+		numW := textWidth(num, 0, bodySize)
+		title := encode(item.title)
+		for len(title) > 1 && textWidth(title, 0, bodySize) > textW-numW-20 {
+			title = title[:len(title)-1]
+		}
+		d.line([]word{{text: title, size: bodySize, width: textWidth(title, 0, bodySize)}}, margin, d.y)
+		d.line([]word{{text: num, size: bodySize, width: numW}}, pageW-margin-numW, d.y)
+		d.page().annots = append(d.page().annots, pdfAnnot{
+			rect: [4]float64{margin, d.y - 3, pageW - margin, d.y + bodySize},
+			page: item.page,
+		})
+	}
+	d.pages = append(d.pages, body...)
+
+	// page numbers
+	for i, p := range d.pages[1:] {
+		num := encode(Spf("%d", i+2))
+		p.content.WriteString(Spf("BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n",
+			smallSize, (pageW-textWidth(num, 0, smallSize))/2, margin/2, pdfBytes(num)))
+	}
+
+	_, err = w.Write(d.bytes(book))
+	Ck(err)
+	return
+}
+
+// bytes serializes the laid-out pages.
+func (d *pdfDoc) bytes(book *Book) []byte {
+	var objs []string
+	add := func(s string) int {
+		objs = append(objs, s)
+		return len(objs)
+	}
+	stream := func(dict string, data []byte) string {
+		return Spf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+
+	// fixed objects: catalog 1, page tree 2, fonts 3..7
+	add("")
+	add("")
+	fontBase := len(objs) + 1
+	for _, f := range pdfFonts {
+		add(Spf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f))
+	}
+	imageBase := len(objs) + 1
+	for _, img := range d.images {
+		add(stream(Spf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s",
+			img.width, img.height, img.colorSpace, img.filter), img.data))
+	}
+
+	// pages and their contents are numbered in pairs
+	pageBase := len(objs) + 1
+	pageRef := func(i int) string { return Spf("%d 0 R", pageBase+2*i) }
+	var fonts strings.Builder
+	for i := range pdfFonts {
+		fonts.WriteString(Spf("/F%d %d 0 R ", i+1, fontBase+i))
+	}
+	var kids []string
+	for i, p := range d.pages {
+		var res strings.Builder
+		res.WriteString(Spf("/Font << %s>>", fonts.String()))
+		if len(p.images) > 0 {
+			res.WriteString(" /XObject <<")
+			for n := 1; n <= len(d.images); n++ {
+				if p.images[n] {
+					res.WriteString(Spf(" /Im%d %d 0 R", n, imageBase+n-1))
+				}
+			}
+			res.WriteString(" >>")
+		}
+		var annots strings.Builder
+		for _, a := range p.annots {
+			rect := Spf("[%.2f %.2f %.2f %.2f]", a.rect[0], a.rect[1], a.rect[2], a.rect[3])
+			if a.uri != "" {
+				annots.WriteString(Spf(" << /Type /Annot /Subtype /Link /Rect %s /Border [0 0 0] /A << /S /URI /URI %s >> >>",
+					rect, pdfString(a.uri)))
+			} else {
+				annots.WriteString(Spf(" << /Type /Annot /Subtype /Link /Rect %s /Border [0 0 0] /Dest [%s /Fit] >>",
+					rect, pageRef(a.page)))
+			}
+		}
+		dict := Spf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << %s >> /Contents %d 0 R",
+			pageW, pageH, res.String(), pageBase+2*i+1)
+		if annots.Len() > 0 {
+			dict += Spf(" /Annots [%s ]", annots.String())
+		}
+		add(dict + " >>")
+		add(stream("/Filter /FlateDecode", deflate(p.content.Bytes())))
+		kids = append(kids, pageRef(i))
+	}
+	objs[1] = Spf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+
+	// bookmarks
+	catalog := "<< /Type /Catalog /Pages 2 0 R"
+	if len(d.outline) > 0 {
+		root := len(objs) + 1
+		first := root + 1
+		last := root + len(d.outline)
+		add(Spf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>", first, last, len(d.outline)))
+		for i, item := range d.outline {
+			n := first + i
+			dict := Spf("<< /Title %s /Parent %d 0 R /Dest [%s /Fit]", pdfText(item.title), root, pageRef(item.page))
+			if n > first {
+				dict += Spf(" /Prev %d 0 R", n-1)
+			}
+			if n < last {
+				dict += Spf(" /Next %d 0 R", n+1)
+			}
+			add(dict + " >>")
+		}
+		catalog += Spf(" /Outlines %d 0 R /PageMode /UseOutlines", root)
+	}
+	objs[0] = catalog + " >>"
+	info := add(Spf("<< /Title %s /Producer (docbot) /CreationDate (D:%s) >>",
+		pdfText(book.Title), book.Created.UTC().Format("20060102150405Z")))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = out.Len()
+		out.WriteString(Spf("%d 0 obj\n%s\nendobj\n", i+1, o))
+	}
+	xref := out.Len()
+	out.WriteString(Spf("xref\n0 %d\n0000000000 65535 f \n", len(objs)+1))
+	for _, off := range offsets {
+		out.WriteString(Spf("%010d 00000 n \n", off))
+	}
+	out.WriteString(Spf("trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objs)+1, info, xref))
+	return out.Bytes()
+}
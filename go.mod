@@ -5,11 +5,14 @@ go 1.17
 // replace github.com/stevegt/goadapt => /home/stevegt/lab/goadapt
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
 	github.com/sergi/go-diff v1.2.0
 	github.com/stevegt/envi v0.2.0
 	github.com/stevegt/goadapt v0.3.0
+	golang.org/x/net v0.0.0-20220517181318-183a9ca12b87
 	google.golang.org/api v0.80.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -18,7 +21,6 @@ require (
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/googleapis/gax-go/v2 v2.4.0 // indirect
 	go.opencensus.io v0.23.0 // indirect
-	golang.org/x/net v0.0.0-20220517181318-183a9ca12b87 // indirect
 	golang.org/x/oauth2 v0.0.0-20220411215720-9780585627b5 // indirect
 	golang.org/x/sys v0.0.0-20220519141025-dcacdad47464 // indirect
 	golang.org/x/text v0.3.7 // indirect
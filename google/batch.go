@@ -5,20 +5,66 @@ import (
 	"google.golang.org/api/docs/v1"
 )
 
+// MaxBatchRequests is the most requests Run sends in one
+// BatchUpdate call; larger batches are split.
+var MaxBatchRequests = 500
+
 type batch struct {
 	gf   *Folder
 	reqs []*docs.Request
+	// keys[i] names what reqs[i] is for in the result, e.g. the
+	// token of a ReplaceAllText request
+	keys []string
+	// revision, if set, is the document revision the requests were
+	// built against
+	revision string
+	// counts are replacement counts known before running, from fills
+	counts map[string]int
+}
+
+// BatchResult is what a batch did.
+type BatchResult struct {
+	// Replies are the responses to each request, in order.
+	Replies []*docs.Response
+	// Counts is the number of replacements made for each token, by
+	// ReplaceAllTextRequest and FillRequest.
+	Counts map[string]int
+	// NamedRanges maps the names given to NamedRangeRequest to the
+	// IDs of the ranges created.
+	NamedRanges map[string]string
+	// Images are the object IDs of the images inserted by
+	// InsertImageRequest, in order.
+	Images []string
+	// Revision is the document's revision after the batch.
+	Revision string
 }
 
 func (gf *Folder) BatchStart() (b *batch) {
-	b = &batch{gf: gf}
+	b = &batch{gf: gf, counts: make(map[string]int)}
 	// b.reqs = make([]*docs.Request, 0)
 	return
 }
 
+func (b *batch) add(key string, req *docs.Request) {
+	b.reqs = append(b.reqs, req)
+	b.keys = append(b.keys, key)
+}
+
+// Revision makes the batch fail, rather than apply, if the document
+// has changed since revision rev, e.g. the RevisionId of the
+// docs.Document the request indexes were computed from.
+func (b *batch) Revision(rev string) {
+	b.revision = rev
+}
+
+// Len returns the number of requests in the batch.
+func (b *batch) Len() int {
+	return len(b.reqs)
+}
+
 func (b *batch) ReplaceAllTextRequest(parms map[string]string) {
 	for k, v := range parms {
-		b.reqs = append(b.reqs, &docs.Request{
+		b.add(k, &docs.Request{
 			ReplaceAllText: &docs.ReplaceAllTextRequest{
 				ContainsText: &docs.SubstringMatchCriteria{
 					MatchCase: true,
@@ -30,6 +76,111 @@ func (b *batch) ReplaceAllTextRequest(parms map[string]string) {
 	}
 }
 
+// FillRequest adds the requests that apply fills to doc; see
+// FillRequests.  The batch is tied to doc's revision, since the
+// requests use its indexes.
+func (b *batch) FillRequest(doc *docs.Document, fills []Fill) (res *FillResult) {
+	reqs, res := FillRequests(doc, fills)
+	b.docRequests(doc, reqs, res)
+	return
+}
+
+// docRequests adds reqs, built from doc's indexes, and their counts.
+func (b *batch) docRequests(doc *docs.Document, reqs []*docs.Request, res *FillResult) {
+	for _, req := range reqs {
+		b.add("", req)
+	}
+	for tok, n := range res.Counts {
+		b.counts[tok] += n
+	}
+	if b.revision == "" {
+		b.revision = doc.RevisionId
+	}
+}
+
+// InsertTextRequest inserts txt at index.  Index 1 is the start of
+// the document body.
+func (b *batch) InsertTextRequest(index int64, txt string) {
+	b.add("", &docs.Request{
+		InsertText: &docs.InsertTextRequest{
+			Location: &docs.Location{Index: index},
+			Text:     txt,
+		},
+	})
+}
+
+// DeleteRangeRequest deletes the content at r.
+func (b *batch) DeleteRangeRequest(r TextRange) {
+	b.add("", &docs.Request{
+		DeleteContentRange: &docs.DeleteContentRangeRequest{
+			Range: r.docsRange(),
+		},
+	})
+}
+
+// InsertTableRequest inserts an empty table of rows by cols at index.
+// The table starts on a new paragraph.
+func (b *batch) InsertTableRequest(index, rows, cols int64) {
+	b.add("", &docs.Request{
+		InsertTable: &docs.InsertTableRequest{
+			Location: &docs.Location{Index: index},
+			Rows:     rows,
+			Columns:  cols,
+		},
+	})
+}
+
+// InsertImageRequest inserts the image at url, which must be publicly
+// readable, at index.  If width and height, in points, are not zero
+// the image is scaled to fit them.
+func (b *batch) InsertImageRequest(index int64, url string, width, height float64) {
+	req := &docs.InsertInlineImageRequest{
+		Location: &docs.Location{Index: index},
+		Uri:      url,
+	}
+	if width > 0 && height > 0 {
+		req.ObjectSize = &docs.Size{
+			Width:  &docs.Dimension{Magnitude: width, Unit: "PT"},
+			Height: &docs.Dimension{Magnitude: height, Unit: "PT"},
+		}
+	}
+	b.add("", &docs.Request{InsertInlineImage: req})
+}
+
+// NamedRangeRequest names the content at r.  The range ID is returned
+// in BatchResult.NamedRanges.
+func (b *batch) NamedRangeRequest(name string, r TextRange) {
+	b.add(name, &docs.Request{
+		CreateNamedRange: &docs.CreateNamedRangeRequest{
+			Name:  name,
+			Range: r.docsRange(),
+		},
+	})
+}
+
+// ParagraphStyleRequest sets the fields of style listed in fields on
+// the paragraphs overlapping r.
+func (b *batch) ParagraphStyleRequest(r TextRange, style *docs.ParagraphStyle, fields string) {
+	b.add("", &docs.Request{
+		UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+			Range:          r.docsRange(),
+			ParagraphStyle: style,
+			Fields:         fields,
+		},
+	})
+}
+
+// DocumentStyleRequest sets the fields of style listed in fields,
+// e.g. "marginTop,marginBottom".
+func (b *batch) DocumentStyleRequest(style *docs.DocumentStyle, fields string) {
+	b.add("", &docs.Request{
+		UpdateDocumentStyle: &docs.UpdateDocumentStyleRequest{
+			DocumentStyle: style,
+			Fields:        fields,
+		},
+	})
+}
+
 func (b *batch) UpdateLinkRequest(el *docs.ParagraphElement, url string) {
 	req := &docs.Request{
 		UpdateTextStyle: &docs.UpdateTextStyleRequest{
@@ -45,13 +196,78 @@ func (b *batch) UpdateLinkRequest(el *docs.ParagraphElement, url string) {
 			},
 		},
 	}
-	b.reqs = append(b.reqs, req)
+	b.add("", req)
 	return
 }
 
-func (b *batch) Run(node *Node) (res *docs.BatchUpdateDocumentResponse, err error) {
-	update := &docs.BatchUpdateDocumentRequest{Requests: b.reqs}
-	res, err = b.gf.docs.Documents.BatchUpdate(node.id, update).Do()
+// Run sends the batch.  Batches of more than MaxBatchRequests are
+// sent in parts, each tied to the revision the previous part left, so
+// a concurrent edit stops the run; parts already sent stay applied.
+func (b *batch) Run(node *Node) (res *BatchResult, err error) {
+	defer Return(&err)
+	err = b.gf.guard(node.name)
 	Ck(err)
+	res = b.newResult()
+	for _, part := range b.parts() {
+		update := &docs.BatchUpdateDocumentRequest{Requests: b.reqs[part[0]:part[1]]}
+		if res.Revision != "" {
+			update.WriteControl = &docs.WriteControl{RequiredRevisionId: res.Revision}
+		}
+		resp, err := b.gf.docs.Documents.BatchUpdate(node.id, update).Do()
+		Ck(err, node.name)
+		b.collect(res, part[0], resp)
+	}
+	return
+}
+
+func (b *batch) newResult() (res *BatchResult) {
+	res = &BatchResult{
+		Counts:      make(map[string]int),
+		NamedRanges: make(map[string]string),
+		Revision:    b.revision,
+	}
+	for tok, n := range b.counts {
+		res.Counts[tok] = n
+	}
+	return
+}
+
+// parts returns the [start, end) bounds of the requests to send in
+// each BatchUpdate call.
+func (b *batch) parts() (parts [][2]int) {
+	for i := 0; i < len(b.reqs); i += MaxBatchRequests {
+		end := i + MaxBatchRequests
+		if end > len(b.reqs) {
+			end = len(b.reqs)
+		}
+		parts = append(parts, [2]int{i, end})
+	}
 	return
 }
+
+// collect adds resp, the response to the requests starting at start,
+// to res.
+func (b *batch) collect(res *BatchResult, start int, resp *docs.BatchUpdateDocumentResponse) {
+	for i, reply := range resp.Replies {
+		res.Replies = append(res.Replies, reply)
+		if reply == nil || start+i >= len(b.keys) {
+			continue
+		}
+		key := b.keys[start+i]
+		switch {
+		case reply.ReplaceAllText != nil:
+			res.Counts[key] += int(reply.ReplaceAllText.OccurrencesChanged)
+		case reply.CreateNamedRange != nil:
+			res.NamedRanges[key] = reply.CreateNamedRange.NamedRangeId
+		case reply.InsertInlineImage != nil:
+			res.Images = append(res.Images, reply.InsertInlineImage.ObjectId)
+		}
+	}
+	if resp.WriteControl != nil {
+		res.Revision = resp.WriteControl.RequiredRevisionId
+	}
+}
+
+func (r TextRange) docsRange() *docs.Range {
+	return &docs.Range{SegmentId: r.SegmentId, StartIndex: r.StartIndex, EndIndex: r.EndIndex}
+}
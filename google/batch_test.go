@@ -0,0 +1,46 @@
+package google
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+func TestBatchParts(t *testing.T) {
+	defer func(n int) { MaxBatchRequests = n }(MaxBatchRequests)
+	MaxBatchRequests = 2
+	b := (&Folder{}).BatchStart()
+	for i := 0; i < 5; i++ {
+		b.InsertTextRequest(1, "x")
+	}
+	parts := b.parts()
+	Tassert(t, len(parts) == 3 && parts[2] == [2]int{4, 5}, parts)
+}
+
+func TestBatchResult(t *testing.T) {
+	doc := textDoc()
+	doc.RevisionId = "rev1"
+	b := (&Folder{}).BatchStart()
+	b.ReplaceAllTextRequest(map[string]string{"{{TITLE}}": "Tools"})
+	b.NamedRangeRequest("docbot.TITLE", TextRange{StartIndex: 1, EndIndex: 6})
+	b.InsertImageRequest(1, "https://example.com/a.png", 72, 36)
+	res := b.FillRequest(doc, []Fill{{Token: "{{NAME}}", Text: "mcp-17"}})
+	Tassert(t, res.Counts["{{NAME}}"] == 2, res)
+	Tassert(t, b.revision == "rev1", b.revision)
+	Tassert(t, b.reqs[2].InsertInlineImage.ObjectSize.Width.Unit == "PT", b.reqs[2])
+
+	br := b.newResult()
+	b.collect(br, 0, &docs.BatchUpdateDocumentResponse{
+		Replies: []*docs.Response{
+			{ReplaceAllText: &docs.ReplaceAllTextResponse{OccurrencesChanged: 3}},
+			{CreateNamedRange: &docs.CreateNamedRangeResponse{NamedRangeId: "kix.r1"}},
+			{InsertInlineImage: &docs.InsertInlineImageResponse{ObjectId: "kix.i1"}},
+		},
+		WriteControl: &docs.WriteControl{RequiredRevisionId: "rev2"},
+	})
+	Tassert(t, br.Counts["{{TITLE}}"] == 3 && br.Counts["{{NAME}}"] == 2, br.Counts)
+	Tassert(t, br.NamedRanges["docbot.TITLE"] == "kix.r1", br.NamedRanges)
+	Tassert(t, len(br.Images) == 1 && br.Images[0] == "kix.i1", br.Images)
+	Tassert(t, br.Revision == "rev2", br.Revision)
+}
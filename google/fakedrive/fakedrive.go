@@ -0,0 +1,445 @@
+// Package fakedrive is an in-memory stand-in for the parts of the
+// Drive v2 and Docs v1 APIs that docbot uses, for tests.  Documents
+// are stored as given; batch updates are recorded but not applied.
+package fakedrive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	"google.golang.org/api/docs/v1"
+	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/option"
+)
+
+// Server serves the fake APIs.  Both services share one endpoint,
+// since their paths don't overlap.
+type Server struct {
+	*httptest.Server
+	// Fail, if not nil, is called with each request; if it returns
+	// true the request fails with a 400 error.
+	Fail func(r *http.Request) bool
+
+	mu      sync.Mutex
+	files   []*drive.File
+	docs    map[string]*docs.Document
+	updates map[string][]*docs.Request
+	seq     int
+}
+
+// epoch is the creation time of the first file; each later file is a
+// minute younger, so creation order is stable.
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// New starts a server.  Call Close when done.
+func New() (s *Server) {
+	s = &Server{
+		docs:    make(map[string]*docs.Document),
+		updates: make(map[string][]*docs.Request),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return
+}
+
+// Options returns the client options that point the Drive and Docs
+// services at s.
+func (s *Server) Options() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.URL + "/"),
+		option.WithHTTPClient(s.Client()),
+	}
+}
+
+// AddFolder adds a folder named title with the given ID.
+func (s *Server) AddFolder(id, title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(&drive.File{Id: id, Title: title, MimeType: google.FolderMimeType})
+}
+
+// AddDoc adds a Google Doc named title to folder parent, with content
+// doc, which may be nil, and returns the new file.
+func (s *Server) AddDoc(parent, title string, doc *docs.Document) *drive.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.add(&drive.File{
+		Title:    title,
+		MimeType: google.DocMimeType,
+		Parents:  []*drive.ParentReference{{Id: parent}},
+	})
+	if doc == nil {
+		doc = Doc()
+	}
+	s.docs[f.Id] = cloneDoc(doc)
+	return cloneFile(f)
+}
+
+// SetProperty sets the public custom property key of file id to
+// value, or removes it if value is "".
+func (s *Server) SetProperty(id, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.get(id); f != nil {
+		setProperty(f, &drive.Property{Key: key, Value: value, Visibility: "PUBLIC"})
+	}
+}
+
+// Files returns the untrashed files in folder parent, oldest first.
+func (s *Server) Files(parent string) (files []*drive.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.files {
+		if !f.Labels.Trashed && hasParent(f, parent) {
+			files = append(files, cloneFile(f))
+		}
+	}
+	return
+}
+
+// Titles returns the titles of Files(parent).
+func (s *Server) Titles(parent string) (titles []string) {
+	for _, f := range s.Files(parent) {
+		titles = append(titles, f.Title)
+	}
+	return
+}
+
+// Updates returns the batch update requests sent for document id.
+func (s *Server) Updates(id string) []*docs.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updates[id]
+}
+
+// Doc returns a document whose body is a paragraph for each line.
+func Doc(lines ...string) (doc *docs.Document) {
+	doc = &docs.Document{Body: &docs.Body{}, RevisionId: "1"}
+	index := int64(1)
+	for _, line := range lines {
+		txt := line + "\n"
+		n := int64(len([]rune(txt)))
+		doc.Body.Content = append(doc.Body.Content, &docs.StructuralElement{
+			StartIndex: index,
+			EndIndex:   index + n,
+			Paragraph: &docs.Paragraph{
+				Elements: []*docs.ParagraphElement{{
+					StartIndex: index,
+					EndIndex:   index + n,
+					TextRun:    &docs.TextRun{Content: txt},
+				}},
+			},
+		})
+		index += n
+	}
+	return
+}
+
+// add stores f with a new ID, if it has none, and creation time.
+// Caller must hold s.mu.
+func (s *Server) add(f *drive.File) *drive.File {
+	s.seq++
+	if f.Id == "" {
+		f.Id = fmt.Sprintf("file%d", s.seq)
+	}
+	created := epoch.Add(time.Duration(s.seq) * time.Minute).Format(time.RFC3339)
+	f.CreatedDate = created
+	f.ModifiedDate = created
+	f.AlternateLink = "https://docs.example.com/" + f.Id
+	if f.Labels == nil {
+		f.Labels = &drive.FileLabels{}
+	}
+	s.files = append(s.files, f)
+	return f
+}
+
+// get returns the file with the given ID, or nil.  Caller must hold
+// s.mu.
+func (s *Server) get(id string) *drive.File {
+	for _, f := range s.files {
+		if f.Id == id {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Fail != nil && s.Fail(r) {
+		fail(w, http.StatusBadRequest, "injected failure")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for i, p := range path {
+		path[i], _ = url.PathUnescape(p)
+	}
+	switch {
+	case path[0] == "files":
+		s.serveFiles(w, r, path[1:])
+	case len(path) == 3 && path[0] == "v1" && path[1] == "documents":
+		s.serveDocs(w, r, path[2])
+	default:
+		fail(w, http.StatusNotFound, "no such method: "+r.URL.Path)
+	}
+}
+
+func (s *Server) serveFiles(w http.ResponseWriter, r *http.Request, path []string) {
+	if len(path) == 0 {
+		if r.Method != http.MethodGet {
+			fail(w, http.StatusNotImplemented, "not implemented: "+r.Method+" files")
+			return
+		}
+		s.list(w, r.URL.Query().Get("q"))
+		return
+	}
+	f := s.get(path[0])
+	if f == nil {
+		fail(w, http.StatusNotFound, "file not found: "+path[0])
+		return
+	}
+	method := r.Method
+	if len(path) > 1 {
+		method += " " + path[1]
+	}
+	switch method {
+	case "GET":
+		reply(w, f)
+	case "PATCH":
+		var patch drive.File
+		if !decode(w, r, &patch) {
+			return
+		}
+		if patch.Title != "" {
+			f.Title = patch.Title
+		}
+		q := r.URL.Query()
+		for _, id := range split(q.Get("removeParents")) {
+			var parents []*drive.ParentReference
+			for _, p := range f.Parents {
+				if p.Id != id {
+					parents = append(parents, p)
+				}
+			}
+			f.Parents = parents
+		}
+		for _, id := range split(q.Get("addParents")) {
+			if !hasParent(f, id) {
+				f.Parents = append(f.Parents, &drive.ParentReference{Id: id})
+			}
+		}
+		reply(w, f)
+	case "DELETE":
+		for i, g := range s.files {
+			if g == f {
+				s.files = append(s.files[:i], s.files[i+1:]...)
+				break
+			}
+		}
+		delete(s.docs, f.Id)
+		w.WriteHeader(http.StatusNoContent)
+	case "POST copy":
+		var meta drive.File
+		if !decode(w, r, &meta) {
+			return
+		}
+		c := cloneFile(f)
+		c.Id = ""
+		c.Properties = nil
+		c.Labels = nil
+		if meta.Title != "" {
+			c.Title = meta.Title
+		}
+		if meta.Parents != nil {
+			c.Parents = meta.Parents
+		}
+		c = s.add(c)
+		if doc, ok := s.docs[f.Id]; ok {
+			s.docs[c.Id] = cloneDoc(doc)
+			s.docs[c.Id].DocumentId = c.Id
+		}
+		reply(w, c)
+	case "POST trash":
+		f.Labels.Trashed = true
+		reply(w, f)
+	case "POST untrash":
+		f.Labels.Trashed = false
+		reply(w, f)
+	case "POST permissions":
+		var p drive.Permission
+		if !decode(w, r, &p) {
+			return
+		}
+		if p.Id == "" {
+			p.Id = p.Type
+		}
+		reply(w, &p)
+	case "GET permissions":
+		reply(w, &drive.PermissionList{})
+	case "POST properties":
+		var p drive.Property
+		if !decode(w, r, &p) {
+			return
+		}
+		setProperty(f, &p)
+		reply(w, &p)
+	case "DELETE properties":
+		if len(path) < 3 {
+			fail(w, http.StatusBadRequest, "no property key")
+			return
+		}
+		setProperty(f, &drive.Property{Key: path[2]})
+		w.WriteHeader(http.StatusNoContent)
+	case "GET revisions":
+		reply(w, &drive.RevisionList{Items: []*drive.Revision{{Id: "1", ModifiedDate: f.ModifiedDate}}})
+	default:
+		fail(w, http.StatusNotImplemented, "not implemented: "+method)
+	}
+}
+
+// list replies with the files matching query q.
+func (s *Server) list(w http.ResponseWriter, q string) {
+	match, err := parseQuery(q)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	res := &drive.FileList{}
+	for _, f := range s.files {
+		if match(s.fields(f)) {
+			res.Items = append(res.Items, f)
+		}
+	}
+	reply(w, res)
+}
+
+// fields returns the values of f's searchable fields.
+func (s *Server) fields(f *drive.File) map[string][]string {
+	var parents []string
+	for _, p := range f.Parents {
+		parents = append(parents, p.Id)
+	}
+	full := f.Title
+	if doc, ok := s.docs[f.Id]; ok {
+		full += "\n" + google.Text(doc)
+	}
+	return map[string][]string{
+		"title":    {f.Title},
+		"mimeType": {f.MimeType},
+		"trashed":  {fmt.Sprint(f.Labels.Trashed)},
+		"parents":  parents,
+		"fullText": {full},
+	}
+}
+
+func (s *Server) serveDocs(w http.ResponseWriter, r *http.Request, id string) {
+	if strings.HasSuffix(id, ":batchUpdate") {
+		id = strings.TrimSuffix(id, ":batchUpdate")
+		doc, ok := s.docs[id]
+		if !ok || r.Method != http.MethodPost {
+			fail(w, http.StatusNotFound, "document not found: "+id)
+			return
+		}
+		var req docs.BatchUpdateDocumentRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		s.updates[id] = append(s.updates[id], req.Requests...)
+		reply(w, &docs.BatchUpdateDocumentResponse{
+			DocumentId:   id,
+			Replies:      make([]*docs.Response, len(req.Requests)),
+			WriteControl: &docs.WriteControl{RequiredRevisionId: doc.RevisionId},
+		})
+		return
+	}
+	doc, ok := s.docs[id]
+	if !ok || r.Method != http.MethodGet {
+		fail(w, http.StatusNotFound, "document not found: "+id)
+		return
+	}
+	reply(w, doc)
+}
+
+// setProperty sets p on f, or removes it if p.Value is "".
+func setProperty(f *drive.File, p *drive.Property) {
+	var props []*drive.Property
+	for _, old := range f.Properties {
+		if old.Key != p.Key {
+			props = append(props, old)
+		}
+	}
+	if p.Value != "" {
+		props = append(props, p)
+	}
+	f.Properties = props
+}
+
+func hasParent(f *drive.File, id string) bool {
+	for _, p := range f.Parents {
+		if p.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func split(ids string) []string {
+	if ids == "" {
+		return nil
+	}
+	return strings.Split(ids, ",")
+}
+
+func cloneFile(f *drive.File) (c *drive.File) {
+	c = &drive.File{}
+	copyJSON(c, f)
+	return
+}
+
+func cloneDoc(doc *docs.Document) (c *docs.Document) {
+	c = &docs.Document{}
+	copyJSON(c, doc)
+	return
+}
+
+// copyJSON deep-copies src into dst.
+func copyJSON(dst, src interface{}) {
+	buf, err := json.Marshal(src)
+	if err != nil {
+		panic(err)
+	}
+	err = json.Unmarshal(buf, dst)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fail replies with an error in the APIs' format.
+func fail(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": msg},
+	})
+}
@@ -0,0 +1,214 @@
+package fakedrive
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// matcher reports whether a file, given as its field values, matches
+// a query.
+type matcher func(fields map[string][]string) bool
+
+// parseQuery parses the subset of the Drive query language that
+// google.Query builds: "in", "=", "!=" and "contains" clauses joined
+// with "and", "or", "not" and parentheses.
+func parseQuery(q string) (match matcher, err error) {
+	p := &parser{}
+	p.toks, err = lex(q)
+	if err != nil {
+		return
+	}
+	if len(p.toks) == 0 {
+		return func(map[string][]string) bool { return true }, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			match, err = nil, fmt.Errorf("invalid query %q: %v", q, r)
+		}
+	}()
+	match = p.or()
+	if p.pos < len(p.toks) {
+		panic("unexpected " + p.toks[p.pos].text)
+	}
+	return
+}
+
+type token struct {
+	text string
+	// lit is true for a quoted string
+	lit bool
+}
+
+func lex(q string) (toks []token, err error) {
+	rs := []rune(q)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '=':
+			toks = append(toks, token{text: string(c)})
+			i++
+		case c == '!' && i+1 < len(rs) && rs[i+1] == '=':
+			toks = append(toks, token{text: "!="})
+			i += 2
+		case c == '\'':
+			var b strings.Builder
+			i++
+			for ; i < len(rs) && rs[i] != '\''; i++ {
+				if rs[i] == '\\' {
+					i++
+					if i == len(rs) {
+						break
+					}
+				}
+				b.WriteRune(rs[i])
+			}
+			if i >= len(rs) {
+				return nil, fmt.Errorf("unterminated string in query %q", q)
+			}
+			toks = append(toks, token{text: b.String(), lit: true})
+			i++
+		case unicode.IsLetter(c):
+			j := i
+			for j < len(rs) && unicode.IsLetter(rs[j]) {
+				j++
+			}
+			toks = append(toks, token{text: string(rs[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q in query %q", c, q)
+		}
+	}
+	return
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek(word string) bool {
+	return p.pos < len(p.toks) && !p.toks[p.pos].lit && p.toks[p.pos].text == word
+}
+
+func (p *parser) next() token {
+	if p.pos == len(p.toks) {
+		panic("unexpected end")
+	}
+	p.pos++
+	return p.toks[p.pos-1]
+}
+
+func (p *parser) or() matcher {
+	alts := []matcher{p.and()}
+	for p.peek("or") {
+		p.next()
+		alts = append(alts, p.and())
+	}
+	return func(fields map[string][]string) bool {
+		for _, m := range alts {
+			if m(fields) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (p *parser) and() matcher {
+	all := []matcher{p.unary()}
+	for p.peek("and") {
+		p.next()
+		all = append(all, p.unary())
+	}
+	return func(fields map[string][]string) bool {
+		for _, m := range all {
+			if !m(fields) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (p *parser) unary() matcher {
+	switch {
+	case p.peek("not"):
+		p.next()
+		m := p.unary()
+		return func(fields map[string][]string) bool { return !m(fields) }
+	case p.peek("("):
+		p.next()
+		m := p.or()
+		if tok := p.next(); tok.lit || tok.text != ")" {
+			panic("missing )")
+		}
+		return m
+	}
+	return p.clause()
+}
+
+// fieldNames are the fields a query may test.
+var fieldNames = map[string]bool{
+	"title": true, "mimeType": true, "trashed": true, "parents": true, "fullText": true,
+}
+
+func (p *parser) clause() matcher {
+	first := p.next()
+	if first.lit {
+		// 'value' in field
+		if tok := p.next(); tok.lit || tok.text != "in" {
+			panic("expected in")
+		}
+		field := p.field()
+		return func(fields map[string][]string) bool {
+			for _, v := range fields[field] {
+				if v == first.text {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	p.pos--
+	field := p.field()
+	op := p.next()
+	val := p.next()
+	if !val.lit && val.text != "true" && val.text != "false" {
+		panic("bad value " + val.text)
+	}
+	var test func(v string) bool
+	switch {
+	case op.lit:
+		panic("bad operator " + op.text)
+	case op.text == "=":
+		test = func(v string) bool { return v == val.text }
+	case op.text == "!=":
+		test = func(v string) bool { return v != val.text }
+	case op.text == "contains":
+		// Drive matches fullText by words and title by prefix; a
+		// substring is close enough here
+		want := strings.ToLower(val.text)
+		test = func(v string) bool { return strings.Contains(strings.ToLower(v), want) }
+	default:
+		panic("bad operator " + op.text)
+	}
+	return func(fields map[string][]string) bool {
+		for _, v := range fields[field] {
+			if test(v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (p *parser) field() string {
+	tok := p.next()
+	if tok.lit || !fieldNames[tok.text] {
+		panic("bad field " + tok.text)
+	}
+	return tok.text
+}
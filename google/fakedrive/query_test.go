@@ -0,0 +1,47 @@
+package fakedrive
+
+import (
+	"testing"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestParseQuery(t *testing.T) {
+	fields := map[string][]string{
+		"title":    {"mcp-17-it's here"},
+		"mimeType": {google.DocMimeType},
+		"trashed":  {"false"},
+		"parents":  {"a", "b"},
+		"fullText": {"Hello World"},
+	}
+	cases := []struct {
+		q    *google.Query
+		want bool
+	}{
+		{nil, true},
+		{google.NewQuery().In("b", "parents").Is("trashed", false), true},
+		{google.NewQuery().In("c", "parents"), false},
+		{google.NewQuery().Is("trashed", true), false},
+		{google.NewQuery().Eq("mimeType", google.DocMimeType).Contains("title", "it's"), true},
+		{google.NewQuery().Contains("fullText", "hello"), true},
+		{google.NewQuery().In("a", "parents").And(google.NewQuery().Contains("fullText", "nope")), false},
+		{google.NewQuery().Or(google.NewQuery().Contains("title", "x"), google.NewQuery().Contains("title", "17")), true},
+	}
+	for _, c := range cases {
+		s := ""
+		if c.q != nil {
+			s = c.q.String()
+		}
+		match, err := parseQuery(s)
+		Tassert(t, err == nil, s, err)
+		Tassert(t, match(fields) == c.want, s)
+	}
+
+	for _, q := range []string{
+		"title", "title =", "'a' in", "owners = 'x'", "title = 'x", "(title = 'x'", "title ~ 'x'", "title = 'x' junk",
+	} {
+		_, err := parseQuery(q)
+		Tassert(t, err != nil, q)
+	}
+}
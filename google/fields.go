@@ -0,0 +1,148 @@
+package google
+
+import (
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// FieldPrefix starts the names of the named ranges that hold
+// placeholder values, e.g. "docbot:TITLE" or
+// "docbot:SESSION_DATE|Jan 2, 2006".
+const FieldPrefix = "docbot:"
+
+// FieldName returns the named range name for the value of ph.
+func FieldName(ph Placeholder) string {
+	return FieldPrefix + strings.TrimSuffix(strings.TrimPrefix(ph.Token, "{{"), "}}")
+}
+
+// Field is a placeholder value in a document, kept in one or more
+// named ranges, one per place the placeholder appeared.
+type Field struct {
+	Placeholder
+	Ranges []TextRange
+	// Values are the current text of each range.
+	Values []string
+}
+
+// Fields returns the fields in doc, sorted by named range name.
+func Fields(doc *docs.Document) (fields []Field) {
+	var names []string
+	for name := range doc.NamedRanges {
+		if strings.HasPrefix(name, FieldPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		phs := ParsePlaceholders("{{" + strings.TrimPrefix(name, FieldPrefix) + "}}")
+		if len(phs) != 1 {
+			continue
+		}
+		f := Field{Placeholder: phs[0]}
+		for _, nr := range doc.NamedRanges[name].NamedRanges {
+			for _, r := range nr.Ranges {
+				tr := TextRange{SegmentId: r.SegmentId, StartIndex: r.StartIndex, EndIndex: r.EndIndex}
+				f.Ranges = append(f.Ranges, tr)
+				f.Values = append(f.Values, RangeText(doc, tr))
+			}
+		}
+		fields = append(fields, f)
+	}
+	return
+}
+
+// RangeText returns the text of doc at r.
+func RangeText(doc *docs.Document, r TextRange) string {
+	var sb strings.Builder
+	for _, seg := range Segments(doc) {
+		if seg.Id != r.SegmentId {
+			continue
+		}
+		walkParagraphs(seg.Content, func(p *docs.Paragraph) {
+			for _, el := range p.Elements {
+				if el.TextRun == nil || el.EndIndex <= r.StartIndex || el.StartIndex >= r.EndIndex {
+					continue
+				}
+				sb.WriteString(utf16Slice(el.TextRun.Content, r.StartIndex-el.StartIndex, r.EndIndex-el.StartIndex))
+			}
+		})
+	}
+	return sb.String()
+}
+
+// utf16Slice returns the part of s from UTF-16 offset from up to to,
+// clipped to s.
+func utf16Slice(s string, from, to int64) string {
+	var sb strings.Builder
+	var i int64
+	for _, r := range s {
+		if i >= from && i < to {
+			sb.WriteRune(r)
+		}
+		i += utf16Len(string(r))
+	}
+	return sb.String()
+}
+
+// FieldRequests returns the requests that replace the text of the
+// fields named in vals, keyed by FieldName, keeping each field's
+// named ranges around the new text.  A value must not be empty, since
+// a named range can't be.  Counts in res are keyed by field name.
+func FieldRequests(doc *docs.Document, vals map[string]string) (reqs []*docs.Request, res *FillResult) {
+	res = &FillResult{Counts: make(map[string]int)}
+	var names []string
+	for name := range vals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make(map[string]Field)
+	for _, f := range Fields(doc) {
+		fields[FieldName(f.Placeholder)] = f
+	}
+	var matches []fillMatch
+	for _, name := range names {
+		f, ok := fields[name]
+		if !ok || len(f.Ranges) == 0 {
+			res.Missing = append(res.Missing, name)
+			continue
+		}
+		// the ranges are made again around the new text
+		reqs = append(reqs, &docs.Request{DeleteNamedRange: &docs.DeleteNamedRangeRequest{Name: name}})
+		for i, r := range f.Ranges {
+			fill := &Fill{Token: f.Values[i], Text: vals[name], Range: name}
+			matches = append(matches, fillMatch{r, fill})
+		}
+		res.Counts[name] = len(f.Ranges)
+	}
+	reqs = append(reqs, replaceRequests(matches, &FillResult{Counts: make(map[string]int)})...)
+	return
+}
+
+// FieldRequest adds the requests that update fields in doc; see
+// FieldRequests.
+func (b *batch) FieldRequest(doc *docs.Document, vals map[string]string) (res *FillResult) {
+	reqs, res := FieldRequests(doc, vals)
+	b.docRequests(doc, reqs, res)
+	return
+}
+
+// SetFields updates the fields of node, whose content is doc, in a
+// single batch that fails if the document has changed since doc was
+// fetched.
+func (gf *Folder) SetFields(node *Node, doc *docs.Document, vals map[string]string) (res *FillResult, err error) {
+	defer Return(&err)
+	for name, v := range vals {
+		Assert(v != "", "empty value for %s", name)
+	}
+	b := gf.BatchStart()
+	res = b.FieldRequest(doc, vals)
+	if b.Len() == 0 {
+		return
+	}
+	_, err = b.Run(node)
+	Ck(err)
+	return
+}
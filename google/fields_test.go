@@ -0,0 +1,47 @@
+package google
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+func fieldDoc() *docs.Document {
+	doc := textDoc()
+	doc.RevisionId = "rev1"
+	doc.NamedRanges = map[string]docs.NamedRanges{
+		"docbot:TITLE": {Name: "docbot:TITLE", NamedRanges: []*docs.NamedRange{
+			{Name: "docbot:TITLE", Ranges: []*docs.Range{{StartIndex: 8, EndIndex: 14}, {StartIndex: 59, EndIndex: 62}}},
+		}},
+		"docbot:SPEAKERS|list": {Name: "docbot:SPEAKERS|list", NamedRanges: []*docs.NamedRange{
+			{Name: "docbot:SPEAKERS|list", Ranges: []*docs.Range{{SegmentId: "h.1", StartIndex: 0, EndIndex: 4}}},
+		}},
+		"other": {Name: "other"},
+	}
+	return doc
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields(fieldDoc())
+	Tassert(t, len(fields) == 2, fields)
+	Tassert(t, fields[0].Name == "SPEAKERS" && fields[0].Format == "list", fields[0])
+	Tassert(t, fields[0].Values[0] == "Page", fields[0].Values)
+	Tassert(t, FieldName(fields[0].Placeholder) == "docbot:SPEAKERS|list")
+	// the emoji is two UTF-16 code units
+	Tassert(t, fields[1].Values[0] == "Café 😀" && fields[1].Values[1] == "oom", Spf("%q", fields[1].Values))
+}
+
+func TestFieldRequests(t *testing.T) {
+	reqs, res := FieldRequests(fieldDoc(), map[string]string{"docbot:TITLE": "Tools", "docbot:ROOM": "A"})
+	Tassert(t, res.Counts["docbot:TITLE"] == 2, res.Counts)
+	Tassert(t, len(res.Missing) == 1 && res.Missing[0] == "docbot:ROOM", res.Missing)
+	Tassert(t, reqs[0].DeleteNamedRange.Name == "docbot:TITLE", reqs[0])
+	// the later range first: insert, delete twice, name
+	Tassert(t, len(reqs) == 9, len(reqs))
+	Tassert(t, reqs[1].InsertText.Location.Index == 60, reqs[1])
+	nr := reqs[4].CreateNamedRange
+	Tassert(t, nr.Name == "docbot:TITLE" && nr.Range.StartIndex == 59 && nr.Range.EndIndex == 64, nr)
+	nr = reqs[8].CreateNamedRange
+	Tassert(t, nr.Range.StartIndex == 8 && nr.Range.EndIndex == 13, nr)
+}
@@ -0,0 +1,174 @@
+package google
+
+import (
+	"sort"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// Fill replaces each occurrence of a placeholder in a document.
+type Fill struct {
+	// Token is the text to replace, e.g. "{{UNLOCK_URL}}".
+	Token string
+	// Name, if true, only replaces Token where it isn't part of a
+	// longer name; see FindName.
+	Name bool
+	// Text replaces Token.  Newlines in Text start new paragraphs,
+	// which take the style of the paragraph Token was in.
+	Text string
+	// Link, if set, links the replacement text to this URL.
+	Link string
+	// List turns the paragraphs holding the replacement into a
+	// bulleted list.
+	List bool
+	// Style, if set, is applied to the replacement text; Fields lists
+	// the TextStyle fields to change, as in UpdateTextStyleRequest.
+	Style  *docs.TextStyle
+	Fields string
+	// Range, if set, names the replacement text with a named range
+	// so it can be found and updated later; see Fields.
+	Range string
+}
+
+// FillResult reports what a set of fills found.
+type FillResult struct {
+	// Counts is the number of replacements made for each token.
+	Counts map[string]int
+	// Missing lists the tokens that were not found.
+	Missing []string
+}
+
+// FillRequests returns the requests that apply fills to doc.  Unlike
+// ReplaceAllText, a placeholder is found even if it spans several
+// text runs or paragraphs, and the replacement keeps the text style
+// of the placeholder's first character.
+func FillRequests(doc *docs.Document, fills []Fill) (reqs []*docs.Request, res *FillResult) {
+	res = &FillResult{Counts: make(map[string]int)}
+	var matches []fillMatch
+	for i := range fills {
+		f := &fills[i]
+		ranges := findText(doc, f.Token, f.Name)
+		if len(ranges) == 0 {
+			res.Missing = append(res.Missing, f.Token)
+			continue
+		}
+		for _, r := range ranges {
+			matches = append(matches, fillMatch{r, f})
+		}
+	}
+	reqs = replaceRequests(matches, res)
+	return
+}
+
+// fillMatch is a range of text to be replaced by a fill.
+type fillMatch struct {
+	TextRange
+	fill *Fill
+}
+
+// replaceRequests returns the requests that replace each match,
+// counting them in res.
+func replaceRequests(matches []fillMatch, res *FillResult) (reqs []*docs.Request) {
+	// work backwards through each segment so that each edit leaves
+	// the indexes of the ones still to come unchanged
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].SegmentId != matches[j].SegmentId {
+			return matches[i].SegmentId < matches[j].SegmentId
+		}
+		return matches[i].StartIndex > matches[j].StartIndex
+	})
+	var prev *fillMatch
+	for i := range matches {
+		m := &matches[i]
+		if prev != nil && prev.SegmentId == m.SegmentId && m.EndIndex > prev.StartIndex {
+			// overlaps a later match that has already been replaced
+			continue
+		}
+		prev = m
+		res.Counts[m.fill.Token]++
+		reqs = append(reqs, fillRequests(m.TextRange, m.fill)...)
+	}
+	return
+}
+
+// fillRequests returns the requests that replace the text at r.
+func fillRequests(r TextRange, f *Fill) (reqs []*docs.Request) {
+	rng := func(start, end int64) *docs.Range {
+		return &docs.Range{SegmentId: r.SegmentId, StartIndex: start, EndIndex: end}
+	}
+	txt := strings.ReplaceAll(f.Text, "\r\n", "\n")
+	n := utf16Len(txt)
+	switch {
+	case txt == f.Token:
+		// nothing to replace, e.g. a URL that only needs a link
+	case n == 0:
+		reqs = append(reqs, &docs.Request{
+			DeleteContentRange: &docs.DeleteContentRangeRequest{Range: rng(r.StartIndex, r.EndIndex)},
+		})
+	default:
+		// insert after the placeholder's first character so the
+		// new text picks up its style, then delete the placeholder
+		// around it
+		reqs = append(reqs,
+			&docs.Request{InsertText: &docs.InsertTextRequest{
+				Location: &docs.Location{SegmentId: r.SegmentId, Index: r.StartIndex + 1},
+				Text:     txt,
+			}},
+			&docs.Request{DeleteContentRange: &docs.DeleteContentRangeRequest{
+				Range: rng(r.StartIndex+1+n, r.EndIndex+n),
+			}},
+			&docs.Request{DeleteContentRange: &docs.DeleteContentRangeRequest{
+				Range: rng(r.StartIndex, r.StartIndex+1),
+			}},
+		)
+	}
+	if n == 0 {
+		return
+	}
+	end := r.StartIndex + n
+	if f.Link != "" {
+		reqs = append(reqs, &docs.Request{UpdateTextStyle: &docs.UpdateTextStyleRequest{
+			Fields:    "link",
+			Range:     rng(r.StartIndex, end),
+			TextStyle: &docs.TextStyle{Link: &docs.Link{Url: f.Link}},
+		}})
+	}
+	if f.Style != nil {
+		reqs = append(reqs, &docs.Request{UpdateTextStyle: &docs.UpdateTextStyleRequest{
+			Fields:    f.Fields,
+			Range:     rng(r.StartIndex, end),
+			TextStyle: f.Style,
+		}})
+	}
+	if f.List {
+		reqs = append(reqs, &docs.Request{CreateParagraphBullets: &docs.CreateParagraphBulletsRequest{
+			BulletPreset: "BULLET_DISC_CIRCLE_SQUARE",
+			Range:        rng(r.StartIndex, end),
+		}})
+	}
+	if f.Range != "" {
+		reqs = append(reqs, &docs.Request{CreateNamedRange: &docs.CreateNamedRangeRequest{
+			Name:  f.Range,
+			Range: rng(r.StartIndex, end),
+		}})
+	}
+	return
+}
+
+// Fill applies fills to the document in a single batch, which fails
+// if the document changes while the requests are being built.
+func (gf *Folder) Fill(node *Node, fills []Fill) (res *FillResult, err error) {
+	defer Return(&err)
+	doc, err := gf.Document(node)
+	Ck(err)
+	b := gf.BatchStart()
+	res = b.FillRequest(doc, fills)
+	if b.Len() == 0 {
+		return
+	}
+	_, err = b.Run(node)
+	Ck(err)
+	return
+}
@@ -1,15 +1,20 @@
 package google
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"io"
+	"io/ioutil"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	. "github.com/stevegt/goadapt"
 	"google.golang.org/api/docs/v1"
 	"google.golang.org/api/drive/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 )
 
 /*
@@ -33,6 +38,12 @@ architecture:
 
 var headre = regexp.MustCompile(`^(\w+):\s+(.*)`)
 
+const (
+	DocMimeType    = "application/vnd.google-apps.document"
+	FolderMimeType = "application/vnd.google-apps.folder"
+	DocxMimeType   = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+)
+
 type Node struct {
 	file     *drive.File
 	name     string
@@ -50,32 +61,117 @@ func (n *Node) MimeType() string { return n.mimeType }
 func (n *Node) Num() int         { return n.num }
 func (n *Node) Created() string  { return n.created }
 
-func (gf *Folder) mkNode(f *drive.File) (node *Node) {
-	m := gf.fnre.FindStringSubmatch(f.Title)
-	var num int
+// Modified returns the Drive modification time in RFC 3339 format.
+func (n *Node) Modified() string {
+	if n.file == nil {
+		return ""
+	}
+	return n.file.ModifiedDate
+}
+
+// Version returns the Drive version number, which increases whenever
+// the file changes.
+func (n *Node) Version() int64 {
+	if n.file == nil {
+		return 0
+	}
+	return n.file.Version
+}
+
+// Metadata returns the Drive file resource as JSON.
+func (n *Node) Metadata() (buf []byte, err error) {
+	return json.MarshalIndent(n.file, "", "  ")
+}
+
+// Owners returns the display names of the Drive owners of n.
+func (n *Node) Owners() (owners []string) {
+	if n.file == nil {
+		return
+	}
+	for _, u := range n.file.Owners {
+		owners = append(owners, u.DisplayName)
+	}
+	return
+}
+
+// TrashedDate returns the time node was moved to the Drive trash in
+// RFC 3339 format, or "" if it isn't in the trash.
+func (n *Node) TrashedDate() string {
+	if n.file == nil {
+		return ""
+	}
+	return n.file.TrashedDate
+}
+
+// Property returns the value of the Drive custom property key, or ""
+// if it isn't set.
+func (n *Node) Property(key string) string {
+	if n.file == nil {
+		return ""
+	}
+	for _, p := range n.file.Properties {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// ParseNum returns the document number embedded in name, or 0 if
+// name doesn't match the folder's document pattern.
+func (gf *Folder) ParseNum(name string) (num int) {
+	m := gf.fnre.FindStringSubmatch(name)
 	if len(m) == 2 {
 		num, _ = strconv.Atoi(m[1])
 	}
+	return
+}
+
+// Renumbered returns name with its document number replaced by num.
+// It returns false if name doesn't match the document pattern.
+func (gf *Folder) Renumbered(name string, num int) (newName string, ok bool) {
+	loc := gf.fnre.FindStringSubmatchIndex(name)
+	if len(loc) != 4 {
+		return name, false
+	}
+	newName = name[:loc[2]] + strconv.Itoa(num) + name[loc[3]:]
+	return newName, true
+}
+
+// NumPrefix returns the part of name that identifies its number,
+// e.g. "mcp-17" for "mcp-17-foo", or "" if name has no number.
+func (gf *Folder) NumPrefix(name string) string {
+	return gf.fnre.FindString(name)
+}
 
+func (gf *Folder) mkNode(f *drive.File) (node *Node) {
 	node = &Node{
 		file:     f,
 		name:     f.Title,
 		id:       f.Id,
 		url:      f.AlternateLink,
 		mimeType: f.MimeType,
-		num:      num,
+		num:      gf.ParseNum(f.Title),
 		created:  f.CreatedDate,
 	}
 
 	return
 }
 
+// NewNode returns the node for f, a file that need not have come from
+// Drive, e.g. in tests.
+func (gf *Folder) NewNode(f *drive.File) *Node {
+	return gf.mkNode(f)
+}
+
 type Folder struct {
 	id         string
 	docs       *docs.Service
 	drive      *drive.Service
 	MinNextNum int
 	fnre       *regexp.Regexp
+	sandbox    *Sandbox
+	production bool
 }
 
 // NewFolder returns an object that represents a single gdrive folder.
@@ -106,7 +202,70 @@ func NewFolder(cbuf []byte, folderid string, docPattern *regexp.Regexp, minNextN
 	defer Return(&err)
 
 	// TEMPORARY bypass for local HTML testing
-	return &Folder{}, nil
+	return &Folder{id: folderid, MinNextNum: minNextNum, fnre: docPattern}, nil
+}
+
+// NewFolderWith is like NewFolder, but reaches Drive with opts rather
+// than service account credentials, e.g. to use a fake server in
+// tests.
+func NewFolderWith(folderid string, docPattern *regexp.Regexp, minNextNum int, opts ...option.ClientOption) (gf *Folder, err error) {
+	defer Return(&err)
+	gf = &Folder{id: folderid, MinNextNum: minNextNum, fnre: docPattern}
+	ctx := context.Background()
+	gf.docs, err = docs.NewService(ctx, opts...)
+	Ck(err)
+	gf.drive, err = drive.NewService(ctx, opts...)
+	Ck(err)
+	return
+}
+
+// Title returns the title of the folder itself, failing if the folder
+// is not reachable or is not a folder.
+func (gf *Folder) Title() (title string, err error) {
+	defer Return(&err)
+	f, err := gf.drive.Files.Get(gf.id).Do()
+	Ck(err)
+	Assert(f.MimeType == FolderMimeType, "not a folder: %s", f.MimeType)
+	title = f.Title
+	return
+}
+
+// Document fetches the full Docs API representation of node.
+func (gf *Folder) Document(node *Node) (doc *docs.Document, err error) {
+	defer Return(&err)
+	doc, err = gf.docs.Documents.Get(node.Id()).Do()
+	Ck(err)
+	return
+}
+
+// Export downloads node converted to mimeType, e.g. DocxMimeType.
+func (gf *Folder) Export(node *Node, mimeType string) (buf []byte, err error) {
+	defer Return(&err)
+	res, err := gf.drive.Files.Export(node.Id(), mimeType).Download()
+	Ck(err)
+	defer res.Body.Close()
+	buf, err = ioutil.ReadAll(res.Body)
+	Ck(err)
+	return
+}
+
+// Insert uploads the content in r as a new Google Doc named name in
+// this folder.  The content is converted from its mimeType, e.g.
+// DocxMimeType.
+func (gf *Folder) Insert(name, mimeType string, r io.Reader) (node *Node, err error) {
+	defer Return(&err)
+	err = gf.guard(name)
+	Ck(err)
+	parentref := &drive.ParentReference{Id: gf.id}
+	file := &drive.File{
+		Title:    name,
+		MimeType: DocMimeType,
+		Parents:  []*drive.ParentReference{parentref},
+	}
+	f, err := gf.drive.Files.Insert(file).Convert(true).Media(r, googleapi.ContentType(mimeType)).Do()
+	Ck(err)
+	node = gf.mkNode(f)
+	return
 }
 
 func (gf *Folder) Doc2json(node *Node) (buf []byte, err error) {
@@ -126,63 +285,44 @@ func (gf *Folder) Doc2txt(node *Node) (txt string, err error) {
 	// XXX move node stuff to Node, include gf in struct
 	doc, err := gf.docs.Documents.Get(node.Id()).Do()
 	Ck(err)
-	b := doc.Body
-	// Pprint(b.Content)
-	// iterate over elements
-	for _, s := range b.Content {
-		if s.Paragraph != nil {
-			for _, el := range s.Paragraph.Elements {
-				if el.TextRun != nil {
-					content := el.TextRun.Content
-					txt += content
-				}
-			}
-		}
-	}
-	// replace line tabulation unicode chars with newline
-	txt = strings.ReplaceAll(txt, "\u000b", "\n")
+	txt = Text(doc)
 	return
 }
 
-func (gf *Folder) textRuns(node *Node) (els []*docs.ParagraphElement, err error) {
+// FindTextRun returns a text run covering the first occurrence of txt
+// in the document body, including tables, or nil if there is none.
+// The run is synthesized from FindText, so it may span several runs
+// in the document; only its indexes and content are set.
+func (gf *Folder) FindTextRun(node *Node, txt string) (el *docs.ParagraphElement, err error) {
 	defer Return(&err)
 	doc, err := gf.docs.Documents.Get(node.Id()).Do()
 	Ck(err)
-	b := doc.Body
-	// iterate over elements
-	for _, s := range b.Content {
-		if s.Paragraph != nil {
-			for _, el := range s.Paragraph.Elements {
-				if el.TextRun != nil {
-					els = append(els, el)
-				}
-			}
+	for _, r := range FindText(doc, txt) {
+		if r.SegmentId != "" {
+			continue
+		}
+		el = &docs.ParagraphElement{
+			StartIndex: r.StartIndex,
+			EndIndex:   r.EndIndex,
+			TextRun:    &docs.TextRun{Content: txt},
 		}
+		break
 	}
 	return
 }
 
-func (gf *Folder) FindTextRun(node *Node, txt string) (el *docs.ParagraphElement, err error) {
+func (gf *Folder) GetHeaders(node *Node) (h map[string]string, err error) {
 	defer Return(&err)
-
-	els, err := gf.textRuns(node)
+	txt, err := gf.Doc2txt(node)
 	Ck(err)
-	for _, e := range els {
-		// Pprint(e.TextRun.Content)
-		if e.TextRun.Content == txt {
-			el = e
-			break
-		}
-	}
-
+	h = ParseHeaders(txt)
 	return
 }
 
-func (gf *Folder) GetHeaders(node *Node) (h map[string]string, err error) {
-	defer Return(&err)
+// ParseHeaders returns the "Key: value" header lines at the top of a
+// document's text, up to the first blank line.
+func ParseHeaders(txt string) (h map[string]string) {
 	h = make(map[string]string)
-	txt, err := gf.Doc2txt(node)
-	Ck(err)
 	lines := strings.Split(txt, "\n")
 	for _, line := range lines {
 		if line == "" {
@@ -200,55 +340,172 @@ func (gf *Folder) GetHeaders(node *Node) (h map[string]string, err error) {
 	return
 }
 
-func (gf *Folder) QueryNodes(query string) (nodes []*Node, err error) {
-	defer Return(&err)
+// QueryNodes returns the files in this folder, not counting the
+// trash, that match q, which may be nil.
+func (gf *Folder) QueryNodes(q *Query) (nodes []*Node, err error) {
+	// trashed files keep their parents, so must be excluded
+	query := NewQuery().In(gf.id, "parents").Is("trashed", false).And(q)
+	return gf.list(query.String())
+}
 
-	if query == "" {
-		query = fmt.Sprintf("'%v' in parents", gf.id)
-	} else {
-		query = fmt.Sprintf("'%v' in parents and %s", gf.id, query)
+// Rm permanently deletes rmnode, bypassing the Drive trash.
+func (gf *Folder) Rm(rmnode *Node) (err error) {
+	defer Return(&err)
+	if rmnode == nil {
+		return
 	}
+	err = gf.guard(rmnode.name)
+	Ck(err)
+	err = gf.drive.Files.Delete(rmnode.id).Do()
+	Ck(err)
+	return
+}
+
+// Get returns the node for the Drive file with the given ID, which
+// need not be in this folder.
+func (gf *Folder) Get(id string) (node *Node, err error) {
+	defer Return(&err)
+	f, err := gf.drive.Files.Get(id).Do()
+	Ck(err, id)
+	node = gf.mkNode(f)
+	return
+}
+
+// Children returns the Google Docs in the Drive folder with the
+// given ID, which need not be this folder.
+func (gf *Folder) Children(folderId string) (nodes []*Node, err error) {
+	q := NewQuery().In(folderId, "parents").Is("trashed", false).Eq("mimeType", DocMimeType)
+	return gf.list(q.String())
+}
 
+// Trashed returns the files in this folder that are in the Drive
+// trash.
+func (gf *Folder) Trashed() (nodes []*Node, err error) {
+	q := NewQuery().In(gf.id, "parents").Is("trashed", true)
+	return gf.list(q.String())
+}
+
+// list returns every file matching the Drive query.
+func (gf *Folder) list(query string) (nodes []*Node, err error) {
+	defer Return(&err)
 	var pageToken string
 	for {
-
 		q := gf.drive.Files.List().Q(query)
-
 		if pageToken != "" {
 			q = q.PageToken(pageToken)
 		}
-
 		res, err := q.Do()
 		Ck(err, query)
-
 		for _, f := range res.Items {
-			// f is a *drive.File
-			node := gf.mkNode(f)
-			Ck(err)
-			nodes = append(nodes, node)
+			nodes = append(nodes, gf.mkNode(f))
 		}
-
 		pageToken = res.NextPageToken
 		if pageToken == "" {
 			break
 		}
 	}
+	return
+}
 
+// Trash moves node to the Drive trash, from which it can be restored
+// with Untrash until the trash is emptied.
+func (gf *Folder) Trash(node *Node) (err error) {
+	defer Return(&err)
+	err = gf.guard(node.name)
+	Ck(err)
+	_, err = gf.drive.Files.Trash(node.id).Do()
+	Ck(err)
 	return
 }
 
-func (gf *Folder) Rm(rmnode *Node) (err error) {
+// Untrash restores the file with the given ID from the Drive trash.
+func (gf *Folder) Untrash(id string) (node *Node, err error) {
 	defer Return(&err)
-	if rmnode == nil {
-		return
+	f, err := gf.drive.Files.Untrash(id).Do()
+	Ck(err, id)
+	node = gf.mkNode(f)
+	return
+}
+
+// Move moves node from its current parents into this folder, renaming
+// it to newName.
+func (gf *Folder) Move(node *Node, newName string) (newNode *Node, err error) {
+	return gf.MoveTo(node, gf.id, newName)
+}
+
+// MoveTo moves node from its current parents into the Drive folder
+// folderId, renaming it to newName.
+func (gf *Folder) MoveTo(node *Node, folderId, newName string) (newNode *Node, err error) {
+	defer Return(&err)
+	if folderId != gf.id {
+		// moving a document out of this folder
+		err = gf.guard(node.name)
+		Ck(err)
 	}
-	err = gf.drive.Files.Delete(rmnode.id).Do()
+	err = gf.guard(newName)
+	Ck(err)
+	var parents []string
+	if node.file != nil {
+		for _, p := range node.file.Parents {
+			parents = append(parents, p.Id)
+		}
+	}
+	call := gf.drive.Files.Patch(node.id, &drive.File{Title: newName}).AddParents(folderId)
+	if len(parents) > 0 {
+		call = call.RemoveParents(strings.Join(parents, ","))
+	}
+	f, err := call.Do()
+	Ck(err)
+	newNode = gf.mkNode(f)
+	return
+}
+
+// Rename changes the Drive title of node and returns the updated
+// node.
+func (gf *Folder) Rename(node *Node, newName string) (newNode *Node, err error) {
+	defer Return(&err)
+	err = gf.guard(node.name)
+	Ck(err)
+	err = gf.guard(newName)
+	Ck(err)
+	f, err := gf.drive.Files.Patch(node.id, &drive.File{Title: newName}).Do()
+	Ck(err)
+	newNode = gf.mkNode(f)
+	return
+}
+
+// SetProperties sets public Drive custom properties on node and
+// returns the updated node.  Keys with empty values are removed.
+func (gf *Folder) SetProperties(node *Node, props map[string]string) (newNode *Node, err error) {
+	defer Return(&err)
+	err = gf.guard(node.name)
+	Ck(err)
+	var keys []string
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if props[k] == "" {
+			if node.Property(k) != "" {
+				err = gf.drive.Properties.Delete(node.id, k).Visibility("PUBLIC").Do()
+				Ck(err, k)
+			}
+			continue
+		}
+		p := &drive.Property{Key: k, Value: props[k], Visibility: "PUBLIC"}
+		_, err = gf.drive.Properties.Insert(node.id, p).Do()
+		Ck(err, k)
+	}
+	newNode, err = gf.Get(node.id)
 	Ck(err)
 	return
 }
 
 func (gf *Folder) Copy(tnode *Node, newName string) (node *Node, err error) {
 	defer Return(&err)
+	err = gf.guard(newName)
+	Ck(err)
 	parentref := &drive.ParentReference{Id: gf.id}
 	file := &drive.File{Parents: []*drive.ParentReference{parentref}, Title: newName}
 	f, err := gf.drive.Files.Copy(tnode.Id(), file).Do()
@@ -279,3 +536,21 @@ func (gf *Folder) put() {
 }
 
 */
+
+// Revision is one saved version of a document.
+type Revision struct {
+	Id       string
+	Modified string
+	User     string
+}
+
+// Revisions lists node's revisions, oldest first.
+func (gf *Folder) Revisions(node *Node) (revs []Revision, err error) {
+	defer Return(&err)
+	res, err := gf.drive.Revisions.List(node.id).Do()
+	Ck(err)
+	for _, r := range res.Items {
+		revs = append(revs, Revision{Id: r.Id, Modified: r.ModifiedDate, User: r.LastModifyingUserName})
+	}
+	return
+}
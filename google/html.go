@@ -0,0 +1,323 @@
+package google
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// ImageFunc returns the src attribute for the inline image id,
+// typically after saving a local copy of obj's content.  An empty src
+// leaves the image out.
+type ImageFunc func(id string, obj *docs.EmbeddedObject) (src string, err error)
+
+// HTML renders doc as a standalone HTML page.  The output is limited
+// to semantic markup -- headings, paragraphs, nested lists, tables,
+// images, footnotes, links, and bold, italic, strikethrough and code
+// text -- with no styles or scripts, and links are restricted to
+// http, https, mailto and in-document targets.  If image is nil,
+// images link to their Drive content URIs, which expire after a short
+// time.
+func HTML(doc *docs.Document, image ImageFunc) (buf []byte, err error) {
+	defer Return(&err)
+	r := &htmlRenderer{doc: doc, image: image}
+	r.w("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	r.w("<title>%s</title>\n", html.EscapeString(doc.Title))
+	r.w("</head>\n<body>\n")
+	if doc.Body != nil {
+		r.elements(doc.Body.Content)
+	}
+	r.footnotes()
+	r.w("</body>\n</html>\n")
+	Ck(r.err)
+	return []byte(r.sb.String()), nil
+}
+
+type htmlRenderer struct {
+	doc   *docs.Document
+	image ImageFunc
+	sb    strings.Builder
+	err   error
+	// lists are the tags of the open lists, outermost first
+	lists  []string
+	listId string
+	// notes are the footnote IDs in order of reference, numbered
+	// from 1 in noteNums
+	notes    []string
+	noteNums map[string]int
+}
+
+func (r *htmlRenderer) w(format string, args ...interface{}) {
+	if len(args) == 0 {
+		r.sb.WriteString(format)
+		return
+	}
+	r.sb.WriteString(fmt.Sprintf(format, args...))
+}
+
+func (r *htmlRenderer) elements(els []*docs.StructuralElement) {
+	for _, s := range els {
+		if s.Paragraph == nil || s.Paragraph.Bullet == nil {
+			r.closeLists(0)
+		}
+		switch {
+		case s.Paragraph != nil:
+			r.paragraph(s.Paragraph)
+		case s.Table != nil:
+			r.table(s.Table)
+		case s.TableOfContents != nil:
+			r.w("<nav>\n")
+			r.elements(s.TableOfContents.Content)
+			r.closeLists(0)
+			r.w("</nav>\n")
+		}
+	}
+	r.closeLists(0)
+}
+
+var htmlHeadings = map[string]string{
+	"TITLE":     "h1",
+	"SUBTITLE":  "h2",
+	"HEADING_1": "h1",
+	"HEADING_2": "h2",
+	"HEADING_3": "h3",
+	"HEADING_4": "h4",
+	"HEADING_5": "h5",
+	"HEADING_6": "h6",
+}
+
+func (r *htmlRenderer) paragraph(p *docs.Paragraph) {
+	content := r.runs(p.Elements)
+	if p.Bullet != nil {
+		r.listItem(p.Bullet, content)
+		return
+	}
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	if strings.TrimSpace(strings.ReplaceAll(content, "<hr>", "")) == "" {
+		// a rule on its own line can't go inside <p>
+		r.w("%s\n", strings.TrimSpace(content))
+		return
+	}
+	tag := "p"
+	id := ""
+	if st := p.ParagraphStyle; st != nil {
+		if h, ok := htmlHeadings[st.NamedStyleType]; ok {
+			tag = h
+		}
+		if st.HeadingId != "" {
+			id = Spf(" id=\"%s\"", html.EscapeString(st.HeadingId))
+		}
+	}
+	r.w("<%s%s>%s</%s>\n", tag, id, content, tag)
+}
+
+// listItem writes a list item, opening and closing nested lists to
+// reach the bullet's level.
+func (r *htmlRenderer) listItem(b *docs.Bullet, content string) {
+	level := int(b.NestingLevel)
+	if b.ListId != r.listId {
+		r.closeLists(0)
+		r.listId = b.ListId
+	}
+	r.closeLists(level + 1)
+	if len(r.lists) == level+1 {
+		r.w("</li>\n")
+	}
+	for len(r.lists) < level+1 {
+		tag := "ul"
+		if listOrdered(r.doc, &docs.Bullet{ListId: b.ListId, NestingLevel: int64(len(r.lists))}) {
+			tag = "ol"
+		}
+		r.w("<%s>\n", tag)
+		r.lists = append(r.lists, tag)
+		if len(r.lists) < level+1 {
+			// skipped level: give the nested list a parent item
+			r.w("<li>")
+		}
+	}
+	r.w("<li>%s", content)
+}
+
+// closeLists closes open lists until depth remain.
+func (r *htmlRenderer) closeLists(depth int) {
+	for len(r.lists) > depth {
+		tag := r.lists[len(r.lists)-1]
+		r.lists = r.lists[:len(r.lists)-1]
+		r.w("</li>\n</%s>\n", tag)
+	}
+	if depth == 0 {
+		r.listId = ""
+	}
+}
+
+func (r *htmlRenderer) table(t *docs.Table) {
+	r.w("<table>\n")
+	for _, row := range t.TableRows {
+		r.w("<tr>\n")
+		for _, cell := range row.TableCells {
+			r.w("<td>\n")
+			r.elements(cell.Content)
+			r.w("</td>\n")
+		}
+		r.w("</tr>\n")
+	}
+	r.w("</table>\n")
+}
+
+// monospace lists the font families rendered as code.
+var monospace = map[string]bool{
+	"Consolas":        true,
+	"Courier New":     true,
+	"Inconsolata":     true,
+	"Roboto Mono":     true,
+	"Source Code Pro": true,
+}
+
+// runs renders a paragraph's elements as inline HTML.
+func (r *htmlRenderer) runs(els []*docs.ParagraphElement) string {
+	var sb strings.Builder
+	for _, el := range els {
+		switch {
+		case el.TextRun != nil:
+			sb.WriteString(r.textRun(el.TextRun))
+		case el.InlineObjectElement != nil:
+			sb.WriteString(r.inlineObject(el.InlineObjectElement.InlineObjectId))
+		case el.FootnoteReference != nil:
+			sb.WriteString(r.footnoteRef(el.FootnoteReference.FootnoteId))
+		case el.HorizontalRule != nil:
+			sb.WriteString("<hr>")
+		}
+	}
+	return sb.String()
+}
+
+func (r *htmlRenderer) textRun(run *docs.TextRun) string {
+	txt := strings.TrimRight(run.Content, "\n")
+	if txt == "" {
+		return ""
+	}
+	txt = html.EscapeString(txt)
+	txt = strings.ReplaceAll(txt, "\u000b", "<br>")
+	st := run.TextStyle
+	if st == nil || strings.TrimSpace(txt) == "" {
+		return txt
+	}
+	wrap := func(tag string) {
+		txt = Spf("<%s>%s</%s>", tag, txt, tag)
+	}
+	if st.WeightedFontFamily != nil && monospace[st.WeightedFontFamily.FontFamily] {
+		wrap("code")
+	}
+	if st.Bold {
+		wrap("strong")
+	}
+	if st.Italic {
+		wrap("em")
+	}
+	if st.Strikethrough {
+		wrap("s")
+	}
+	if href := linkHref(st.Link); href != "" {
+		txt = Spf("<a href=\"%s\">%s</a>", html.EscapeString(href), txt)
+	}
+	return txt
+}
+
+// linkHref returns the target of link, or "" if it has none or its
+// scheme is not allowed.
+func linkHref(link *docs.Link) string {
+	if link == nil {
+		return ""
+	}
+	switch {
+	case link.HeadingId != "":
+		return "#" + link.HeadingId
+	case link.BookmarkId != "":
+		return "#" + link.BookmarkId
+	}
+	lower := strings.ToLower(strings.TrimSpace(link.Url))
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return strings.TrimSpace(link.Url)
+		}
+	}
+	return ""
+}
+
+func (r *htmlRenderer) inlineObject(id string) string {
+	obj, ok := r.doc.InlineObjects[id]
+	if !ok || obj.InlineObjectProperties == nil {
+		return ""
+	}
+	emb := obj.InlineObjectProperties.EmbeddedObject
+	if emb == nil || emb.ImageProperties == nil {
+		return ""
+	}
+	src := emb.ImageProperties.ContentUri
+	if r.image != nil {
+		var err error
+		src, err = r.image(id, emb)
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+	if src == "" {
+		return ""
+	}
+	alt := emb.Description
+	if alt == "" {
+		alt = emb.Title
+	}
+	return Spf("<img src=\"%s\" alt=\"%s\">", html.EscapeString(src), html.EscapeString(alt))
+}
+
+// footnoteRef returns the superscript link to footnote id, numbering
+// it on first reference.
+func (r *htmlRenderer) footnoteRef(id string) string {
+	if r.noteNums == nil {
+		r.noteNums = make(map[string]int)
+	}
+	eid := html.EscapeString(id)
+	num, ok := r.noteNums[id]
+	if ok {
+		return Spf("<sup><a href=\"#fn-%s\">%d</a></sup>", eid, num)
+	}
+	r.notes = append(r.notes, id)
+	num = len(r.notes)
+	r.noteNums[id] = num
+	return Spf("<sup><a href=\"#fn-%s\" id=\"fnref-%s\">%d</a></sup>", eid, eid, num)
+}
+
+// footnotes writes the footnotes in the order they were referenced.
+func (r *htmlRenderer) footnotes() {
+	if len(r.notes) == 0 {
+		return
+	}
+	r.w("<section>\n<hr>\n<ol>\n")
+	// footnote text can itself refer to footnotes, so index by
+	// position rather than ranging over a growing slice
+	for i := 0; i < len(r.notes); i++ {
+		id := r.notes[i]
+		fn, ok := r.doc.Footnotes[id]
+		eid := html.EscapeString(id)
+		r.w("<li id=\"fn-%s\">", eid)
+		if ok {
+			var parts []string
+			for _, s := range fn.Content {
+				if s.Paragraph != nil {
+					if txt := strings.TrimSpace(r.runs(s.Paragraph.Elements)); txt != "" {
+						parts = append(parts, txt)
+					}
+				}
+			}
+			r.w("%s", strings.Join(parts, "<br>"))
+		}
+		r.w(" <a href=\"#fnref-%s\">&#8617;</a></li>\n", eid)
+	}
+	r.w("</ol>\n</section>\n")
+}
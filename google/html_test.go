@@ -0,0 +1,59 @@
+package google
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestHTML renders each testdata/html/*.json document and compares
+// the result with the matching .html file.
+func TestHTML(t *testing.T) {
+	fns, err := filepath.Glob("testdata/html/*.json")
+	Tassert(t, err == nil, err)
+	Tassert(t, len(fns) > 0)
+	image := func(id string, obj *docs.EmbeddedObject) (string, error) {
+		return "/images/" + id, nil
+	}
+	for _, fn := range fns {
+		buf, err := ioutil.ReadFile(fn)
+		Tassert(t, err == nil, err)
+		var doc docs.Document
+		err = json.Unmarshal(buf, &doc)
+		Tassert(t, err == nil, fn, err)
+		got, err := HTML(&doc, image)
+		Tassert(t, err == nil, fn, err)
+
+		golden := strings.TrimSuffix(fn, ".json") + ".html"
+		if *update {
+			err = ioutil.WriteFile(golden, got, 0644)
+			Tassert(t, err == nil, err)
+		}
+		expect, err := ioutil.ReadFile(golden)
+		Tassert(t, err == nil, err)
+		Tassert(t, string(got) == string(expect), Spf("%s:\n%s", fn, got))
+	}
+}
+
+func TestHTMLLinks(t *testing.T) {
+	for url, expect := range map[string]string{
+		"https://example.com":  "https://example.com",
+		"HTTP://example.com":   "HTTP://example.com",
+		"mailto:a@example.com": "mailto:a@example.com",
+		"javascript:alert(1)":  "",
+		" javascript:x":        "",
+		"data:text/html,hi":    "",
+		"/relative":            "",
+	} {
+		got := linkHref(&docs.Link{Url: url})
+		Tassert(t, got == expect, Spf("%q: %q", url, got))
+	}
+}
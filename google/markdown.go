@@ -0,0 +1,130 @@
+package google
+
+import (
+	"strings"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// Markdown renders the body of doc as Markdown.  Headings, lists,
+// bold, italic, links and tables are kept; other formatting is
+// dropped.
+func Markdown(doc *docs.Document) string {
+	var sb strings.Builder
+	if doc.Body != nil {
+		mdElements(&sb, doc, doc.Body.Content)
+	}
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+func mdElements(sb *strings.Builder, doc *docs.Document, els []*docs.StructuralElement) {
+	for _, s := range els {
+		switch {
+		case s.Paragraph != nil:
+			mdParagraph(sb, doc, s.Paragraph)
+		case s.Table != nil:
+			mdTable(sb, doc, s.Table)
+		}
+	}
+}
+
+var mdHeadings = map[string]string{
+	"TITLE":     "# ",
+	"SUBTITLE":  "## ",
+	"HEADING_1": "# ",
+	"HEADING_2": "## ",
+	"HEADING_3": "### ",
+	"HEADING_4": "#### ",
+	"HEADING_5": "##### ",
+	"HEADING_6": "###### ",
+}
+
+func mdParagraph(sb *strings.Builder, doc *docs.Document, p *docs.Paragraph) {
+	txt := mdRuns(p.Elements)
+	if strings.TrimSpace(txt) == "" {
+		sb.WriteString("\n")
+		return
+	}
+	if p.Bullet != nil {
+		level := int(p.Bullet.NestingLevel)
+		sb.WriteString(strings.Repeat("  ", level))
+		if listOrdered(doc, p.Bullet) {
+			sb.WriteString("1. ")
+		} else {
+			sb.WriteString("- ")
+		}
+	} else if p.ParagraphStyle != nil {
+		sb.WriteString(mdHeadings[p.ParagraphStyle.NamedStyleType])
+	}
+	sb.WriteString(txt)
+	sb.WriteString("\n")
+}
+
+// mdRuns renders the text runs of a paragraph on a single line, with
+// soft line breaks turned into Markdown hard breaks.
+func mdRuns(els []*docs.ParagraphElement) string {
+	var sb strings.Builder
+	for _, el := range els {
+		if el.TextRun == nil {
+			continue
+		}
+		txt := strings.TrimRight(el.TextRun.Content, "\n")
+		if txt == "" {
+			continue
+		}
+		txt = strings.ReplaceAll(txt, "\u000b", "  \n")
+		st := el.TextRun.TextStyle
+		if st != nil && strings.TrimSpace(txt) != "" {
+			// keep surrounding spaces outside the markers
+			lead := txt[:len(txt)-len(strings.TrimLeft(txt, " "))]
+			trail := txt[len(strings.TrimRight(txt, " ")):]
+			core := strings.TrimSpace(txt)
+			if st.Bold {
+				core = "**" + core + "**"
+			}
+			if st.Italic {
+				core = "_" + core + "_"
+			}
+			if st.Link != nil && st.Link.Url != "" {
+				core = "[" + core + "](" + st.Link.Url + ")"
+			}
+			txt = lead + core + trail
+		}
+		sb.WriteString(txt)
+	}
+	return sb.String()
+}
+
+// listOrdered returns true if the bullet's list level is numbered.
+func listOrdered(doc *docs.Document, b *docs.Bullet) bool {
+	l, ok := doc.Lists[b.ListId]
+	if !ok || l.ListProperties == nil {
+		return false
+	}
+	levels := l.ListProperties.NestingLevels
+	if int(b.NestingLevel) >= len(levels) {
+		return false
+	}
+	g := levels[b.NestingLevel].GlyphType
+	return g != "" && g != "GLYPH_TYPE_UNSPECIFIED" && g != "NONE"
+}
+
+func mdTable(sb *strings.Builder, doc *docs.Document, t *docs.Table) {
+	sb.WriteString("\n")
+	for i, row := range t.TableRows {
+		var cells []string
+		for _, cell := range row.TableCells {
+			var csb strings.Builder
+			mdElements(&csb, doc, cell.Content)
+			txt := strings.TrimSpace(csb.String())
+			txt = strings.ReplaceAll(txt, "\n", "<br>")
+			txt = strings.ReplaceAll(txt, "|", "\\|")
+			cells = append(cells, txt)
+		}
+		sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString(strings.Repeat("|---", len(cells)) + "|\n")
+		}
+	}
+	sb.WriteString("\n")
+}
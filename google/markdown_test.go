@@ -0,0 +1,47 @@
+package google
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+func para(style string, runs ...*docs.TextRun) *docs.StructuralElement {
+	p := &docs.Paragraph{ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: style}}
+	for _, r := range runs {
+		p.Elements = append(p.Elements, &docs.ParagraphElement{TextRun: r})
+	}
+	return &docs.StructuralElement{Paragraph: p}
+}
+
+func TestMarkdown(t *testing.T) {
+	bullet := para("NORMAL_TEXT", &docs.TextRun{Content: "second\n"})
+	bullet.Paragraph.Bullet = &docs.Bullet{ListId: "l1", NestingLevel: 1}
+	doc := &docs.Document{
+		Body: &docs.Body{Content: []*docs.StructuralElement{
+			para("TITLE", &docs.TextRun{Content: "Numbered Docs\n"}),
+			para("NORMAL_TEXT",
+				&docs.TextRun{Content: "See "},
+				&docs.TextRun{Content: "the spec ", TextStyle: &docs.TextStyle{
+					Bold: true,
+					Link: &docs.Link{Url: "https://example.com"},
+				}},
+				&docs.TextRun{Content: "now.\n"}),
+			para("HEADING_2", &docs.TextRun{Content: "List\n"}),
+			bullet,
+		}},
+		Lists: map[string]docs.List{
+			"l1": {ListProperties: &docs.ListProperties{NestingLevels: []*docs.NestingLevel{
+				{GlyphSymbol: "●"},
+				{GlyphType: "DECIMAL"},
+			}}},
+		},
+	}
+	expect := "# Numbered Docs\n" +
+		"See [**the spec**](https://example.com) now.\n" +
+		"## List\n" +
+		"  1. second\n"
+	got := Markdown(doc)
+	Tassert(t, got == expect, Spf("got:\n%s\nwant:\n%s", got, expect))
+}
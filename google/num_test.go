@@ -0,0 +1,18 @@
+package google
+
+import (
+	"regexp"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestRenumbered(t *testing.T) {
+	gf := &Folder{fnre: regexp.MustCompile(`^mcp-(\d+)`)}
+	Tassert(t, gf.ParseNum("mcp-17-foo") == 17)
+	Tassert(t, gf.NumPrefix("mcp-17-foo") == "mcp-17")
+	got, ok := gf.Renumbered("mcp-17-foo-3", 120)
+	Tassert(t, ok && got == "mcp-120-foo-3", got)
+	_, ok = gf.Renumbered("session-template", 120)
+	Tassert(t, !ok)
+}
@@ -42,3 +42,26 @@ func (gf *Folder) UpdatePermission(fileId string, permissionId string, permissio
 func (gf *Folder) DeletePermission(fileId string, permissionId string) error {
 	return gf.drive.Permissions.Delete(fileId, permissionId).Do()
 }
+
+// ReapplyPermission grants on fileId the access described by p, a
+// permission read from another file.  Ownership can't be granted this
+// way, so owner permissions are granted as writer.
+func (gf *Folder) ReapplyPermission(fileId string, p *drive.Permission) (err error) {
+	role := p.Role
+	if role == "owner" {
+		role = "writer"
+	}
+	perm := &drive.Permission{
+		Role:     role,
+		Type:     p.Type,
+		WithLink: p.WithLink,
+	}
+	switch p.Type {
+	case "user", "group":
+		perm.Value = p.EmailAddress
+	case "domain":
+		perm.Value = p.Domain
+	}
+	_, err = gf.InsertPermission(fileId, perm)
+	return
+}
@@ -0,0 +1,46 @@
+package google
+
+import (
+	"regexp"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// placeholderre matches template placeholders of the form {{NAME}}
+// or {{NAME|format}}.
+var placeholderre = regexp.MustCompile(`\{\{([A-Z][A-Z0-9_]*)(?:\|([^{}|]*))?\}\}`)
+
+// Placeholder is a single placeholder found in a template.
+type Placeholder struct {
+	// Token is the literal text in the document, e.g.
+	// "{{SESSION_DATE|Jan 2, 2006}}".
+	Token string
+	// Name is the variable name, e.g. "SESSION_DATE".
+	Name string
+	// Format is the optional text after the pipe.
+	Format string
+}
+
+// ParsePlaceholders returns the distinct placeholders in txt in order
+// of first appearance.
+func ParsePlaceholders(txt string) (phs []Placeholder) {
+	seen := make(map[string]bool)
+	for _, m := range placeholderre.FindAllStringSubmatch(txt, -1) {
+		if seen[m[0]] {
+			continue
+		}
+		seen[m[0]] = true
+		phs = append(phs, Placeholder{Token: m[0], Name: m[1], Format: m[2]})
+	}
+	return
+}
+
+// Placeholders returns the distinct placeholders used in the
+// document.
+func (gf *Folder) Placeholders(node *Node) (phs []Placeholder, err error) {
+	defer Return(&err)
+	txt, err := gf.Doc2txt(node)
+	Ck(err)
+	phs = ParsePlaceholders(txt)
+	return
+}
@@ -0,0 +1,24 @@
+package google
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestParsePlaceholders(t *testing.T) {
+	txt := "Name: {{NAME}}\nTitle: {{TITLE}}\nDate: {{SESSION_DATE|Jan 2, 2006}}\n" +
+		"{{NAME}} again, {{lower}} and {{ SPACED }} are not placeholders\n" +
+		"Unlock: {{UNLOCK_URL}}\n"
+	got := ParsePlaceholders(txt)
+	expect := []Placeholder{
+		{Token: "{{NAME}}", Name: "NAME"},
+		{Token: "{{TITLE}}", Name: "TITLE"},
+		{Token: "{{SESSION_DATE|Jan 2, 2006}}", Name: "SESSION_DATE", Format: "Jan 2, 2006"},
+		{Token: "{{UNLOCK_URL}}", Name: "UNLOCK_URL"},
+	}
+	Tassert(t, len(got) == len(expect), Spf("%#v", got))
+	for i := range expect {
+		Tassert(t, got[i] == expect[i], Spf("%d: %#v", i, got[i]))
+	}
+}
@@ -0,0 +1,104 @@
+package google
+
+import (
+	"regexp"
+	"strings"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// fieldre matches the Drive file fields a Query may test, e.g.
+// fullText or mimeType.
+var fieldre = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// Query builds a Drive search query from clauses that are all
+// required to match.  Values are quoted and escaped, so they may come
+// from user input; field names must be identifiers from the code.
+type Query struct {
+	clauses []string
+}
+
+// NewQuery returns an empty query, which matches every file.
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// Quote returns v as a Drive query string literal.
+func Quote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+func (q *Query) add(field, op, lit string) *Query {
+	Assert(fieldre.MatchString(field), "bad query field: %q", field)
+	q.clauses = append(q.clauses, field+" "+op+" "+lit)
+	return q
+}
+
+// Eq requires field to equal value, e.g. mimeType = 'text/plain'.
+func (q *Query) Eq(field, value string) *Query {
+	return q.add(field, "=", Quote(value))
+}
+
+// Contains requires field to contain value, e.g. fullText contains
+// 'foo'.
+func (q *Query) Contains(field, value string) *Query {
+	return q.add(field, "contains", Quote(value))
+}
+
+// Is requires a boolean field to be v, e.g. trashed = false.
+func (q *Query) Is(field string, v bool) *Query {
+	lit := "false"
+	if v {
+		lit = "true"
+	}
+	return q.add(field, "=", lit)
+}
+
+// In requires value to be in the collection field, e.g. 'id' in
+// parents.
+func (q *Query) In(value, field string) *Query {
+	Assert(fieldre.MatchString(field), "bad query field: %q", field)
+	q.clauses = append(q.clauses, Quote(value)+" in "+field)
+	return q
+}
+
+// And requires sub to match as well.  A nil or empty sub adds
+// nothing.
+func (q *Query) And(sub *Query) *Query {
+	if sub != nil && len(sub.clauses) > 0 {
+		q.clauses = append(q.clauses, sub.group())
+	}
+	return q
+}
+
+// Or requires at least one of subs to match.  Empty subs are
+// ignored.
+func (q *Query) Or(subs ...*Query) *Query {
+	var alts []string
+	for _, sub := range subs {
+		if sub != nil && len(sub.clauses) > 0 {
+			alts = append(alts, sub.group())
+		}
+	}
+	switch len(alts) {
+	case 0:
+	case 1:
+		q.clauses = append(q.clauses, alts[0])
+	default:
+		q.clauses = append(q.clauses, "("+strings.Join(alts, " or ")+")")
+	}
+	return q
+}
+
+// group returns q as a single clause.
+func (q *Query) group() string {
+	if len(q.clauses) == 1 {
+		return q.clauses[0]
+	}
+	return "(" + q.String() + ")"
+}
+
+// String returns the query in Drive's query language.
+func (q *Query) String() string {
+	return strings.Join(q.clauses, " and ")
+}
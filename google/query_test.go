@@ -0,0 +1,64 @@
+package google
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+// unquote parses a Drive query string literal at the start of s and
+// returns its value and the rest of s.
+func unquote(s string) (v, rest string, ok bool) {
+	if !strings.HasPrefix(s, "'") {
+		return
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return
+			}
+			b.WriteByte(s[i])
+		case '\'':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return
+}
+
+func TestQuery(t *testing.T) {
+	q := NewQuery().In("folder1", "parents").Is("trashed", false).And(
+		NewQuery().Contains("fullText", `it's a \ test`))
+	Tassert(t, q.String() == `'folder1' in parents and trashed = false and fullText contains 'it\'s a \\ test'`, q.String())
+
+	q = NewQuery().Eq("mimeType", DocMimeType).Or(
+		NewQuery().Contains("title", "a"),
+		NewQuery().Contains("title", "b").Contains("title", "c"),
+		nil, NewQuery())
+	Tassert(t, q.String() == `mimeType = '`+DocMimeType+`' and (title contains 'a' or (title contains 'b' and title contains 'c'))`, q.String())
+
+	Tassert(t, NewQuery().And(nil).And(NewQuery()).String() == "")
+	Tassert(t, NewQuery().Or(NewQuery().Is("starred", true)).String() == "starred = true")
+
+	defer func() {
+		Tassert(t, recover() != nil, "bad field accepted")
+	}()
+	NewQuery().Eq("title = 'x' or title", "y")
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, s := range []string{"", "plain", "it's", `back\slash`, `\'`, "' or 1=1 or '", "üñî"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		lit := NewQuery().Contains("fullText", s).String()
+		Tassert(t, strings.HasPrefix(lit, "fullText contains "), lit)
+		v, rest, ok := unquote(strings.TrimPrefix(lit, "fullText contains "))
+		Tassert(t, ok && rest == "" && v == s, Spf("%q: %q", s, lit))
+	})
+}
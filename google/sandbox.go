@@ -0,0 +1,54 @@
+package google
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSandbox is returned when a sandboxed folder refuses a change.
+var ErrSandbox = errors.New("refused by sandbox")
+
+// Sandbox restricts which documents a Folder may create, change or
+// delete.  A change is allowed if the folder is one of FolderIds, or
+// if the document's number is between MinNum and MaxNum inclusive.
+// Reads are never restricted.
+type Sandbox struct {
+	MinNum    int
+	MaxNum    int
+	FolderIds []string
+}
+
+// SetSandbox restricts changes made through gf to those allowed by
+// sb.  A nil sb removes the restriction.
+func (gf *Folder) SetSandbox(sb *Sandbox) {
+	gf.sandbox = sb
+}
+
+// SetProduction marks gf as the folder of a live deployment.  A
+// sandboxed production folder refuses every change, whatever the
+// sandbox allows.
+func (gf *Folder) SetProduction(production bool) {
+	gf.production = production
+}
+
+// guard returns an error wrapping ErrSandbox if the sandbox forbids
+// changing, creating or deleting a document named name.
+func (gf *Folder) guard(name string) error {
+	sb := gf.sandbox
+	if sb == nil {
+		return nil
+	}
+	if gf.production {
+		return fmt.Errorf("%w: %s is in a production folder", ErrSandbox, name)
+	}
+	for _, id := range sb.FolderIds {
+		if id == gf.id {
+			return nil
+		}
+	}
+	num := gf.ParseNum(name)
+	if num < sb.MinNum || num > sb.MaxNum {
+		return fmt.Errorf("%w: %s is outside %d-%d", ErrSandbox, name, sb.MinNum, sb.MaxNum)
+	}
+	return nil
+}
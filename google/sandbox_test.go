@@ -0,0 +1,37 @@
+package google
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestSandbox(t *testing.T) {
+	gf := &Folder{id: "live", fnre: regexp.MustCompile(`^mcp-(\d+)`)}
+	Tassert(t, gf.guard("mcp-17-foo") == nil)
+
+	gf.SetSandbox(&Sandbox{MinNum: 99900, MaxNum: 99999})
+	Tassert(t, gf.guard("mcp-99910-test") == nil)
+	for _, name := range []string{"mcp-17-foo", "mcp-100000-foo", "mcp-template"} {
+		err := gf.guard(name)
+		Tassert(t, errors.Is(err, ErrSandbox), name, err)
+	}
+
+	_, err := gf.Rename(&Node{name: "mcp-17-foo"}, "mcp-99910-foo")
+	Tassert(t, errors.Is(err, ErrSandbox), err)
+
+	gf.SetSandbox(&Sandbox{MinNum: 99900, MaxNum: 99999, FolderIds: []string{"test"}})
+	Tassert(t, gf.guard("mcp-17-foo") != nil)
+	gf.id = "test"
+	Tassert(t, gf.guard("mcp-17-foo") == nil)
+
+	gf.SetProduction(true)
+	for _, name := range []string{"mcp-17-foo", "mcp-99910-test"} {
+		err := gf.guard(name)
+		Tassert(t, errors.Is(err, ErrSandbox), name, err)
+	}
+	gf.SetSandbox(nil)
+	Tassert(t, gf.guard("mcp-17-foo") == nil)
+}
@@ -0,0 +1,269 @@
+package google
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// TextOpts controls what TextWith includes and how it is laid out.
+type TextOpts struct {
+	// ListMarkers prefixes list items with "* " or "N. ", indented
+	// two spaces per nesting level.
+	ListMarkers bool
+	// TableLayout writes each table row on one line, with cells
+	// separated by tabs.  Otherwise each paragraph in a cell is a
+	// line of its own.
+	TableLayout bool
+	// Headers, Footers and Footnotes append the text of the page
+	// headers, page footers and footnotes after the body.  Footnote
+	// references in the text are shown as "[N]", and each footnote
+	// starts with its number.
+	Headers   bool
+	Footers   bool
+	Footnotes bool
+}
+
+// Text returns the plain text of doc: the body, including tables and
+// tables of contents, followed by any page headers, page footers and
+// footnotes.  See TextWith.
+func Text(doc *docs.Document) string {
+	return TextWith(doc, &TextOpts{Headers: true, Footers: true, Footnotes: true})
+}
+
+// TextWith returns the plain text of doc as set by opts.  The body
+// always comes first, so header lines at the top of a document can be
+// read with ParseHeaders; the other segments are each preceded by a
+// blank line.
+func TextWith(doc *docs.Document, opts *TextOpts) string {
+	w := &textWriter{doc: doc, opts: opts, notes: make(map[string]int), counts: make(map[string][]int)}
+	for _, seg := range Segments(doc) {
+		if seg.Kind == FootnoteSegment {
+			w.noteNum(seg.Id)
+		}
+	}
+	for _, seg := range Segments(doc) {
+		switch seg.Kind {
+		case BodySegment:
+		case HeaderSegment:
+			if !opts.Headers {
+				continue
+			}
+		case FooterSegment:
+			if !opts.Footers {
+				continue
+			}
+		case FootnoteSegment:
+			if !opts.Footnotes {
+				continue
+			}
+		}
+		if seg.Kind != BodySegment && w.sb.Len() > 0 {
+			w.sb.WriteString("\n")
+		}
+		if seg.Kind == FootnoteSegment {
+			w.sb.WriteString(Spf("[%d]", w.notes[seg.Id]))
+		}
+		w.elements(seg.Content)
+	}
+	// replace line tabulation unicode chars with newline
+	return strings.ReplaceAll(w.sb.String(), "\u000b", "\n")
+}
+
+type textWriter struct {
+	doc  *docs.Document
+	opts *TextOpts
+	sb   strings.Builder
+	// notes numbers footnotes by ID
+	notes map[string]int
+	// counts are the item counts of each list, by nesting level
+	counts map[string][]int
+}
+
+func (w *textWriter) noteNum(id string) int {
+	n, ok := w.notes[id]
+	if !ok {
+		n = len(w.notes) + 1
+		w.notes[id] = n
+	}
+	return n
+}
+
+func (w *textWriter) elements(els []*docs.StructuralElement) {
+	for _, s := range els {
+		switch {
+		case s.Paragraph != nil:
+			w.paragraph(s.Paragraph)
+		case s.Table != nil:
+			w.table(s.Table)
+		case s.TableOfContents != nil:
+			w.elements(s.TableOfContents.Content)
+		}
+	}
+}
+
+func (w *textWriter) paragraph(p *docs.Paragraph) {
+	if w.opts.ListMarkers && p.Bullet != nil {
+		w.sb.WriteString(w.marker(p.Bullet))
+	}
+	for _, el := range p.Elements {
+		switch {
+		case el.TextRun != nil:
+			w.sb.WriteString(el.TextRun.Content)
+		case el.FootnoteReference != nil && w.opts.Footnotes:
+			w.sb.WriteString(Spf("[%d]", w.noteNum(el.FootnoteReference.FootnoteId)))
+		}
+	}
+}
+
+// marker returns the indented list marker for a bullet, counting
+// items in numbered lists.
+func (w *textWriter) marker(b *docs.Bullet) string {
+	level := int(b.NestingLevel)
+	counts := w.counts[b.ListId]
+	for len(counts) < level+1 {
+		counts = append(counts, 0)
+	}
+	// a new item restarts the numbering of deeper levels
+	counts = counts[:level+1]
+	counts[level]++
+	w.counts[b.ListId] = counts
+	indent := strings.Repeat("  ", level)
+	if listOrdered(w.doc, b) {
+		return Spf("%s%d. ", indent, counts[level])
+	}
+	return indent + "* "
+}
+
+func (w *textWriter) table(t *docs.Table) {
+	if !w.opts.TableLayout {
+		for _, row := range t.TableRows {
+			for _, cell := range row.TableCells {
+				w.elements(cell.Content)
+			}
+		}
+		return
+	}
+	for _, row := range t.TableRows {
+		var cells []string
+		for _, cell := range row.TableCells {
+			cw := &textWriter{doc: w.doc, opts: w.opts, notes: w.notes, counts: w.counts}
+			cw.elements(cell.Content)
+			txt := strings.TrimSpace(cw.sb.String())
+			txt = strings.NewReplacer("\n", " ", "\u000b", " ", "\t", " ").Replace(txt)
+			cells = append(cells, txt)
+		}
+		w.sb.WriteString(strings.Join(cells, "\t") + "\n")
+	}
+}
+
+// TextRange is the location of some text in a document, as used by
+// the Docs API: indexes are in UTF-16 code units, and SegmentId is ""
+// for the body or the ID of a header, footer or footnote.
+type TextRange struct {
+	SegmentId  string
+	StartIndex int64
+	EndIndex   int64
+}
+
+// FindText returns the locations of txt in doc, in the order of
+// Segments.  Matches may span text runs with different styles and
+// consecutive paragraphs, and are found inside tables, but not across
+// table cells or inline objects such as images and footnote
+// references.  Tables of contents are skipped, since their text can't
+// be edited.
+func FindText(doc *docs.Document, txt string) (ranges []TextRange) {
+	return findText(doc, txt, false)
+}
+
+// FindName is like FindText, but only matches txt where it isn't
+// part of a longer name, i.e. where it isn't preceded or followed by
+// a letter, digit, hyphen or underscore.  mcp-17-foo is found in
+// "see mcp-17-foo." but not in "mcp-17-foobar".
+func FindName(doc *docs.Document, txt string) (ranges []TextRange) {
+	return findText(doc, txt, true)
+}
+
+func findText(doc *docs.Document, txt string, whole bool) (ranges []TextRange) {
+	if txt == "" {
+		return
+	}
+	for _, seg := range Segments(doc) {
+		var chunk strings.Builder
+		start, end := int64(-1), int64(-1)
+		flush := func() {
+			if start >= 0 {
+				ranges = append(ranges, findChunk(chunk.String(), txt, seg.Id, start, whole)...)
+			}
+			chunk.Reset()
+			start = -1
+		}
+		walkEditable(seg.Content, func(p *docs.Paragraph) {
+			for _, el := range p.Elements {
+				if el.TextRun == nil {
+					flush()
+					continue
+				}
+				// anything between runs, such as the start of a
+				// table, breaks the text
+				if start >= 0 && el.StartIndex != end {
+					flush()
+				}
+				if start < 0 {
+					start = el.StartIndex
+				}
+				chunk.WriteString(el.TextRun.Content)
+				end = el.EndIndex
+			}
+		})
+		flush()
+	}
+	return
+}
+
+// findChunk returns the non-overlapping matches of txt in s, a run of
+// text starting at index start.  If whole is true, matches that are
+// part of a longer name are skipped.
+func findChunk(s, txt, segId string, start int64, whole bool) (ranges []TextRange) {
+	for i := 0; ; {
+		j := strings.Index(s[i:], txt)
+		if j < 0 {
+			return
+		}
+		if whole {
+			before, _ := utf8.DecodeLastRuneInString(s[:i+j])
+			after, _ := utf8.DecodeRuneInString(s[i+j+len(txt):])
+			if nameRune(before) || nameRune(after) {
+				i += j + 1
+				continue
+			}
+		}
+		idx := start + utf16Len(s[:i+j])
+		ranges = append(ranges, TextRange{
+			SegmentId:  segId,
+			StartIndex: idx,
+			EndIndex:   idx + utf16Len(txt),
+		})
+		i += j + len(txt)
+	}
+}
+
+// nameRune returns true if r can be part of a document name.
+func nameRune(r rune) bool {
+	return r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) (n int64) {
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return
+}
@@ -0,0 +1,148 @@
+package google
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// ipara builds a paragraph from runs, indexed from start.
+func ipara(start int64, runs ...string) *docs.StructuralElement {
+	p := &docs.Paragraph{}
+	for _, r := range runs {
+		end := start + utf16Len(r)
+		p.Elements = append(p.Elements, &docs.ParagraphElement{
+			StartIndex: start,
+			EndIndex:   end,
+			TextRun:    &docs.TextRun{Content: r},
+		})
+		start = end
+	}
+	return &docs.StructuralElement{Paragraph: p}
+}
+
+func bullet(listId string, level int64, el *docs.StructuralElement) *docs.StructuralElement {
+	el.Paragraph.Bullet = &docs.Bullet{ListId: listId, NestingLevel: level}
+	return el
+}
+
+func cell(els ...*docs.StructuralElement) *docs.TableCell {
+	return &docs.TableCell{Content: els}
+}
+
+func textDoc() *docs.Document {
+	note := ipara(26, "see {{N")
+	note.Paragraph.Elements = append(note.Paragraph.Elements,
+		&docs.ParagraphElement{StartIndex: 33, EndIndex: 34, FootnoteReference: &docs.FootnoteReference{FootnoteId: "fn.1"}})
+	return &docs.Document{
+		Body: &docs.Body{Content: []*docs.StructuralElement{
+			ipara(1, "Title: ", "Café \U0001F600 {{NA", "ME}}\n"),
+			ipara(25, "\n"),
+			note,
+			{Table: &docs.Table{TableRows: []*docs.TableRow{
+				{TableCells: []*docs.TableCell{cell(ipara(40, "Time\n")), cell(ipara(46, "{{SPEAKER}}\n"), ipara(58, "room\n"))}},
+			}}},
+			bullet("l.num", 0, ipara(70, "one\n")),
+			bullet("l.num", 1, ipara(74, "one a\n")),
+			bullet("l.num", 0, ipara(80, "two\n")),
+			bullet("l.bul", 0, ipara(84, "dot\n")),
+		}},
+		Headers:   map[string]docs.Header{"h.1": {Content: []*docs.StructuralElement{ipara(0, "Page {{NAME}}\n")}}},
+		Footers:   map[string]docs.Footer{"f.1": {Content: []*docs.StructuralElement{ipara(0, "foot\n")}}},
+		Footnotes: map[string]docs.Footnote{"fn.1": {Content: []*docs.StructuralElement{ipara(0, " A note\n")}}},
+		Lists: map[string]docs.List{
+			"l.num": {ListProperties: &docs.ListProperties{NestingLevels: []*docs.NestingLevel{{GlyphType: "DECIMAL"}, {GlyphType: "ALPHA"}}}},
+		},
+	}
+}
+
+func TestText(t *testing.T) {
+	doc := textDoc()
+	got := Text(doc)
+	expect := "Title: Café 😀 {{NAME}}\n\nsee {{N[1]Time\n{{SPEAKER}}\nroom\none\none a\ntwo\ndot\n" +
+		"\nPage {{NAME}}\n\nfoot\n\n[1] A note\n"
+	Tassert(t, got == expect, Spf("%q", got))
+	Tassert(t, ParseHeaders(got)["Title"] == "Café 😀 {{NAME}}", ParseHeaders(got))
+
+	got = TextWith(doc, &TextOpts{ListMarkers: true, TableLayout: true})
+	expect = "Title: Café 😀 {{NAME}}\n\nsee {{NTime\t{{SPEAKER}} room\n1. one\n  1. one a\n2. two\n* dot\n"
+	Tassert(t, got == expect, Spf("%q", got))
+}
+
+func TestFindText(t *testing.T) {
+	doc := textDoc()
+	got := FindText(doc, "{{NAME}}")
+	// the emoji is two UTF-16 code units
+	expect := []TextRange{{StartIndex: 16, EndIndex: 24}, {SegmentId: "h.1", StartIndex: 5, EndIndex: 13}}
+	Tassert(t, len(got) == len(expect), got)
+	for i := range expect {
+		Tassert(t, got[i] == expect[i], i, got[i])
+	}
+	got = FindText(doc, "{{SPEAKER}}")
+	Tassert(t, len(got) == 1 && got[0] == TextRange{StartIndex: 46, EndIndex: 57}, got)
+	// a footnote reference breaks the text
+	Tassert(t, len(FindText(doc, "{{N[1]")) == 0)
+	Tassert(t, len(FindText(doc, "note")) == 1)
+	// but paragraph breaks don't
+	got = FindText(doc, "}}\n\nsee")
+	Tassert(t, len(got) == 1 && got[0] == TextRange{StartIndex: 22, EndIndex: 29}, got)
+	// nor do cell boundaries
+	Tassert(t, len(FindText(doc, "Time\n{{")) == 0)
+
+	// text in a table of contents is read-only
+	doc.Body.Content = append(doc.Body.Content, &docs.StructuralElement{
+		TableOfContents: &docs.TableOfContents{Content: []*docs.StructuralElement{ipara(88, "{{SPEAKER}}\n")}},
+	})
+	Tassert(t, len(FindText(doc, "{{SPEAKER}}")) == 1)
+	Tassert(t, strings.Contains(Text(doc), "dot\n{{SPEAKER}}\n"), Text(doc))
+	reqs, res := FillRequests(doc, []Fill{{Token: "{{SPEAKER}}", Text: "Ann"}})
+	Tassert(t, res.Counts["{{SPEAKER}}"] == 1 && len(reqs) == 3, res, reqs)
+}
+
+func TestFindName(t *testing.T) {
+	doc := &docs.Document{Body: &docs.Body{Content: []*docs.StructuralElement{
+		ipara(1, "Name: mcp-17-foo\n"),
+		ipara(18, "see mcp-17-foobar, mcp-17-foo-2 and (mcp-17-foo).\n"),
+	}}}
+	got := FindName(doc, "mcp-17-foo")
+	expect := []TextRange{{StartIndex: 7, EndIndex: 17}, {StartIndex: 55, EndIndex: 65}}
+	Tassert(t, len(got) == len(expect), got)
+	for i := range expect {
+		Tassert(t, got[i] == expect[i], i, got[i])
+	}
+	Tassert(t, len(FindText(doc, "mcp-17-foo")) == 4)
+	Tassert(t, len(FindName(doc, "mcp-17")) == 0)
+}
+
+func TestFillRequests(t *testing.T) {
+	doc := textDoc()
+	fills := []Fill{
+		{Token: "{{NAME}}", Text: "mcp-17-tools"},
+		{Token: "{{SPEAKER}}", Text: "Ann\r\nBob", List: true, Link: "https://example.com"},
+		{Token: "{{GONE}}", Text: "x"},
+	}
+	reqs, res := FillRequests(doc, fills)
+	Tassert(t, res.Counts["{{NAME}}"] == 2 && res.Counts["{{SPEAKER}}"] == 1, res.Counts)
+	Tassert(t, len(res.Missing) == 1 && res.Missing[0] == "{{GONE}}", res.Missing)
+
+	// body matches last to first, then the header
+	Tassert(t, len(reqs) == 11, len(reqs))
+	ins := reqs[0].InsertText
+	Tassert(t, ins.Location.Index == 47 && ins.Text == "Ann\nBob", ins)
+	del := reqs[1].DeleteContentRange.Range
+	Tassert(t, del.StartIndex == 54 && del.EndIndex == 64, del)
+	del = reqs[2].DeleteContentRange.Range
+	Tassert(t, del.StartIndex == 46 && del.EndIndex == 47, del)
+	link := reqs[3].UpdateTextStyle
+	Tassert(t, link.Fields == "link" && link.Range.StartIndex == 46 && link.Range.EndIndex == 53, link)
+	Tassert(t, reqs[4].CreateParagraphBullets.Range.EndIndex == 53, reqs[4])
+	Tassert(t, reqs[5].InsertText.Location.Index == 17, reqs[5])
+	ins = reqs[8].InsertText
+	Tassert(t, ins.Location.SegmentId == "h.1" && ins.Location.Index == 6, ins)
+
+	// a token that is its own replacement is only linked
+	reqs, _ = FillRequests(doc, []Fill{{Token: "room", Text: "room", Link: "https://example.com/room"}})
+	Tassert(t, len(reqs) == 1 && reqs[0].UpdateTextStyle.Range.StartIndex == 58, reqs)
+}
@@ -0,0 +1,123 @@
+package google
+
+import (
+	"sort"
+
+	"google.golang.org/api/docs/v1"
+)
+
+// Segment is a part of a document with its own content: the body, a
+// header, a footer or a footnote.  Id is "" for the body and
+// otherwise the header, footer or footnote ID, which the Docs API
+// calls the segment ID.
+type Segment struct {
+	Id      string
+	Kind    string
+	Content []*docs.StructuralElement
+}
+
+// Segment kinds.
+const (
+	BodySegment     = "body"
+	HeaderSegment   = "header"
+	FooterSegment   = "footer"
+	FootnoteSegment = "footnote"
+)
+
+// Segments returns doc's segments: the body, then headers and footers
+// by ID, then footnotes in the order they are referenced.
+func Segments(doc *docs.Document) (segs []Segment) {
+	if doc.Body != nil {
+		segs = append(segs, Segment{Kind: BodySegment, Content: doc.Body.Content})
+	}
+	var ids []string
+	for id := range doc.Headers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		segs = append(segs, Segment{Id: id, Kind: HeaderSegment, Content: doc.Headers[id].Content})
+	}
+	ids = nil
+	for id := range doc.Footers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		segs = append(segs, Segment{Id: id, Kind: FooterSegment, Content: doc.Footers[id].Content})
+	}
+
+	// footnotes can be referenced from any segment, including other
+	// footnotes, so keep going until no new ones turn up
+	seen := make(map[string]bool)
+	for i := 0; i < len(segs); i++ {
+		walkParagraphs(segs[i].Content, func(p *docs.Paragraph) {
+			for _, el := range p.Elements {
+				if el.FootnoteReference == nil {
+					continue
+				}
+				id := el.FootnoteReference.FootnoteId
+				fn, ok := doc.Footnotes[id]
+				if ok && !seen[id] {
+					seen[id] = true
+					segs = append(segs, Segment{Id: id, Kind: FootnoteSegment, Content: fn.Content})
+				}
+			}
+		})
+	}
+	ids = nil
+	for id := range doc.Footnotes {
+		if !seen[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		segs = append(segs, Segment{Id: id, Kind: FootnoteSegment, Content: doc.Footnotes[id].Content})
+	}
+	return
+}
+
+// walkParagraphs calls fn for each paragraph in els, in document
+// order, descending into tables and tables of contents.
+func walkParagraphs(els []*docs.StructuralElement, fn func(p *docs.Paragraph)) {
+	walk(els, true, fn)
+}
+
+// walkEditable is like walkParagraphs, but skips tables of contents,
+// whose text the Docs API won't let a batch update change.
+func walkEditable(els []*docs.StructuralElement, fn func(p *docs.Paragraph)) {
+	walk(els, false, fn)
+}
+
+func walk(els []*docs.StructuralElement, toc bool, fn func(p *docs.Paragraph)) {
+	for _, s := range els {
+		switch {
+		case s.Paragraph != nil:
+			fn(s.Paragraph)
+		case s.Table != nil:
+			for _, row := range s.Table.TableRows {
+				for _, cell := range row.TableCells {
+					walk(cell.Content, toc, fn)
+				}
+			}
+		case s.TableOfContents != nil && toc:
+			walk(s.TableOfContents.Content, toc, fn)
+		}
+	}
+}
+
+// TextRuns returns every text run in doc, in the order of Segments,
+// including those inside tables and tables of contents.
+func TextRuns(doc *docs.Document) (runs []*docs.TextRun) {
+	for _, seg := range Segments(doc) {
+		walkParagraphs(seg.Content, func(p *docs.Paragraph) {
+			for _, el := range p.Elements {
+				if el.TextRun != nil {
+					runs = append(runs, el.TextRun)
+				}
+			}
+		})
+	}
+	return
+}
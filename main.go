@@ -16,9 +16,63 @@ const usage = `docbot
 Usage:
   docbot ls 
   docbot serve 
+  docbot config check
+  docbot templates (ls|validate)
+  docbot templates show <name>
+  docbot rename <name> <newname>
+  docbot dedupe [--apply]
+  docbot alias add <alias> <name>
+  docbot alias rm <alias>
+  docbot alias ls
+  docbot import [--dry-run] [--move] <id>
+  docbot backup [--incremental] <dest>
+  docbot restore [--dry-run] <src> [<folderid>]
+  docbot trash ls
+  docbot trash restore <name>
+  docbot trash purge [--all]
+  docbot refs update
+  docbot refs backlinks <name>
+  docbot refs dangling
+  docbot refs graph [--json]
+  docbot set <name> <field>...
+  docbot drift [<name>]
+  docbot bulk-create [--dry-run] [--output=<file>] --type=<type> <schedule>
+  docbot sessions update [--dry-run]
+  docbot export --format=<fmt> [--output=<file>] <name>
+  docbot export --format=<fmt> [--output=<file>] [--title=<title>] [--doctype=<type>] [--from=<num>] [--to=<num>] [--tag=<tag>]
+
+  The schedule for bulk-create is a .csv file with a heading row, or an
+  .ics calendar; bulk-create writes a CSV of the new numbers and URLs.
+
+  sessions update records the date, time and speakers of older nomcon
+  documents, read from their Session Date/Time: and Speaker Names:
+  lines, so that they appear in /calendar.ics.
+
+  The fields given to set are Key=value pairs, where Key is a header
+  or placeholder name such as Title or SESSION_SPEAKERS.
 
   If DOCBOT_CONF is not set to a config file path, then docbot will look
-  for a file named ".docbot.conf" in the local directory.
+  for a file named ".docbot.conf" in the local directory.  The config
+  file is JSON unless its name ends in .yaml, .yml, or .toml.  Each
+  config key can be overridden by an environment variable named
+  DOCBOT_<KEY>, e.g. DOCBOT_FOLDERID or DOCBOT_SESSION_TEMPLATE.
+
+Options:
+  --all              Purge every deleted document, not just expired ones.
+  --apply            Carry out the proposed renames instead of just listing them.
+  --doctype=<type>   Only export documents of this type: misc, nomcon or cswg.
+  --dry-run          Show what would be done without changing anything.
+  --format=<fmt>     Export format: pdf or epub.
+  --from=<num>       Only export documents numbered <num> or higher.
+  --incremental      Only fetch documents changed since the backup in <dest>.
+  --json             Print the graph as JSON instead of Graphviz DOT.
+  --move             Move documents into the folder instead of copying them.
+  --output=<file>    Export to <file> instead of a name based on the selection,
+                     or write the bulk-create CSV to <file> instead of stdout.
+  --tag=<tag>        Only export documents whose Tags: header includes <tag>.
+  --title=<title>    Title for the cover page of an exported collection.
+  --to=<num>         Only export documents numbered <num> or lower.
+  --type=<type>      Type of documents to create: misc, nomcon or cswg.
 
 `
 
@@ -0,0 +1,222 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+// Aliases maps alternate names, such as the name or number a
+// document had before it was renamed, to Drive file IDs.  The table
+// is persisted as JSON in a local file.
+type Aliases struct {
+	path string
+	mu   sync.Mutex
+	m    map[string]string
+}
+
+// LoadAliases reads the alias table at path.  A missing file is an
+// empty table.
+func LoadAliases(path string) (a *Aliases, err error) {
+	defer Return(&err)
+	a = &Aliases{path: path, m: make(map[string]string)}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	Ck(err)
+	err = json.Unmarshal(buf, &a.m)
+	Ck(err, path)
+	return
+}
+
+// Get returns the file ID for alias.
+func (a *Aliases) Get(alias string) (id string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id, ok = a.m[alias]
+	return
+}
+
+// Add maps alias to id and saves the table.
+func (a *Aliases) Add(alias, id string) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m[alias] = id
+	return a.save()
+}
+
+// Rm removes alias and saves the table.
+func (a *Aliases) Rm(alias string) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.m[alias]
+	if !ok {
+		return fmt.Errorf("no such alias: %s", alias)
+	}
+	delete(a.m, alias)
+	return a.save()
+}
+
+// List returns all aliases, sorted.
+func (a *Aliases) List() (aliases []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k := range a.m {
+		aliases = append(aliases, k)
+	}
+	sort.Strings(aliases)
+	return
+}
+
+// save writes the table to a temporary file and renames it into
+// place so a crash can't leave a truncated table.  Caller must hold
+// a.mu.
+func (a *Aliases) save() (err error) {
+	defer Return(&err)
+	buf, err := json.MarshalIndent(a.m, "", "  ")
+	Ck(err)
+	tmp, err := ioutil.TempFile(filepath.Dir(a.path), ".aliases-*")
+	Ck(err)
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(buf, '\n'))
+	Ck(err)
+	err = tmp.Close()
+	Ck(err)
+	err = os.Rename(tmp.Name(), a.path)
+	Ck(err)
+	return
+}
+
+// OpenAlias returns the node that alias refers to, or nil.
+func (tx *Transaction) OpenAlias(alias string) (node *google.Node, err error) {
+	defer Return(&err)
+	if tx.Aliases == nil {
+		return
+	}
+	id, ok := tx.Aliases.Get(alias)
+	if !ok {
+		return
+	}
+	node, err = tx.GetById(id)
+	Ck(err)
+	return
+}
+
+// AliasInfo is an alias and the document it currently refers to.
+type AliasInfo struct {
+	Alias string
+	Id    string
+	// Node is nil if the document no longer exists.
+	Node *google.Node
+}
+
+// AliasList returns every alias with its document.
+func (tx *Transaction) AliasList() (infos []AliasInfo, err error) {
+	defer Return(&err)
+	if tx.Aliases == nil {
+		return
+	}
+	for _, alias := range tx.Aliases.List() {
+		id, _ := tx.Aliases.Get(alias)
+		node, err := tx.GetById(id)
+		Ck(err)
+		infos = append(infos, AliasInfo{Alias: alias, Id: id, Node: node})
+	}
+	return
+}
+
+// Resolve finds the documents that key refers to.  key is tried, in
+// order, as a full document name, a Drive file ID, a plain document
+// number, a name prefix such as "mcp-42" (matching "mcp-42-*"), and
+// lastly an alias, so that an old alias never hides a live document.
+// A plain number with no live document also finds the document that
+// had that number before it was renumbered.  The first kind that matches anything wins, so more than one node is
+// returned only if key is ambiguous.
+func (tx *Transaction) Resolve(key string) (nodes []*google.Node, err error) {
+	defer Return(&err)
+	if key == "" {
+		return
+	}
+	err = tx.loadNodes()
+	Ck(err)
+
+	node, err := tx.GetByName(key)
+	Ck(err)
+	if node != nil {
+		return []*google.Node{node}, nil
+	}
+
+	node, err = tx.GetById(key)
+	Ck(err)
+	if node != nil {
+		return []*google.Node{node}, nil
+	}
+
+	if num, err := strconv.Atoi(key); err == nil {
+		for _, n := range tx.nodes {
+			if n.Num() == num {
+				nodes = append(nodes, n)
+			}
+		}
+	} else {
+		prefix := key + "-"
+		for _, n := range tx.nodes {
+			if strings.HasPrefix(n.Name(), prefix) {
+				nodes = append(nodes, n)
+			}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].Name() < nodes[j].Name()
+		})
+	}
+	if len(nodes) > 0 {
+		return
+	}
+
+	node, err = tx.OpenAlias(key)
+	Ck(err)
+	if node != nil {
+		return []*google.Node{node}, nil
+	}
+	// a renumbered document's old number is kept as an alias with
+	// the prefix, e.g. mcp-17
+	if num, err := strconv.Atoi(key); err == nil && tx.Aliases != nil {
+		for _, alias := range tx.Aliases.List() {
+			if tx.gf.NumPrefix(alias) != alias || tx.gf.ParseNum(alias) != num {
+				continue
+			}
+			node, err = tx.OpenAlias(alias)
+			Ck(err)
+			if node != nil {
+				return []*google.Node{node}, nil
+			}
+		}
+	}
+	return
+}
+
+// CheckAlias returns an error if alias could be mistaken for a
+// document: if it is a document's name, a number, or starts with a
+// document number prefix such as mcp-5.
+func (tx *Transaction) CheckAlias(alias string) (err error) {
+	defer Return(&err)
+	existing, err := tx.GetByName(alias)
+	Ck(err)
+	Assert(existing == nil, "alias would shadow document name: %s", alias)
+	_, err = strconv.Atoi(alias)
+	Assert(err != nil, "alias would shadow document number: %s", alias)
+	err = nil
+	prefix := tx.gf.NumPrefix(alias)
+	Assert(prefix == "", "alias looks like a document number: %s", alias)
+	return
+}
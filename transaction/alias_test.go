@@ -0,0 +1,28 @@
+package transaction
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestAliases(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "aliases.json")
+	a, err := LoadAliases(fn)
+	Tassert(t, err == nil, err)
+	_, ok := a.Get("mcp-17")
+	Tassert(t, !ok)
+
+	err = a.Add("mcp-17", "abc")
+	Tassert(t, err == nil, err)
+	err = a.Add("mcp-17-old-name", "abc")
+	Tassert(t, err == nil, err)
+
+	b, err := LoadAliases(fn)
+	Tassert(t, err == nil, err)
+	id, ok := b.Get("mcp-17")
+	Tassert(t, ok && id == "abc", id)
+	id, ok = b.Get("mcp-17-old-name")
+	Tassert(t, ok && id == "abc", id)
+}
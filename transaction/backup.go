@@ -0,0 +1,79 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/drive/v2"
+)
+
+// Backup file names, relative to each document's directory in an
+// archive.
+const (
+	DocJSONFile     = "document.json"
+	DocTextFile     = "document.txt"
+	DocMarkdownFile = "document.md"
+	DocDocxFile     = "document.docx"
+	PermissionsFile = "permissions.json"
+	MetadataFile    = "metadata.json"
+)
+
+// DocFiles fetches everything a backup keeps of node, keyed by file
+// name: the Docs API JSON, plain text, Markdown, a .docx export that
+// can be uploaded again by Restore, the Drive permissions and the
+// Drive metadata.
+func (tx *Transaction) DocFiles(node *google.Node) (files map[string][]byte, err error) {
+	defer Return(&err)
+	files = make(map[string][]byte)
+
+	doc, err := tx.gf.Document(node)
+	Ck(err)
+	files[DocJSONFile], err = json.MarshalIndent(doc, "", "  ")
+	Ck(err)
+	files[DocTextFile] = []byte(google.Text(doc))
+	files[DocMarkdownFile] = []byte(google.Markdown(doc))
+
+	files[DocDocxFile], err = tx.gf.Export(node, google.DocxMimeType)
+	Ck(err)
+
+	perms, err := tx.gf.GetPermissionList(node.Id())
+	Ck(err)
+	files[PermissionsFile], err = json.MarshalIndent(perms.Items, "", "  ")
+	Ck(err)
+
+	files[MetadataFile], err = node.Metadata()
+	Ck(err)
+	return
+}
+
+// Restore uploads docx as a new document named name and then grants
+// the permissions listed in permsJSON, as written by DocFiles.
+// Permissions that can't be granted don't stop the restore; they are
+// returned as warnings.
+func (tx *Transaction) Restore(name string, docx, permsJSON []byte) (node *google.Node, warnings []string, err error) {
+	defer Return(&err)
+	existing, err := tx.GetByName(name)
+	Ck(err)
+	Assert(existing == nil, "already exists: %s", name)
+
+	node, err = tx.gf.Insert(name, google.DocxMimeType, bytes.NewReader(docx))
+	Ck(err)
+	err = tx.cachenode(node)
+	Ck(err)
+
+	if permsJSON == nil {
+		return
+	}
+	var perms []*drive.Permission
+	err = json.Unmarshal(permsJSON, &perms)
+	Ck(err, name)
+	for _, p := range perms {
+		perr := tx.gf.ReapplyPermission(node.Id(), p)
+		if perr != nil {
+			warnings = append(warnings, Spf("%s: %s %s %s: %v", name, p.Type, p.Role, p.EmailAddress+p.Domain, perr))
+		}
+	}
+	return
+}
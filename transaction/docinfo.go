@@ -0,0 +1,180 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/drive/v2"
+)
+
+// DocInfo is what docbot knows about a document, for its landing
+// page.
+type DocInfo struct {
+	Node        *google.Node
+	Headers     map[string]string
+	Permissions []string
+	Revisions   []google.Revision
+	// Backlinks are the other documents that mention this one.
+	Backlinks []*google.Node
+	// Dangling are the numbers this document mentions that no
+	// document has, if the reference index is available.
+	Dangling []int
+	// Unreplaced are the template placeholders left in the document,
+	// if it isn't itself a template.
+	Unreplaced []google.Placeholder
+	// Drift lists fields that no longer match the headers.
+	Drift []Drift
+}
+
+// HeaderKeys returns the header names in sorted order.
+func (d *DocInfo) HeaderKeys() (keys []string) {
+	for k := range d.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// DocInfo gathers headers, permissions, revisions, backlinks,
+// unreplaced placeholders and field drift for node.
+func (tx *Transaction) DocInfo(node *google.Node) (info *DocInfo, err error) {
+	defer Return(&err)
+	info = &DocInfo{Node: node}
+	doc, err := tx.gf.Document(node)
+	Ck(err)
+	txt := google.Text(doc)
+	info.Headers = google.ParseHeaders(txt)
+	if !IsTemplate(node) {
+		info.Unreplaced = google.ParsePlaceholders(txt)
+		info.Drift = drift(doc)
+	}
+	perms, err := tx.gf.GetPermissionList(node.Id())
+	Ck(err)
+	info.Permissions = PermSummary(perms.Items)
+	info.Revisions, err = tx.gf.Revisions(node)
+	Ck(err)
+	info.Backlinks, err = tx.Backlinks(node)
+	Ck(err)
+	if tx.Refs != nil {
+		idx, err := tx.Refs.Load()
+		Ck(err)
+		for _, d := range idx.Dangling() {
+			if d.From.Id == node.Id() {
+				info.Dangling = append(info.Dangling, d.Num)
+			}
+		}
+	}
+	return
+}
+
+// Backlinks returns the documents that refer to node, newest first.
+// It uses the reference index if one has been built, and otherwise
+// searches for node's number prefix, e.g. "mcp-17".
+func (tx *Transaction) Backlinks(node *google.Node) (nodes []*google.Node, err error) {
+	defer Return(&err)
+	if node.Num() == 0 {
+		return
+	}
+	var idx *RefIndex
+	if tx.Refs != nil {
+		idx, err = tx.Refs.Load()
+		Ck(err)
+	}
+	if idx != nil && idx.Updated != "" {
+		all, err := tx.AllNodes()
+		Ck(err)
+		byid := make(map[string]*google.Node)
+		for _, n := range all {
+			byid[n.Id()] = n
+		}
+		for _, e := range idx.Backlinks(node.Num()) {
+			n, ok := byid[e.Id]
+			if ok && n.Id() != node.Id() {
+				nodes = append(nodes, n)
+			}
+		}
+	} else {
+		prefix := tx.gf.NumPrefix(node.Name())
+		found, err := tx.FindNodes(google.NewQuery().Contains("fullText", prefix))
+		Ck(err)
+		for _, n := range found {
+			if n.Id() != node.Id() {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Created() > nodes[j].Created()
+	})
+	return
+}
+
+// PermSummary describes each permission in a line such as "anyone
+// with the link: writer" or "Jane Doe (jane@example.com): owner".
+func PermSummary(perms []*drive.Permission) (lines []string) {
+	for _, p := range perms {
+		var who string
+		switch p.Type {
+		case "anyone":
+			who = "anyone"
+			if p.WithLink {
+				who = "anyone with the link"
+			}
+		case "domain":
+			who = "anyone at " + p.Domain
+		default:
+			who = strings.TrimSpace(p.Name)
+			if p.EmailAddress != "" {
+				if who == "" {
+					who = p.EmailAddress
+				} else {
+					who = Spf("%s (%s)", who, p.EmailAddress)
+				}
+			}
+		}
+		lines = append(lines, Spf("%s: %s", who, p.Role))
+	}
+	return
+}
+
+// ExportFormats maps the export formats offered on a document's page
+// to their content types.
+var ExportFormats = map[string]string{
+	"txt":  "text/plain; charset=utf-8",
+	"md":   "text/markdown; charset=utf-8",
+	"json": "application/json",
+	"html": "text/html; charset=utf-8",
+}
+
+// Export returns node converted to format, one of ExportFormats.
+func (tx *Transaction) Export(node *google.Node, format string) (buf []byte, err error) {
+	defer Return(&err)
+	switch format {
+	case "txt":
+		txt, err := tx.gf.Doc2txt(node)
+		Ck(err)
+		buf = []byte(txt)
+	case "md":
+		doc, err := tx.gf.Document(node)
+		Ck(err)
+		buf = []byte(google.Markdown(doc))
+	case "json":
+		doc, err := tx.gf.Document(node)
+		Ck(err)
+		buf, err = json.MarshalIndent(doc, "", "  ")
+		Ck(err)
+	case "html":
+		doc, err := tx.gf.Document(node)
+		Ck(err)
+		buf, err = tx.HTML(doc)
+		Ck(err)
+	default:
+		err = fmt.Errorf("unknown export format: %q", format)
+		Ck(err)
+	}
+	return
+}
@@ -0,0 +1,25 @@
+package transaction
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/drive/v2"
+)
+
+func TestPermSummary(t *testing.T) {
+	got := PermSummary([]*drive.Permission{
+		{Type: "user", Role: "owner", Name: "Jane Doe", EmailAddress: "jane@example.com"},
+		{Type: "user", Role: "reader", EmailAddress: "bob@example.com"},
+		{Type: "anyone", Role: "writer", WithLink: true},
+		{Type: "domain", Role: "reader", Domain: "example.com"},
+	})
+	expect := []string{
+		"Jane Doe (jane@example.com): owner",
+		"bob@example.com: reader",
+		"anyone with the link: writer",
+		"anyone at example.com: reader",
+	}
+	Tassert(t, strings.Join(got, "\n") == strings.Join(expect, "\n"), got)
+}
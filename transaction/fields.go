@@ -0,0 +1,97 @@
+package transaction
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// HeaderField returns the placeholder name for a header key, e.g.
+// SESSION_DATE for "Session Date".
+func HeaderField(key string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(key), "_"))
+}
+
+// SetFields rewrites the fields of node that were filled in from
+// placeholders when it was created.  vals are keyed by placeholder
+// name, e.g. TITLE, and are formatted as they were at creation, so
+// {{SESSION_DATE|Jan 2, 2006}} gets a reformatted date.  It returns
+// the names of the fields changed.
+func (tx *Transaction) SetFields(node *google.Node, vals map[string]string) (set []string, err error) {
+	defer Return(&err)
+	doc, err := tx.gf.Document(node)
+	Ck(err)
+	rvals := make(map[string]string)
+	used := make(map[string]bool)
+	for _, f := range google.Fields(doc) {
+		if _, ok := vals[f.Name]; !ok {
+			continue
+		}
+		txt, err := expand(f.Placeholder, vals)
+		Ck(err, node.Name())
+		if txt == "" {
+			return nil, fmt.Errorf("%s: empty value for %s", node.Name(), f.Name)
+		}
+		rvals[google.FieldName(f.Placeholder)] = txt
+		used[f.Name] = true
+	}
+	for name := range vals {
+		if !used[name] {
+			return nil, fmt.Errorf("%s: no %s field", node.Name(), name)
+		}
+		set = append(set, name)
+	}
+	sort.Strings(set)
+	_, err = tx.gf.SetFields(node, doc, rvals)
+	Ck(err)
+	return
+}
+
+// Drift is a field whose text differs from the document's header of
+// the same name.
+type Drift struct {
+	// Field is the placeholder token, e.g. "{{TITLE}}".
+	Field  string
+	Header string
+	// Want is the header value, formatted as the field was.
+	Want string
+	Got  string
+}
+
+// Drift compares node's fields with its headers.
+func (tx *Transaction) Drift(node *google.Node) (drifts []Drift, err error) {
+	defer Return(&err)
+	doc, err := tx.gf.Document(node)
+	Ck(err)
+	return drift(doc), nil
+}
+
+// drift returns the fields in doc that don't match its headers.
+func drift(doc *docs.Document) (drifts []Drift) {
+	headers := google.ParseHeaders(google.Text(doc))
+	keys := make(map[string]string)
+	for k := range headers {
+		keys[HeaderField(k)] = k
+	}
+	for _, f := range google.Fields(doc) {
+		key, ok := keys[f.Name]
+		if !ok {
+			continue
+		}
+		want, err := expand(f.Placeholder, map[string]string{f.Name: headers[key]})
+		if err != nil {
+			// e.g. a date header that no longer parses
+			want = headers[key]
+		}
+		for _, got := range f.Values {
+			if strings.TrimSpace(got) != strings.TrimSpace(want) {
+				drifts = append(drifts, Drift{Field: f.Token, Header: key, Want: want, Got: got})
+			}
+		}
+	}
+	return
+}
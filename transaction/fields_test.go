@@ -0,0 +1,39 @@
+package transaction
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+func TestDrift(t *testing.T) {
+	run := func(start int64, txt string) *docs.StructuralElement {
+		return &docs.StructuralElement{Paragraph: &docs.Paragraph{Elements: []*docs.ParagraphElement{
+			{StartIndex: start, EndIndex: start + int64(len(txt)), TextRun: &docs.TextRun{Content: txt}},
+		}}}
+	}
+	nr := func(name string, start, end int64) docs.NamedRanges {
+		return docs.NamedRanges{Name: name, NamedRanges: []*docs.NamedRange{
+			{Name: name, Ranges: []*docs.Range{{StartIndex: start, EndIndex: end}}},
+		}}
+	}
+	doc := &docs.Document{
+		Body: &docs.Body{Content: []*docs.StructuralElement{
+			run(1, "Title: New tools\n"),
+			run(18, "Session Date: 2026-10-19\n"),
+			run(43, "\n"),
+			run(44, "Old tools on Oct 19\n"),
+		}},
+		NamedRanges: map[string]docs.NamedRanges{
+			"docbot:TITLE":              nr("docbot:TITLE", 44, 53),
+			"docbot:SESSION_DATE|Jan 2": nr("docbot:SESSION_DATE|Jan 2", 57, 63),
+			"docbot:SESSION_DATE":       nr("docbot:SESSION_DATE", 32, 42),
+			"docbot:NUM":                nr("docbot:NUM", 1, 2),
+		},
+	}
+	drifts := drift(doc)
+	Tassert(t, len(drifts) == 1, drifts)
+	Tassert(t, drifts[0] == Drift{Field: "{{TITLE}}", Header: "Title", Want: "New tools", Got: "Old tools"}, drifts[0])
+	Tassert(t, HeaderField(" Session  date") == "SESSION_DATE")
+}
@@ -0,0 +1,122 @@
+package transaction
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// imageExts maps the image types docbot keeps to file extensions.
+var imageExts = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var imageIdre = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// Images keeps local copies of the images in documents, since the
+// content URIs that the Docs API returns expire after half an hour.
+// Each image is stored as <dir>/<document ID>/<object ID>.<ext> and
+// served from the same path under baseURL.
+type Images struct {
+	dir     string
+	baseURL string
+	// get fetches a content URI; tests replace it.
+	get func(url string) (*http.Response, error)
+}
+
+// OpenImages returns the image store in dir.
+func OpenImages(dir, baseURL string) *Images {
+	return &Images{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), get: http.Get}
+}
+
+// Func returns a google.ImageFunc that saves the images of document
+// docId, downloading each one only once.  Images that can't be
+// downloaded, such as those in old revisions whose content URIs have
+// expired, are left out of the page.
+func (im *Images) Func(docId string) google.ImageFunc {
+	return func(id string, obj *docs.EmbeddedObject) (src string, err error) {
+		defer Return(&err)
+		if !imageIdre.MatchString(docId) || !imageIdre.MatchString(id) {
+			return "", fmt.Errorf("bad image id: %s/%s", docId, id)
+		}
+		dir := filepath.Join(im.dir, docId)
+		for _, ext := range imageExts {
+			fn := id + ext
+			_, err = os.Stat(filepath.Join(dir, fn))
+			if err == nil {
+				return im.url(docId, fn), nil
+			}
+		}
+		if obj.ImageProperties == nil || obj.ImageProperties.ContentUri == "" {
+			return "", nil
+		}
+
+		resp, err := im.get(obj.ImageProperties.ContentUri)
+		if err != nil {
+			log.Printf("image %s/%s: %v", docId, id, err)
+			return "", nil
+		}
+		defer resp.Body.Close()
+		ctype := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+		ext, ok := imageExts[ctype]
+		if resp.StatusCode != http.StatusOK || !ok {
+			log.Printf("image %s/%s: %s %q", docId, id, resp.Status, ctype)
+			return "", nil
+		}
+		buf, err := ioutil.ReadAll(resp.Body)
+		Ck(err)
+
+		err = os.MkdirAll(dir, 0755)
+		Ck(err)
+		tmp, err := ioutil.TempFile(dir, ".image-*")
+		Ck(err)
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(buf)
+		Ck(err)
+		err = tmp.Close()
+		Ck(err)
+		err = os.Rename(tmp.Name(), filepath.Join(dir, id+ext))
+		Ck(err)
+		return im.url(docId, id+ext), nil
+	}
+}
+
+func (im *Images) url(docId, fn string) string {
+	return Spf("%s/%s/%s", im.baseURL, docId, fn)
+}
+
+// File returns the local path of the image that Func gave src for, or
+// "" if src isn't one of the store's.
+func (im *Images) File(src string) string {
+	rel := strings.TrimPrefix(src, im.baseURL+"/")
+	if rel == src {
+		return ""
+	}
+	parts := strings.Split(rel, "/")
+	if len(parts) != 2 || !imageIdre.MatchString(parts[0]) || !imageIdre.MatchString(parts[1]) {
+		return ""
+	}
+	return filepath.Join(im.dir, parts[0], parts[1])
+}
+
+// HTML renders doc with google.HTML, keeping local copies of its
+// images if the transaction has an image store.
+func (tx *Transaction) HTML(doc *docs.Document) (buf []byte, err error) {
+	var image google.ImageFunc
+	if tx.Images != nil {
+		image = tx.Images.Func(doc.DocumentId)
+	}
+	return google.HTML(doc, image)
+}
@@ -0,0 +1,69 @@
+package transaction
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+func TestImages(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		switch r.URL.Path {
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("PNG"))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<script>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	im := OpenImages(dir, "https://docs.example.com/images/")
+	f := im.Func("doc1")
+	obj := func(uri string) *docs.EmbeddedObject {
+		return &docs.EmbeddedObject{ImageProperties: &docs.ImageProperties{ContentUri: uri}}
+	}
+
+	src, err := f("kix.a", obj(srv.URL+"/png"))
+	Tassert(t, err == nil, err)
+	Tassert(t, src == "https://docs.example.com/images/doc1/kix.a.png", src)
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "doc1", "kix.a.png"))
+	Tassert(t, err == nil && string(buf) == "PNG", err, buf)
+
+	// already saved: the expired URI isn't fetched
+	src, err = f("kix.a", obj(srv.URL+"/expired"))
+	Tassert(t, err == nil && src == "https://docs.example.com/images/doc1/kix.a.png", err, src)
+	Tassert(t, fetches == 1, fetches)
+
+	// not an image, or gone
+	for _, path := range []string{"/html", "/expired"} {
+		src, err = f("kix.b", obj(srv.URL+path))
+		Tassert(t, err == nil && src == "", path, err, src)
+	}
+
+	_, err = f("../x", obj(srv.URL+"/png"))
+	Tassert(t, err != nil)
+}
+
+func TestImagesFile(t *testing.T) {
+	im := OpenImages("/data/images", "https://docs.example.com/images")
+	Tassert(t, im.File("https://docs.example.com/images/doc1/kix.a.png") == "/data/images/doc1/kix.a.png")
+	for _, src := range []string{
+		"https://docs.example.com/images/../conf.json",
+		"https://docs.example.com/images/doc1/../../x.png",
+		"https://elsewhere.example.com/images/doc1/kix.a.png",
+	} {
+		Tassert(t, im.File(src) == "", src)
+	}
+}
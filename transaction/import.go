@@ -0,0 +1,61 @@
+package transaction
+
+import (
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+// Sources returns the Google Docs identified by id: the doc itself,
+// or every doc in it if id is a folder.
+func (tx *Transaction) Sources(id string) (srcs []*google.Node, err error) {
+	defer Return(&err)
+	src, err := tx.gf.Get(id)
+	Ck(err)
+	switch src.MimeType() {
+	case google.FolderMimeType:
+		srcs, err = tx.gf.Children(id)
+		Ck(err)
+	case google.DocMimeType:
+		srcs = []*google.Node{src}
+	default:
+		Assert(false, "%s: not a Google Doc or folder: %s", id, src.MimeType())
+	}
+	return
+}
+
+// Adopt brings src into the folder as newName, by copying it or, if
+// move is true, by moving it.  Standard headers are then written at
+// the top of the document unless it already has a Name: header, in
+// which case the old name is replaced throughout.
+func (tx *Transaction) Adopt(src *google.Node, newName, title string, move bool) (node *google.Node, err error) {
+	defer Return(&err)
+	existing, err := tx.GetByName(newName)
+	Ck(err)
+	Assert(existing == nil, "already exists: %s", newName)
+
+	if move {
+		node, err = tx.gf.Move(src, newName)
+	} else {
+		node, err = tx.gf.Copy(src, newName)
+	}
+	Ck(err)
+	err = tx.cachenode(node)
+	Ck(err)
+
+	h, err := tx.gf.GetHeaders(node)
+	Ck(err)
+	batch := tx.gf.BatchStart()
+	oldName, ok := h["Name"]
+	if ok {
+		batch.ReplaceAllTextRequest(map[string]string{oldName: newName})
+	} else {
+		headers := Spf("Name: %s\nTitle: %s\nStatus: Imported from %q on %s.\n\n",
+			newName, title, src.Name(), time.Now().Format("2006-01-02"))
+		batch.InsertTextRequest(1, headers)
+	}
+	_, err = batch.Run(node)
+	Ck(err)
+	return
+}
@@ -0,0 +1,203 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+)
+
+// ErrMissingValue is returned, wrapped, when a template uses a
+// placeholder that the creation request doesn't supply.
+var ErrMissingValue = errors.New("missing placeholder value")
+
+// ErrBadValue is returned, wrapped, when a placeholder value can't be
+// used in its format, such as a date that can't be parsed.
+var ErrBadValue = errors.New("bad placeholder value")
+
+// DocOpts describes a document to be created from a template.
+type DocOpts struct {
+	Template string
+	Filename string
+	Title    string
+	// UnlockPrefix is the unlock URL without the trailing
+	// "-<num>", e.g. "https://example.com/unlock/mcp".
+	UnlockPrefix string
+	// DocPrefix is the docbot document URL without the trailing
+	// "-<num>", e.g. "https://example.com/doc/mcp".  If empty, the
+	// DOC_URL, PREV_DOC_URL and NEXT_DOC_URL placeholders are not
+	// available.
+	DocPrefix string
+	Creator   string
+	// Vars holds user-supplied placeholder values keyed by
+	// placeholder name, e.g. "SESSION_DATE".
+	Vars map[string]string
+}
+
+// legacyNames are the bare words replaced in templates that don't use
+// {{NAME}} placeholders.
+var legacyNames = []string{"NAME", "TITLE", "SESSION_DATE", "SESSION_SPEAKERS", "UNLOCK_URL"}
+
+// dateLayouts are tried, in order, when a placeholder has a format
+// and its value needs to be parsed as a date.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02 Jan 2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"01/02/2006",
+}
+
+// VarsFromForm converts form fields to placeholder values by
+// upper-casing the field names, so session_date supplies
+// SESSION_DATE.
+func VarsFromForm(form url.Values) (vars map[string]string) {
+	vars = make(map[string]string)
+	for k, vs := range form {
+		if len(vs) == 0 {
+			continue
+		}
+		vars[strings.ToUpper(k)] = vs[0]
+	}
+	return
+}
+
+// values returns the placeholder values for a new document numbered
+// num, including computed values.  Computed values take precedence
+// over user-supplied ones.
+func values(opts *DocOpts, num int, now time.Time) (vals map[string]string) {
+	vals = make(map[string]string)
+	for k, v := range opts.Vars {
+		vals[k] = v
+	}
+	vals["NAME"] = opts.Filename
+	vals["TITLE"] = opts.Title
+	vals["NUM"] = strconv.Itoa(num)
+	vals["UNLOCK_URL"] = fmt.Sprintf("%s-%d", opts.UnlockPrefix, num)
+	vals["CREATED"] = now.Format(time.RFC3339)
+	vals["CREATED_DATE"] = now.Format("2006-01-02")
+	if opts.Creator != "" {
+		vals["CREATOR"] = opts.Creator
+	}
+	if opts.DocPrefix != "" {
+		vals["DOC_URL"] = fmt.Sprintf("%s-%d", opts.DocPrefix, num)
+		vals["NEXT_DOC_URL"] = fmt.Sprintf("%s-%d", opts.DocPrefix, num+1)
+		if num > 0 {
+			vals["PREV_DOC_URL"] = fmt.Sprintf("%s-%d", opts.DocPrefix, num-1)
+		}
+	}
+	return
+}
+
+// ListFormat is the placeholder format that turns a value into a
+// bulleted list, one item per line, e.g. {{SESSION_SPEAKERS|list}}.
+const ListFormat = "list"
+
+// DateFormat returns true if format is used as a Go time layout, as
+// any format is other than "" and ListFormat.
+func DateFormat(format string) bool {
+	return format != "" && format != ListFormat
+}
+
+// expand returns the replacement text for ph.  If ph has the list
+// format, blank lines are dropped from the value.  If ph has any
+// other format, the value is parsed as a date and reformatted using
+// the format as a Go time layout.
+func expand(ph google.Placeholder, vals map[string]string) (txt string, err error) {
+	v, ok := vals[ph.Name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrMissingValue, ph.Name)
+	}
+	if ph.Format == "" {
+		return v, nil
+	}
+	if ph.Format == ListFormat {
+		var items []string
+		for _, line := range strings.Split(strings.ReplaceAll(v, "\r\n", "\n"), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				items = append(items, line)
+			}
+		}
+		return strings.Join(items, "\n"), nil
+	}
+	t, err := ParseDate(v)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrBadValue, ph.Token, err)
+	}
+	return t.Format(ph.Format), nil
+}
+
+// ParseDate parses a date in a placeholder value, trying each of
+// dateLayouts.
+func ParseDate(v string) (t time.Time, err error) {
+	for _, layout := range dateLayouts {
+		t, err = time.Parse(layout, strings.TrimSpace(v))
+		if err == nil {
+			return
+		}
+	}
+	return t, fmt.Errorf("cannot parse %q as a date", v)
+}
+
+// replacements returns the token-to-text replacements for phs.  All
+// missing values are reported together.
+func replacements(phs []google.Placeholder, vals map[string]string) (parms map[string]string, err error) {
+	parms = make(map[string]string)
+	var missing []string
+	for _, ph := range phs {
+		txt, err := expand(ph, vals)
+		if errors.Is(err, ErrMissingValue) {
+			missing = append(missing, ph.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		parms[ph.Token] = txt
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%w: %s", ErrMissingValue, strings.Join(missing, ", "))
+	}
+	return
+}
+
+// fills returns the fills for the placeholders phs, given their
+// replacements as returned by replacements.  URLs are linked,
+// placeholders with the list format become bulleted lists, and each
+// value is kept in a named range so it can be changed later with
+// SetFields.
+func fills(phs []google.Placeholder, parms map[string]string) (fs []google.Fill) {
+	for _, ph := range phs {
+		txt, ok := parms[ph.Token]
+		if !ok {
+			continue
+		}
+		f := google.Fill{Token: ph.Token, Text: txt, List: ph.Format == ListFormat}
+		if txt != "" {
+			f.Range = google.FieldName(ph)
+		}
+		if isURL(txt) {
+			f.Link = txt
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// isURL returns true if s is an absolute http or https URL.
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
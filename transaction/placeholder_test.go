@@ -0,0 +1,81 @@
+package transaction
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestReplacements(t *testing.T) {
+	form := url.Values{}
+	form.Set("session_date", "02 Jan 2006")
+	form.Set("session_speakers", "Alice Arms, Bob Barker")
+	opts := &DocOpts{
+		Filename:     "mcp-912-test12",
+		Title:        "test 12",
+		UnlockPrefix: "http://example.com/unlock/mcp",
+		DocPrefix:    "http://example.com/doc/mcp",
+		Creator:      "alice",
+		Vars:         VarsFromForm(form),
+	}
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	vals := values(opts, 912, now)
+
+	txt := "{{NAME}} {{TITLE}} {{SESSION_DATE|January 2, 2006}} {{SESSION_SPEAKERS}} " +
+		"{{CREATED_DATE}} {{CREATOR}} {{UNLOCK_URL}} {{PREV_DOC_URL}} {{NEXT_DOC_URL}}"
+	parms, err := replacements(google.ParsePlaceholders(txt), vals)
+	Tassert(t, err == nil, err)
+	expect := map[string]string{
+		"{{NAME}}":                         "mcp-912-test12",
+		"{{TITLE}}":                        "test 12",
+		"{{SESSION_DATE|January 2, 2006}}": "January 2, 2006",
+		"{{SESSION_SPEAKERS}}":             "Alice Arms, Bob Barker",
+		"{{CREATED_DATE}}":                 "2022-06-01",
+		"{{CREATOR}}":                      "alice",
+		"{{UNLOCK_URL}}":                   "http://example.com/unlock/mcp-912",
+		"{{PREV_DOC_URL}}":                 "http://example.com/doc/mcp-911",
+		"{{NEXT_DOC_URL}}":                 "http://example.com/doc/mcp-913",
+	}
+	Tassert(t, len(parms) == len(expect), parms)
+	for k, v := range expect {
+		Tassert(t, parms[k] == v, Spf("%s: got %q want %q", k, parms[k], v))
+	}
+	Tassert(t, isURL(parms["{{UNLOCK_URL}}"]))
+	Tassert(t, !isURL(parms["{{TITLE}}"]))
+}
+
+func TestReplacementsMissing(t *testing.T) {
+	opts := &DocOpts{Filename: "mcp-912-test12", Title: "test 12"}
+	vals := values(opts, 912, time.Now())
+	phs := google.ParsePlaceholders("{{TITLE}} {{SESSION_DATE}} {{ROOM}} {{DOC_URL}}")
+	_, err := replacements(phs, vals)
+	Tassert(t, errors.Is(err, ErrMissingValue), err)
+	Tassert(t, strings.HasSuffix(err.Error(), "DOC_URL, ROOM, SESSION_DATE"), err)
+
+	vals["SESSION_DATE"] = "sometime"
+	phs = google.ParsePlaceholders("{{SESSION_DATE|2006}}")
+	_, err = replacements(phs, vals)
+	Tassert(t, errors.Is(err, ErrBadValue) && !errors.Is(err, ErrMissingValue), err)
+}
+
+func TestFills(t *testing.T) {
+	vals := map[string]string{
+		"SESSION_SPEAKERS": "Alice Arms\r\n\r\n  Bob Barker \n",
+		"UNLOCK_URL":       "http://example.com/unlock/mcp-912",
+		"TITLE":            "test 12",
+	}
+	phs := google.ParsePlaceholders("{{TITLE}} {{SESSION_SPEAKERS|list}} {{UNLOCK_URL}}")
+	parms, err := replacements(phs, vals)
+	Tassert(t, err == nil, err)
+	fs := fills(phs, parms)
+	Tassert(t, len(fs) == 3, fs)
+	Tassert(t, fs[0].Link == "" && !fs[0].List, fs[0])
+	Tassert(t, fs[1].Text == "Alice Arms\nBob Barker" && fs[1].List, Spf("%q", fs[1].Text))
+	Tassert(t, fs[2].Link == vals["UNLOCK_URL"], fs[2])
+	Tassert(t, fs[1].Range == "docbot:SESSION_SPEAKERS|list", fs[1].Range)
+}
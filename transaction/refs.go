@@ -0,0 +1,314 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+// RefEntry is one document's outgoing references.
+type RefEntry struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Num     int    `json:"num"`
+	Version int64  `json:"version"`
+	// Refs are the numbers of the documents this one mentions, in
+	// ascending order, not including itself.
+	Refs []int `json:"refs"`
+}
+
+// RefIndex is the cross-reference graph between numbered documents.
+type RefIndex struct {
+	Updated string `json:"updated"`
+	// Docs is keyed by file ID.
+	Docs map[string]*RefEntry `json:"docs"`
+}
+
+// Refs stores a RefIndex in a local JSON file.
+type Refs struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenRefs returns the reference index stored at path.  The file is
+// created by the first Save.
+func OpenRefs(path string) *Refs {
+	return &Refs{path: path}
+}
+
+// Load reads the index, returning an empty one if it has not been
+// built yet.
+func (r *Refs) Load() (idx *RefIndex, err error) {
+	defer Return(&err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx = &RefIndex{Docs: make(map[string]*RefEntry)}
+	buf, err := ioutil.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	Ck(err)
+	err = json.Unmarshal(buf, idx)
+	Ck(err, r.path)
+	if idx.Docs == nil {
+		idx.Docs = make(map[string]*RefEntry)
+	}
+	return
+}
+
+// Save replaces the stored index with idx.
+func (r *Refs) Save(idx *RefIndex) (err error) {
+	defer Return(&err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf, err := json.MarshalIndent(idx, "", "  ")
+	Ck(err)
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), ".refs-*")
+	Ck(err)
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(buf, '\n'))
+	Ck(err)
+	err = tmp.Close()
+	Ck(err)
+	err = os.Rename(tmp.Name(), r.path)
+	Ck(err)
+	return
+}
+
+var gdocre = regexp.MustCompile(`docs\.google\.com/document/(?:u/\d+/)?d/([A-Za-z0-9_-]+)`)
+
+// ExtractRefs returns the numbers of the documents that doc refers
+// to, in ascending order.  A reference is a mention of
+// "<docprefix>-<num>" in the text or in a link, a link to
+// "<baseURL>/doc/<num>", or a link to a Google Doc whose file ID is
+// in ids, which maps file IDs to numbers.
+func ExtractRefs(doc *docs.Document, docprefix, baseURL string, ids map[string]int) (nums []int) {
+	prefixre := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(docprefix) + `-(\d+)\b`)
+	base := strings.TrimSuffix(stripScheme(baseURL), "/")
+	docurlre := regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `/doc/(\d+)\b`)
+
+	seen := make(map[int]bool)
+	add := func(s string) {
+		num, err := strconv.Atoi(s)
+		if err == nil && num > 0 {
+			seen[num] = true
+		}
+	}
+	for _, run := range google.TextRuns(doc) {
+		for _, m := range prefixre.FindAllStringSubmatch(run.Content, -1) {
+			add(m[1])
+		}
+		if run.TextStyle == nil || run.TextStyle.Link == nil {
+			continue
+		}
+		url := run.TextStyle.Link.Url
+		for _, m := range prefixre.FindAllStringSubmatch(url, -1) {
+			add(m[1])
+		}
+		if m := docurlre.FindStringSubmatch(stripScheme(url)); base != "" && m != nil {
+			add(m[1])
+		}
+		if m := gdocre.FindStringSubmatch(url); m != nil {
+			if num, ok := ids[m[1]]; ok && num > 0 {
+				seen[num] = true
+			}
+		}
+	}
+	for num := range seen {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return
+}
+
+func stripScheme(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		return url[i+3:]
+	}
+	return url
+}
+
+// UpdateRefs brings idx up to date with the folder, fetching only
+// documents that are new or have changed since they were last
+// indexed.  It returns the number of documents fetched.
+func (tx *Transaction) UpdateRefs(idx *RefIndex, docprefix, baseURL string) (fetched int, err error) {
+	defer Return(&err)
+	nodes, err := tx.AllNodes()
+	Ck(err)
+	ids := make(map[string]int)
+	for _, node := range nodes {
+		if node.Num() > 0 {
+			ids[node.Id()] = node.Num()
+		}
+	}
+
+	docs := make(map[string]*RefEntry)
+	for _, node := range nodes {
+		if node.Num() == 0 || node.MimeType() != google.DocMimeType {
+			continue
+		}
+		e, ok := idx.Docs[node.Id()]
+		if !ok || e.Version != node.Version() || e.Name != node.Name() {
+			doc, err := tx.gf.Document(node)
+			Ck(err, node.Name())
+			e = &RefEntry{Id: node.Id(), Version: node.Version()}
+			for _, num := range ExtractRefs(doc, docprefix, baseURL, ids) {
+				if num != node.Num() {
+					e.Refs = append(e.Refs, num)
+				}
+			}
+			fetched++
+		}
+		e.Name = node.Name()
+		e.Num = node.Num()
+		docs[node.Id()] = e
+	}
+	idx.Docs = docs
+	idx.Updated = time.Now().UTC().Format(time.RFC3339)
+	return
+}
+
+// entries returns the indexed documents ordered by number, then name.
+func (idx *RefIndex) entries() (entries []*RefEntry) {
+	for _, e := range idx.Docs {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Num != entries[j].Num {
+			return entries[i].Num < entries[j].Num
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return
+}
+
+// Backlinks returns the documents that refer to num.
+func (idx *RefIndex) Backlinks(num int) (entries []*RefEntry) {
+	for _, e := range idx.entries() {
+		i := sort.SearchInts(e.Refs, num)
+		if i < len(e.Refs) && e.Refs[i] == num {
+			entries = append(entries, e)
+		}
+	}
+	return
+}
+
+// Dangling is a reference to a number that no document has.
+type Dangling struct {
+	From *RefEntry
+	Num  int
+}
+
+// Dangling returns every reference to a nonexistent document.
+func (idx *RefIndex) Dangling() (refs []Dangling) {
+	exists := make(map[int]bool)
+	for _, e := range idx.Docs {
+		exists[e.Num] = true
+	}
+	for _, e := range idx.entries() {
+		for _, num := range e.Refs {
+			if !exists[num] {
+				refs = append(refs, Dangling{From: e, Num: num})
+			}
+		}
+	}
+	return
+}
+
+// GraphNode is a document in a Graph.  Missing nodes stand for
+// numbers that are referred to but do not exist.
+type GraphNode struct {
+	Num     int    `json:"num"`
+	Name    string `json:"name,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+}
+
+// GraphEdge is a reference from one document to another.
+type GraphEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Graph is the reference graph in a form suitable for export.
+type Graph struct {
+	Updated string      `json:"updated"`
+	Nodes   []GraphNode `json:"nodes"`
+	Edges   []GraphEdge `json:"edges"`
+}
+
+// Graph returns the reference graph, ordered by document number.
+// Documents that share a number are merged.
+func (idx *RefIndex) Graph() (g *Graph) {
+	g = &Graph{Updated: idx.Updated, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	names := make(map[int]string)
+	edges := make(map[GraphEdge]bool)
+	for _, e := range idx.entries() {
+		if _, ok := names[e.Num]; !ok {
+			names[e.Num] = e.Name
+		}
+		for _, num := range e.Refs {
+			edges[GraphEdge{From: e.Num, To: num}] = true
+		}
+	}
+	missing := make(map[int]bool)
+	for edge := range edges {
+		g.Edges = append(g.Edges, edge)
+		if _, ok := names[edge.To]; !ok {
+			missing[edge.To] = true
+		}
+	}
+	for num, name := range names {
+		g.Nodes = append(g.Nodes, GraphNode{Num: num, Name: name})
+	}
+	for num := range missing {
+		g.Nodes = append(g.Nodes, GraphNode{Num: num, Missing: true})
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Num < g.Nodes[j].Num })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return
+}
+
+// DOT renders g in Graphviz format.  Missing documents are drawn
+// dashed.  If baseURL is not "", nodes link to their landing pages.
+func (g *Graph) DOT(baseURL string) string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph refs {\n")
+	buf.WriteString("  node [shape=box];\n")
+	for _, n := range g.Nodes {
+		label := n.Name
+		if label == "" {
+			label = strconv.Itoa(n.Num)
+		}
+		attrs := Spf("label=%s", strconv.Quote(label))
+		if n.Missing {
+			attrs += ", style=dashed"
+		} else if baseURL != "" {
+			attrs += Spf(", URL=%s", strconv.Quote(Spf("%s/doc/%d?info", baseURL, n.Num)))
+		}
+		buf.WriteString(Spf("  n%d [%s];\n", n.Num, attrs))
+	}
+	for _, e := range g.Edges {
+		buf.WriteString(Spf("  n%d -> n%d;\n", e.From, e.To))
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
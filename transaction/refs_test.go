@@ -0,0 +1,84 @@
+package transaction
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
+)
+
+func run(content, url string) *docs.ParagraphElement {
+	el := &docs.ParagraphElement{TextRun: &docs.TextRun{Content: content}}
+	if url != "" {
+		el.TextRun.TextStyle = &docs.TextStyle{Link: &docs.Link{Url: url}}
+	}
+	return el
+}
+
+func para(els ...*docs.ParagraphElement) *docs.StructuralElement {
+	return &docs.StructuralElement{Paragraph: &docs.Paragraph{Elements: els}}
+}
+
+func TestExtractRefs(t *testing.T) {
+	doc := &docs.Document{Body: &docs.Body{Content: []*docs.StructuralElement{
+		para(run("See mcp-4 and MCP-17, but not mcp-x or xmcp-5.\n", "")),
+		para(run("this link", "https://docs.example.com/doc/23"),
+			run(" and ", ""),
+			run("that one", "https://docs.google.com/document/d/abc123/edit")),
+		{Table: &docs.Table{TableRows: []*docs.TableRow{{TableCells: []*docs.TableCell{
+			{Content: []*docs.StructuralElement{para(run("mcp-4 again, mcp-99\n", ""))}},
+		}}}}},
+		para(run("elsewhere", "https://example.org/doc/31")),
+	}}}
+	ids := map[string]int{"abc123": 8}
+	got := ExtractRefs(doc, "mcp", "https://docs.example.com/", ids)
+	Tassert(t, Spf("%v", got) == "[4 8 17 23 99]", got)
+}
+
+func testIndex() *RefIndex {
+	return &RefIndex{Updated: "2026-10-19T00:00:00Z", Docs: map[string]*RefEntry{
+		"a": {Id: "a", Name: "mcp-1-intro", Num: 1, Refs: []int{2, 5}},
+		"b": {Id: "b", Name: "mcp-2-scope", Num: 2, Refs: []int{1}},
+		"c": {Id: "c", Name: "mcp-3-notes", Num: 3, Refs: []int{2}},
+	}}
+}
+
+func TestRefIndex(t *testing.T) {
+	idx := testIndex()
+
+	var names []string
+	for _, e := range idx.Backlinks(2) {
+		names = append(names, e.Name)
+	}
+	Tassert(t, strings.Join(names, " ") == "mcp-1-intro mcp-3-notes", names)
+	Tassert(t, len(idx.Backlinks(3)) == 0)
+
+	dangling := idx.Dangling()
+	Tassert(t, len(dangling) == 1, dangling)
+	Tassert(t, dangling[0].From.Num == 1 && dangling[0].Num == 5, dangling)
+
+	g := idx.Graph()
+	Tassert(t, len(g.Nodes) == 4, g.Nodes)
+	Tassert(t, g.Nodes[3].Num == 5 && g.Nodes[3].Missing, g.Nodes)
+	Tassert(t, Spf("%v", g.Edges) == "[{1 2} {1 5} {2 1} {3 2}]", g.Edges)
+
+	dot := g.DOT("https://docs.example.com")
+	Tassert(t, strings.Contains(dot, `n1 [label="mcp-1-intro", URL="https://docs.example.com/doc/1?info"];`), dot)
+	Tassert(t, strings.Contains(dot, `n5 [label="5", style=dashed];`), dot)
+	Tassert(t, strings.Contains(dot, "n3 -> n2;"), dot)
+}
+
+func TestRefsSaveLoad(t *testing.T) {
+	r := OpenRefs(filepath.Join(t.TempDir(), "refs.json"))
+	idx, err := r.Load()
+	Tassert(t, err == nil, err)
+	Tassert(t, idx.Updated == "" && len(idx.Docs) == 0, idx)
+
+	err = r.Save(testIndex())
+	Tassert(t, err == nil, err)
+	idx, err = r.Load()
+	Tassert(t, err == nil, err)
+	Tassert(t, len(idx.Docs) == 3 && idx.Docs["a"].Name == "mcp-1-intro", idx)
+}
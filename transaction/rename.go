@@ -0,0 +1,219 @@
+package transaction
+
+import (
+	"log"
+	"sort"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+// RenamePlan is a proposed rename of a single document.
+type RenamePlan struct {
+	Node    *google.Node
+	NewName string
+	Reason  string
+}
+
+// GetById returns the node with the given Drive file ID, or nil.
+func (tx *Transaction) GetById(id string) (node *google.Node, err error) {
+	defer Return(&err)
+	err = tx.loadNodes()
+	Ck(err)
+	for _, n := range tx.nodes {
+		if n.Id() == id {
+			return n, nil
+		}
+	}
+	return
+}
+
+// Rename changes the Drive title of node to newName, replaces the
+// old name wherever it appears as a whole name in the document, along
+// with the unlock link if the number changed, and records the old
+// name, and the old number if it changed and no other document has
+// it, as aliases so that /doc/ links keep working.
+func (tx *Transaction) Rename(node *google.Node, newName string) (newNode *google.Node, err error) {
+	defer Return(&err)
+	Assert(node != nil)
+	oldName := node.Name()
+	if newName == oldName {
+		return node, nil
+	}
+	existing, err := tx.GetByName(newName)
+	Ck(err)
+	Assert(existing == nil, "already exists: %s", newName)
+
+	newNode, err = tx.gf.Rename(node, newName)
+	Ck(err)
+
+	_, err = tx.gf.Fill(newNode, tx.renameFills(node, newNode))
+	Ck(err)
+
+	err = tx.renamed(node, newNode)
+	Ck(err)
+	log.Printf("renamed %s to %s", oldName, newName)
+	return
+}
+
+// renameFills returns the fills that update a document's text after
+// node was renamed to newNode.
+func (tx *Transaction) renameFills(node, newNode *google.Node) (fills []google.Fill) {
+	fills = []google.Fill{{Token: node.Name(), Text: newNode.Name(), Name: true}}
+	if tx.UnlockPrefix != "" && node.Num() > 0 && newNode.Num() != node.Num() {
+		oldURL := Spf("%s-%d", tx.UnlockPrefix, node.Num())
+		newURL := Spf("%s-%d", tx.UnlockPrefix, newNode.Num())
+		fills = append(fills, google.Fill{Token: oldURL, Text: newURL, Link: newURL, Name: true})
+	}
+	return
+}
+
+// renamed updates the cache and aliases after node was renamed to
+// newNode.
+func (tx *Transaction) renamed(node, newNode *google.Node) (err error) {
+	defer Return(&err)
+	oldName := node.Name()
+	newName := newNode.Name()
+	tx.uncache(node)
+	err = tx.cachenode(newNode)
+	Ck(err)
+
+	if tx.Aliases != nil {
+		err = tx.Aliases.Add(oldName, newNode.Id())
+		Ck(err)
+		// a document that still has the old number, e.g. the one
+		// dedupe kept, owns links to it
+		oldPrefix := tx.gf.NumPrefix(oldName)
+		if oldPrefix != "" && oldPrefix != tx.gf.NumPrefix(newName) {
+			held, err := tx.prefixHeld(oldPrefix)
+			Ck(err)
+			if !held {
+				err = tx.Aliases.Add(oldPrefix, newNode.Id())
+				Ck(err)
+			}
+		}
+	}
+	return
+}
+
+// prefixHeld returns true if a live document's number prefix, e.g.
+// mcp-17, is prefix.
+func (tx *Transaction) prefixHeld(prefix string) (held bool, err error) {
+	defer Return(&err)
+	nodes, err := tx.AllNodes()
+	Ck(err)
+	for _, n := range nodes {
+		if tx.gf.NumPrefix(n.Name()) == prefix {
+			return true, nil
+		}
+	}
+	return
+}
+
+// Renumber renames node so that its name carries num instead of its
+// current number.
+func (tx *Transaction) Renumber(node *google.Node, num int) (newNode *google.Node, err error) {
+	defer Return(&err)
+	newName, ok := tx.gf.Renumbered(node.Name(), num)
+	Assert(ok, "not a numbered document: %s", node.Name())
+	newNode, err = tx.Rename(node, newName)
+	Ck(err)
+	return
+}
+
+// uncache removes node from the cache and recomputes lastNum.
+func (tx *Transaction) uncache(node *google.Node) {
+	var newNodes []*google.Node
+	tx.lastNum = 0
+	for _, n := range tx.nodes {
+		if n.Id() == node.Id() {
+			continue
+		}
+		newNodes = append(newNodes, n)
+		if n.Num() > tx.lastNum {
+			tx.lastNum = n.Num()
+		}
+	}
+	tx.nodes = newNodes
+	if tx.byname[node.Name()] == node {
+		delete(tx.byname, node.Name())
+	}
+	// another node may share the name
+	for _, n := range tx.nodes {
+		if n.Name() == node.Name() {
+			tx.byname[n.Name()] = n
+		}
+	}
+}
+
+// Duplicates finds documents that share a number or a name and
+// proposes renames that make them unique.  In each group the oldest
+// document keeps its name; the others get the next free numbers or,
+// if unnumbered, a numeric suffix.  Templates are ignored.
+func (tx *Transaction) Duplicates() (plan []RenamePlan, err error) {
+	defer Return(&err)
+	nodes, err := tx.AllNodes()
+	Ck(err)
+	next, err := tx.NextNum()
+	Ck(err)
+
+	bynum := make(map[int][]*google.Node)
+	byname := make(map[string][]*google.Node)
+	for _, n := range nodes {
+		if IsTemplate(n) {
+			continue
+		}
+		if n.Num() > 0 {
+			bynum[n.Num()] = append(bynum[n.Num()], n)
+		} else {
+			byname[n.Name()] = append(byname[n.Name()], n)
+		}
+	}
+
+	oldestFirst := func(group []*google.Node) {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Created() < group[j].Created()
+		})
+	}
+
+	var nums []int
+	for num, group := range bynum {
+		if len(group) > 1 {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		group := bynum[num]
+		oldestFirst(group)
+		for _, n := range group[1:] {
+			newName, _ := tx.gf.Renumbered(n.Name(), next)
+			plan = append(plan, RenamePlan{
+				Node:    n,
+				NewName: newName,
+				Reason:  Spf("number %d also used by %s", num, group[0].Name()),
+			})
+			next++
+		}
+	}
+
+	var names []string
+	for name, group := range byname {
+		if len(group) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		group := byname[name]
+		oldestFirst(group)
+		for i, n := range group[1:] {
+			plan = append(plan, RenamePlan{
+				Node:    n,
+				NewName: Spf("%s-%d", name, i+2),
+				Reason:  "duplicate name",
+			})
+		}
+	}
+	return
+}
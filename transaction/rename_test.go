@@ -0,0 +1,96 @@
+package transaction
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/drive/v2"
+)
+
+// fakeTx returns a transaction over nodes with the given names and
+// IDs, which needs no Drive access as long as nothing is changed in
+// Drive.  The caller must Close it.
+func fakeTx(t *testing.T, files ...*drive.File) (tx *Transaction) {
+	gf, err := google.NewFolder(nil, "folder", regexp.MustCompile(`^mcp-(\d+)`), 1)
+	Tassert(t, err == nil, err)
+	tx = Start(gf)
+	for _, f := range files {
+		err = tx.cachenode(gf.NewNode(f))
+		Tassert(t, err == nil, err)
+	}
+	tx.loaded = true
+	tx.Aliases, err = LoadAliases(filepath.Join(t.TempDir(), "aliases.json"))
+	Tassert(t, err == nil, err)
+	return
+}
+
+func TestRenamedResolve(t *testing.T) {
+	tx := fakeTx(t,
+		&drive.File{Id: "a", Title: "mcp-17-tools"},
+		&drive.File{Id: "b", Title: "mcp-18-toys"},
+	)
+	defer tx.Close()
+
+	// renumber mcp-17-tools to 20
+	node, err := tx.GetByName("mcp-17-tools")
+	Tassert(t, err == nil && node != nil, err)
+	newName, ok := tx.gf.Renumbered(node.Name(), 20)
+	Tassert(t, ok, node.Name())
+	err = tx.renamed(node, tx.gf.NewNode(&drive.File{Id: "a", Title: newName}))
+	Tassert(t, err == nil, err)
+
+	for _, key := range []string{"mcp-20-tools", "20", "mcp-20", "mcp-17-tools", "mcp-17", "17"} {
+		nodes, err := tx.Resolve(key)
+		Tassert(t, err == nil, err)
+		Tassert(t, len(nodes) == 1 && nodes[0].Id() == "a", key, nodes)
+	}
+	next, err := tx.NextNum()
+	Tassert(t, err == nil && next == 21, next, err)
+
+	// a live document with the number wins over the alias
+	node, err = tx.GetByName("mcp-18-toys")
+	Tassert(t, err == nil && node != nil, err)
+	err = tx.renamed(node, tx.gf.NewNode(&drive.File{Id: "b", Title: "mcp-17-toys"}))
+	Tassert(t, err == nil, err)
+	for _, key := range []string{"17", "mcp-17"} {
+		nodes, err := tx.Resolve(key)
+		Tassert(t, err == nil, err)
+		Tassert(t, len(nodes) == 1 && nodes[0].Id() == "b", key, nodes)
+	}
+	// and 18 now follows the moved document
+	nodes, err := tx.Resolve("18")
+	Tassert(t, err == nil && len(nodes) == 1 && nodes[0].Id() == "b", nodes, err)
+
+	// dedupe: the old number is still held by the other copy, so
+	// it isn't aliased
+	node, err = tx.GetByName("mcp-17-toys")
+	Tassert(t, err == nil && node != nil, err)
+	err = tx.cachenode(tx.gf.NewNode(&drive.File{Id: "c", Title: "mcp-17-more"}))
+	Tassert(t, err == nil, err)
+	err = tx.renamed(node, tx.gf.NewNode(&drive.File{Id: "b", Title: "mcp-21-toys"}))
+	Tassert(t, err == nil, err)
+	id, _ := tx.Aliases.Get("mcp-17")
+	Tassert(t, id == "a", id)
+	nodes, err = tx.Resolve("17")
+	Tassert(t, err == nil && len(nodes) == 1 && nodes[0].Id() == "c", nodes, err)
+}
+
+func TestRenameFills(t *testing.T) {
+	tx := fakeTx(t)
+	defer tx.Close()
+	tx.UnlockPrefix = "http://example.com/unlock/mcp"
+	old := tx.gf.NewNode(&drive.File{Id: "a", Title: "mcp-17-tools"})
+
+	fills := tx.renameFills(old, tx.gf.NewNode(&drive.File{Id: "a", Title: "mcp-17-toys"}))
+	Tassert(t, len(fills) == 1, fills)
+	Tassert(t, fills[0].Token == "mcp-17-tools" && fills[0].Text == "mcp-17-toys" && fills[0].Name, fills)
+
+	fills = tx.renameFills(old, tx.gf.NewNode(&drive.File{Id: "a", Title: "mcp-20-tools"}))
+	Tassert(t, len(fills) == 2, fills)
+	f := fills[1]
+	Tassert(t, f.Token == "http://example.com/unlock/mcp-17", f)
+	Tassert(t, f.Text == "http://example.com/unlock/mcp-20" && f.Link == f.Text && f.Name, f)
+}
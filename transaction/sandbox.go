@@ -0,0 +1,18 @@
+package transaction
+
+import (
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/util"
+)
+
+// TestSandbox returns the sandbox tests run under.  Documents numbered
+// from util.MinTestNum to util.MaxTestNum may be changed in any
+// folder; anything may be changed in the given test folders.  Install
+// it with google.Folder.SetSandbox before doing any setup.
+func TestSandbox(folderIds ...string) *google.Sandbox {
+	return &google.Sandbox{
+		MinNum:    util.MinTestNum,
+		MaxNum:    util.MaxTestNum,
+		FolderIds: folderIds,
+	}
+}
@@ -0,0 +1,167 @@
+package transaction
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+// Drive custom properties holding a session document's schedule.
+const (
+	SessionStartProperty    = "docbot-session-start"
+	SessionEndProperty      = "docbot-session-end"
+	SessionTitleProperty    = "docbot-session-title"
+	SessionSpeakersProperty = "docbot-session-speakers"
+)
+
+// maxProperty is the most bytes Drive allows in a custom property's
+// key and value together.
+const maxProperty = 124
+
+const (
+	sessionDay  = "2006-01-02"
+	sessionTime = "2006-01-02T15:04"
+)
+
+// Session is when a session takes place and who speaks.  Times are
+// wall-clock times at the venue.
+type Session struct {
+	Start time.Time
+	// End is zero if it isn't known.
+	End time.Time
+	// AllDay is true if only the date is known.
+	AllDay   bool
+	Title    string
+	Speakers string
+}
+
+// parseSessionTime parses a date, with or without a time of day.
+func parseSessionTime(v string) (t time.Time, allDay bool, ok bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return
+	}
+	for _, layout := range []string{sessionTime, sessionDay} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, layout == sessionDay, true
+		}
+	}
+	t, err := ParseDate(v)
+	if err != nil {
+		return
+	}
+	return t, !strings.Contains(v, ":"), true
+}
+
+// SessionFromVars returns the session described by the SESSION_DATE,
+// SESSION_END, SESSION_TITLE and SESSION_SPEAKERS placeholder values,
+// or nil if there is no parsable SESSION_DATE.
+func SessionFromVars(vals map[string]string) (s *Session) {
+	start, allDay, ok := parseSessionTime(vals["SESSION_DATE"])
+	if !ok {
+		return nil
+	}
+	s = &Session{Start: start, AllDay: allDay, Title: vals["SESSION_TITLE"], Speakers: vals["SESSION_SPEAKERS"]}
+	if s.Title == "" {
+		s.Title = vals["TITLE"]
+	}
+	if end, _, ok := parseSessionTime(vals["SESSION_END"]); ok && end.After(start) {
+		s.End = end
+	}
+	s.Speakers = strings.Join(strings.Fields(strings.ReplaceAll(s.Speakers, "\n", ", ")), " ")
+	return
+}
+
+// sessionLinere matches the session lines in a document's text, e.g.
+// "Session Date/Time:  02 Jan 2006" or "Speaker Names: Ann, Bob".
+var sessionLinere = regexp.MustCompile(`(?m)^\s*(Session Date/Time|Session Date|Date/Time|Session End|Speaker Names|Session Speakers|Speakers)\s*:[ \t]*(.*?)\s*$`)
+
+// sessionLines maps the names matched by sessionLinere to
+// placeholders.
+var sessionLines = map[string]string{
+	"session date/time": "SESSION_DATE",
+	"session date":      "SESSION_DATE",
+	"date/time":         "SESSION_DATE",
+	"session end":       "SESSION_END",
+	"speaker names":     "SESSION_SPEAKERS",
+	"session speakers":  "SESSION_SPEAKERS",
+	"speakers":          "SESSION_SPEAKERS",
+}
+
+// SessionFromText reads the session lines of an existing document,
+// such as "Session Date/Time:" and "Speaker Names:", wherever they
+// are, and its Title: header.  It returns nil if there is no
+// parsable date.
+func SessionFromText(txt string) (s *Session) {
+	vals := make(map[string]string)
+	for _, m := range sessionLinere.FindAllStringSubmatch(txt, -1) {
+		name := sessionLines[strings.ToLower(m[1])]
+		if vals[name] == "" {
+			vals[name] = m[2]
+		}
+	}
+	vals["TITLE"] = google.ParseHeaders(txt)["Title"]
+	return SessionFromVars(vals)
+}
+
+// SessionFromProperties reads the session recorded on a document by
+// SetSession, using get to look up its Drive custom properties, e.g.
+// Node.Property.  It returns nil if none was recorded.
+func SessionFromProperties(get func(key string) string) (s *Session) {
+	start, allDay, ok := parseSessionTime(get(SessionStartProperty))
+	if !ok {
+		return nil
+	}
+	s = &Session{Start: start, AllDay: allDay, Title: get(SessionTitleProperty), Speakers: get(SessionSpeakersProperty)}
+	if end, _, ok := parseSessionTime(get(SessionEndProperty)); ok {
+		s.End = end
+	}
+	return
+}
+
+// Properties returns the Drive custom properties that record s.
+// Long titles and speaker lists are cut to fit.  A missing end time
+// is given as "", so SetProperties removes any old one.
+func (s *Session) Properties() (props map[string]string) {
+	layout := sessionTime
+	if s.AllDay {
+		layout = sessionDay
+	}
+	props = map[string]string{
+		SessionStartProperty:    s.Start.Format(layout),
+		SessionEndProperty:      "",
+		SessionTitleProperty:    clip(s.Title, maxProperty-len(SessionTitleProperty)),
+		SessionSpeakersProperty: clip(s.Speakers, maxProperty-len(SessionSpeakersProperty)),
+	}
+	if !s.End.IsZero() {
+		props[SessionEndProperty] = s.End.Format(layout)
+	}
+	return
+}
+
+// clip cuts s to at most n bytes without splitting a character.
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n-len("…")]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "…"
+}
+
+// SetSession records s on node, returning the updated node.
+func (tx *Transaction) SetSession(node *google.Node, s *Session) (newNode *google.Node, err error) {
+	defer Return(&err)
+	newNode, err = tx.gf.SetProperties(node, s.Properties())
+	Ck(err)
+	tx.uncache(node)
+	err = tx.cachenode(newNode)
+	Ck(err)
+	return
+}
@@ -0,0 +1,63 @@
+package transaction
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestSessionFromVars(t *testing.T) {
+	s := SessionFromVars(map[string]string{
+		"SESSION_DATE":     "2026-10-19 09:00",
+		"SESSION_END":      "2026-10-19 10:30",
+		"TITLE":            "Tools",
+		"SESSION_SPEAKERS": "Ann Arms\nBob Barker",
+	})
+	Tassert(t, s != nil)
+	Tassert(t, !s.AllDay && s.Start.Equal(time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)), s)
+	Tassert(t, s.End.Sub(s.Start) == 90*time.Minute, s)
+	Tassert(t, s.Title == "Tools" && s.Speakers == "Ann Arms, Bob Barker", s)
+	Tassert(t, SessionFromVars(map[string]string{"SESSION_DATE": "someday"}) == nil)
+	Tassert(t, SessionFromVars(map[string]string{"TITLE": "x"}) == nil)
+}
+
+func TestSessionFromText(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/mksessiondoc.txt")
+	Tassert(t, err == nil, err)
+	s := SessionFromText(string(buf))
+	Tassert(t, s != nil)
+	Tassert(t, s.AllDay && s.Start.Format("2006-01-02") == "2006-01-02", s)
+	Tassert(t, s.Title == "test 11", s.Title)
+	Tassert(t, s.Speakers == "Alice Arms, Bob Barker, Carol Carnes", s.Speakers)
+}
+
+func TestSessionProperties(t *testing.T) {
+	s := &Session{
+		Start:    time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		End:      time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+		Title:    strings.Repeat("é", 100),
+		Speakers: "Ann Arms",
+	}
+	props := s.Properties()
+	Tassert(t, props[SessionStartProperty] == "2026-10-19T09:00", props)
+	for k, v := range props {
+		Tassert(t, len(k)+len(v) <= maxProperty, k)
+	}
+	Tassert(t, strings.HasSuffix(props[SessionTitleProperty], "é…"), props[SessionTitleProperty])
+	got := SessionFromProperties(func(k string) string { return props[k] })
+	Tassert(t, got != nil && got.Start.Equal(s.Start) && got.End.Equal(s.End) && !got.AllDay, got)
+	Tassert(t, got.Speakers == "Ann Arms", got)
+
+	s.AllDay = true
+	s.End = time.Time{}
+	props = s.Properties()
+	Tassert(t, props[SessionStartProperty] == "2026-10-19", props)
+	end, ok := props[SessionEndProperty]
+	Tassert(t, ok && end == "", props)
+	got = SessionFromProperties(func(k string) string { return props[k] })
+	Tassert(t, got.AllDay, got)
+	Tassert(t, SessionFromProperties(func(string) string { return "" }) == nil)
+}
@@ -0,0 +1,95 @@
+package transaction
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+const (
+	// TemplateSuffix marks a document as a template by name, e.g.
+	// "session-template".
+	TemplateSuffix = "-template"
+	// TemplateProperty marks a document as a template when this
+	// Drive custom property is set to "true".
+	TemplateProperty = "docbot-template"
+)
+
+// ComputedNames are the placeholders docbot fills in itself; see
+// values().
+var ComputedNames = []string{
+	"NAME", "TITLE", "NUM", "UNLOCK_URL", "CREATED", "CREATED_DATE",
+	"CREATOR", "DOC_URL", "PREV_DOC_URL", "NEXT_DOC_URL",
+}
+
+// TemplateInfo describes a template document.
+type TemplateInfo struct {
+	Node         *google.Node
+	Placeholders []google.Placeholder
+	// Inputs are the placeholder names a creation request must
+	// supply, i.e. those that aren't computed.
+	Inputs  []string
+	Headers map[string]string
+	// Legacy is true if the template has no {{NAME}} placeholders
+	// and relies on bare-word replacement.
+	Legacy bool
+}
+
+// IsTemplate returns true if node is named or marked as a template.
+func IsTemplate(node *google.Node) bool {
+	return strings.HasSuffix(node.Name(), TemplateSuffix) ||
+		node.Property(TemplateProperty) == "true"
+}
+
+// Templates returns, sorted by name, every node that IsTemplate or
+// whose name is one of names.
+func (tx *Transaction) Templates(names ...string) (tmpls []*google.Node, err error) {
+	defer Return(&err)
+	nodes, err := tx.AllNodes()
+	Ck(err)
+	want := make(map[string]bool)
+	for _, name := range names {
+		want[name] = true
+	}
+	for _, n := range nodes {
+		if IsTemplate(n) || want[n.Name()] {
+			tmpls = append(tmpls, n)
+		}
+	}
+	sort.SliceStable(tmpls, func(i, j int) bool {
+		return tmpls[i].Name() < tmpls[j].Name()
+	})
+	return
+}
+
+// TemplateInfo fetches the placeholders and headers of a template.
+func (tx *Transaction) TemplateInfo(node *google.Node) (info *TemplateInfo, err error) {
+	defer Return(&err)
+	info = &TemplateInfo{Node: node}
+	info.Placeholders, err = tx.gf.Placeholders(node)
+	Ck(err)
+	info.Headers, err = tx.gf.GetHeaders(node)
+	Ck(err)
+	info.Legacy = len(info.Placeholders) == 0
+	computed := make(map[string]bool)
+	for _, name := range ComputedNames {
+		computed[name] = true
+	}
+	seen := make(map[string]bool)
+	for _, ph := range info.Placeholders {
+		if computed[ph.Name] || seen[ph.Name] {
+			continue
+		}
+		seen[ph.Name] = true
+		info.Inputs = append(info.Inputs, ph.Name)
+	}
+	return
+}
+
+// Field returns the create-form field name for a placeholder input,
+// the inverse of VarsFromForm.
+func Field(name string) string {
+	return strings.ToLower(name)
+}
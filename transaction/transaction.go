@@ -3,13 +3,13 @@ package transaction
 import (
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/stevegt/docbot/google"
 	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
 )
 
 type Transaction struct {
@@ -19,6 +19,24 @@ type Transaction struct {
 	lastNum int
 	start   time.Time
 	loaded  bool
+	// Aliases, if not nil, records old names of renamed documents.
+	Aliases *Aliases
+	// Archive, if not "", is the Drive folder that Rm moves documents
+	// to instead of the Drive trash.
+	Archive string
+	// Audit, if not nil, records deletes, restores and purges, with
+	// Actor as the person responsible.
+	Audit *Audit
+	Actor string
+	// Refs, if not nil, is the cross-reference index.
+	Refs *Refs
+	// Images, if not nil, keeps copies of the images in rendered
+	// documents.
+	Images *Images
+	// UnlockPrefix, if not "", is the unlock URL without the
+	// trailing number, as in DocOpts; Rename uses it to update the
+	// unlock link of a renumbered document.
+	UnlockPrefix string
 }
 
 var mu sync.Mutex
@@ -58,7 +76,7 @@ func (tx *Transaction) AllNodes() (nodes []*google.Node, err error) {
 
 	if !tx.loaded {
 		// populate node list
-		nodes, err := tx.gf.QueryNodes("")
+		nodes, err := tx.gf.QueryNodes(nil)
 		Ck(err)
 		for _, node := range nodes {
 			err = tx.cachenode(node)
@@ -72,10 +90,20 @@ func (tx *Transaction) AllNodes() (nodes []*google.Node, err error) {
 	return tx.nodes, nil
 }
 
-// FindNodes takes a query string and returns all matching nodes.
-func (tx *Transaction) FindNodes(query string) (nodes []*google.Node, err error) {
+// Refresh drops the cached nodes, so that the next lookup lists the
+// folder again and sees changes made elsewhere, e.g. by another
+// docbot process.
+func (tx *Transaction) Refresh() {
+	tx.nodes = []*google.Node{}
+	tx.byname = make(map[string]*google.Node)
+	tx.lastNum = 0
+	tx.loaded = false
+}
+
+// FindNodes returns all nodes matching q; see google.Query.
+func (tx *Transaction) FindNodes(q *google.Query) (nodes []*google.Node, err error) {
 	defer Return(&err)
-	nodes, err = tx.gf.QueryNodes(query)
+	nodes, err = tx.gf.QueryNodes(q)
 	Ck(err)
 	return
 }
@@ -135,7 +163,7 @@ func (tx *Transaction) cachenode(node *google.Node) (err error) {
 		// in the URL, or by an error in code; likely need a better
 		// better warning path to user and to dev
 		// XXX for now we might just add an integer suffix
-		log.Printf("duplicate filename: %s", node.Name())
+		log.Printf("duplicate filename: %s (see docbot dedupe)", node.Name())
 	}
 	tx.byname[node.Name()] = node
 	tx.nodes = append(tx.nodes, node)
@@ -154,7 +182,7 @@ func (tx *Transaction) OpenPrefix(prefix string) (node *google.Node, err error)
 	/*
 		// XXX this should work per https://developers.google.com/drive/api/v3/reference/files/list?apix=true&apix_params=%7B%22q%22%3A%22%271HcCIw7ppJZPD9GEHccnkgNYUwhAGCif6%27%20in%20parents%20and%20name%20contains%20%27mcp-3-%27%22%7D#try-it
 		// XXX but am getting "invalid query"
-		q := Spf("name contains '%s'", prefix)
+		q := google.NewQuery().Contains("title", prefix)
 		nodes, err := tx.FindNodes(q)
 		Ck(err)
 		for _, n := range nodes {
@@ -189,91 +217,144 @@ func (tx *Transaction) OpenPrefix(prefix string) (node *google.Node, err error)
 // open or create file
 // XXX pass in opts struct instead of http.Request
 func (tx *Transaction) OpenCreate(r *http.Request, template, filename, unlockPrefix, title string) (node *google.Node, err error) {
+	opts := &DocOpts{
+		Template:     template,
+		Filename:     filename,
+		Title:        title,
+		UnlockPrefix: unlockPrefix,
+		Vars:         VarsFromForm(r.Form),
+	}
+	if len(title) == 0 {
+		// XXX handle
+		log.Printf("missing title: %s, %v", r.URL, r.Form)
+	}
+	return tx.OpenCreateOpts(opts)
+}
+
+// OpenCreateOpts opens the file named opts.Filename, creating it from
+// opts.Template if it doesn't exist.
+func (tx *Transaction) OpenCreateOpts(opts *DocOpts) (node *google.Node, err error) {
 	defer Return(&err)
-	node, err = tx.GetByName(filename)
+	node, err = tx.GetByName(opts.Filename)
 	Ck(err)
 	if node == nil {
 		// file doesn't exist -- create it
-		log.Printf("creating new file: %s", filename)
-		node, err = tx.mkdoc(r, template, filename, unlockPrefix, title)
+		log.Printf("creating new file: %s", opts.Filename)
+		node, err = tx.mkdoc(opts)
 		Ck(err)
-		Assert(node != nil, "%s, %s, %s", template, filename, title)
+		Assert(node != nil, "%s, %s, %s", opts.Template, opts.Filename, opts.Title)
 	}
 	return
 }
 
-// create file
-func (tx *Transaction) mkdoc(r *http.Request, template, filename, unlockPrefix, title string) (node *google.Node, err error) {
+// docPlan is the work mkdoc will do, worked out before anything is
+// copied so that a request with missing values doesn't leave a
+// half-made doc behind.
+type docPlan struct {
+	tnode *google.Node
+	// legacy is true for templates with bare-word placeholders,
+	// which are replaced with parms
+	legacy bool
+	parms  map[string]string
+	fills  []google.Fill
+	// session is recorded on the new doc, if it has a SESSION_DATE
+	session *Session
+}
+
+func (tx *Transaction) plan(opts *DocOpts) (p *docPlan, err error) {
 	defer Return(&err)
 	// get template
-	Assert(len(template) > 0)
-	tnode, err := tx.GetByName(template)
-	Ck(err, template)
-	Assert(tnode != nil, template)
+	Assert(len(opts.Template) > 0)
+	tnode, err := tx.GetByName(opts.Template)
+	Ck(err, opts.Template)
+	Assert(tnode != nil, opts.Template)
 
-	node, err = tx.Copy(tnode, filename)
+	phs, err := tx.gf.Placeholders(tnode)
 	Ck(err)
+	vals := values(opts, tx.gf.ParseNum(opts.Filename), time.Now())
 
-	date := r.Form.Get("session_date")
-	speakers := r.Form.Get("session_speakers")
+	p = &docPlan{tnode: tnode, legacy: len(phs) == 0, session: SessionFromVars(vals)}
+	if p.legacy {
+		p.parms = make(map[string]string)
+		for _, name := range legacyNames {
+			p.parms[name] = vals[name]
+		}
+		url := vals["UNLOCK_URL"]
+		p.fills = []google.Fill{{Token: url, Text: url, Link: url}}
+	} else {
+		p.parms, err = replacements(phs, vals)
+		Ck(err, opts.Template)
+		p.fills = fills(phs, p.parms)
+	}
+	return
+}
 
-	v := url.Values{}
-	v.Set("filename", node.Name())
-	v.Set("unlock", "t")
+// Check returns the error creating a document from opts would fail
+// with before copying the template, such as ErrMissingValue or
+// ErrBadValue, without creating anything.
+func (tx *Transaction) Check(opts *DocOpts) (err error) {
+	_, err = tx.plan(opts)
+	return
+}
 
-	if len(title) == 0 {
-		// XXX handle
-		log.Printf("missing title: %s, %v", r.URL, r.Form)
-	}
+// create file
+func (tx *Transaction) mkdoc(opts *DocOpts) (node *google.Node, err error) {
+	defer Return(&err)
+	p, err := tx.plan(opts)
+	Ck(err)
 
-	unlockUrl := Spf("%s-%d", unlockPrefix, node.Num())
+	node, err = tx.Copy(p.tnode, opts.Filename)
+	Ck(err)
 
-	// generate update requests
-	parms := map[string]string{
-		"NAME":             filename,
-		"TITLE":            title,
-		"SESSION_DATE":     date,
-		"SESSION_SPEAKERS": speakers,
-		"UNLOCK_URL":       unlockUrl,
+	if p.legacy {
+		batch := tx.gf.BatchStart()
+		batch.ReplaceAllTextRequest(p.parms)
+		_, err = batch.Run(node)
+		Ck(err)
 	}
-	batch := tx.gf.BatchStart()
-	batch.ReplaceAllTextRequest(parms)
-	res, err := batch.Run(node)
+	res, err := tx.gf.Fill(node, p.fills)
 	Ck(err)
-	// XXX
-	_ = res
+	for _, tok := range res.Missing {
+		log.Printf("%s: unable to find/update %s", node.Name(), tok)
+	}
 
-	el, err := tx.gf.FindTextRun(node, unlockUrl)
+	// report anything the fills couldn't reach, e.g. a placeholder
+	// broken up by an image
+	left, err := tx.gf.Placeholders(node)
 	Ck(err)
-	if el == nil {
-		log.Printf("unable to find/update link: %s", unlockUrl)
-	} else {
-		batch := tx.gf.BatchStart()
-		batch.UpdateLinkRequest(el, unlockUrl)
-		res, err := batch.Run(node)
+	if len(left) > 0 {
+		var toks []string
+		for _, ph := range left {
+			toks = append(toks, ph.Token)
+		}
+		log.Printf("%s: unreplaced placeholders: %s", node.Name(), strings.Join(toks, " "))
+	}
+
+	if p.session != nil {
+		node, err = tx.SetSession(node, p.session)
 		Ck(err)
-		// XXX
-		_ = res
 	}
 
 	return
 }
 
+// Rm deletes rmnode by moving it to the archive folder, if one is
+// set, or otherwise to the Drive trash.  It can be brought back with
+// Untrash; see Purge for permanent deletion.
 func (tx *Transaction) Rm(rmnode *google.Node) (err error) {
 	defer Return(&err)
 	if rmnode == nil {
 		return
 	}
-	err = tx.gf.Rm(rmnode)
-	Ck(err)
-	var newNodes []*google.Node
-	for _, n := range tx.nodes {
-		if n.Id() != rmnode.Id() {
-			newNodes = append(newNodes, n)
-		}
+	if tx.Archive != "" {
+		_, err = tx.gf.MoveTo(rmnode, tx.Archive, rmnode.Name())
+	} else {
+		err = tx.gf.Trash(rmnode)
 	}
-	tx.nodes = newNodes
-	delete(tx.byname, rmnode.Name())
+	Ck(err)
+	err = tx.log("rm", rmnode)
+	Ck(err)
+	tx.uncache(rmnode)
 	return
 }
 
@@ -292,3 +373,13 @@ func (tx *Transaction) Unlock(node *google.Node) (err error) {
 	Ck(err)
 	return
 }
+
+// Doc2txt returns the plain text of node.
+func (tx *Transaction) Doc2txt(node *google.Node) (txt string, err error) {
+	return tx.gf.Doc2txt(node)
+}
+
+// Document fetches node's content from the Docs API.
+func (tx *Transaction) Document(node *google.Node) (doc *docs.Document, err error) {
+	return tx.gf.Document(node)
+}
@@ -2,6 +2,7 @@ package transaction
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -22,7 +23,7 @@ const regen bool = true
 
 const (
 	credpath        = "../local/docbot-mcpbot-key.json"
-	folderId        = "1HcCIw7ppJZPD9GEHccnkgNYUwhAGCif6"
+	confpath        = "../bot/testdata/docbot.conf"
 	template        = "mcp-template"
 	sessionTemplate = "session-template"
 )
@@ -46,12 +47,28 @@ func setup() {
 }
 */
 
+// testConf is the part of the bot's test config that names the test
+// folder.
+type testConf struct {
+	Folderid   string `json:"folderid"`
+	Production bool   `json:"production"`
+}
+
 func setup(t *testing.T) (tx *Transaction) {
+	buf, err := ioutil.ReadFile(confpath)
+	Tassert(t, err == nil, err)
+	var conf testConf
+	err = json.Unmarshal(buf, &conf)
+	Tassert(t, err == nil, err)
+	Tassert(t, !conf.Production, "%s is a production config", confpath)
+
 	cbuf, err := ioutil.ReadFile(credpath)
 	Tassert(t, err == nil, err)
 
-	gf, err := google.NewFolder(cbuf, folderId, regexp.MustCompile("^mcp$"), util.MinTestNum)
+	gf, err := google.NewFolder(cbuf, conf.Folderid, regexp.MustCompile(`^mcp-(\d+)`), util.MinTestNum)
 	Tassert(t, err == nil, err)
+	// only documents in the test number range may be changed
+	gf.SetSandbox(TestSandbox())
 
 	tx = Start(gf)
 
@@ -87,7 +104,7 @@ func TestMkDoc(t *testing.T) {
 	tx := setup(t)
 	defer tx.Close()
 
-	fn := "mcp-910-test10"
+	fn := "mcp-99910-test10"
 	title := "test 10"
 	unlockBase := "http://example.com/doc/mcp"
 	v := url.Values{}
@@ -119,7 +136,7 @@ func TestMkSessionDoc(t *testing.T) {
 	tx := setup(t)
 	defer tx.Close()
 
-	fn := "mcp-911-test11"
+	fn := "mcp-99911-test11"
 	title := "test 11"
 	unlockBase := "http://example.com/doc/mcp"
 	date := "02 Jan 2006"
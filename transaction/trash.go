@@ -0,0 +1,198 @@
+package transaction
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	. "github.com/stevegt/goadapt"
+)
+
+// AuditEntry records one change to a document's existence.
+type AuditEntry struct {
+	Time   string `json:"time"`
+	Action string `json:"action"`
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	By     string `json:"by,omitempty"`
+}
+
+// Audit is an append-only log of deletes, restores and purges, kept
+// as one JSON object per line in a local file.
+type Audit struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenAudit returns the audit log at path.  The file is created on
+// the first write.
+func OpenAudit(path string) *Audit {
+	return &Audit{path: path}
+}
+
+// Log appends e, stamping it with the current time if e.Time is
+// empty.
+func (a *Audit) Log(e AuditEntry) (err error) {
+	defer Return(&err)
+	if e.Time == "" {
+		e.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	buf, err := json.Marshal(e)
+	Ck(err)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	Ck(err)
+	defer f.Close()
+	_, err = f.Write(append(buf, '\n'))
+	Ck(err)
+	return
+}
+
+// Entries returns every entry in the log, oldest first.
+func (a *Audit) Entries() (entries []AuditEntry, err error) {
+	defer Return(&err)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	Ck(err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		Ck(err, a.path)
+		entries = append(entries, e)
+	}
+	err = scanner.Err()
+	Ck(err)
+	return
+}
+
+// log records action on node if the transaction has an audit log.
+func (tx *Transaction) log(action string, node *google.Node) (err error) {
+	if tx.Audit == nil {
+		return
+	}
+	return tx.Audit.Log(AuditEntry{
+		Action: action,
+		Id:     node.Id(),
+		Name:   node.Name(),
+		By:     tx.Actor,
+	})
+}
+
+// TrashEntry is a deleted document that can still be restored.
+type TrashEntry struct {
+	Node *google.Node
+	// Deleted is when the document was deleted, in RFC 3339 format.
+	Deleted string
+	// By is who deleted it, if known.
+	By string
+}
+
+// Expired returns true if e was deleted more than retention before
+// now.
+func (e *TrashEntry) Expired(retention time.Duration, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, e.Deleted)
+	if err != nil {
+		return false
+	}
+	return now.Sub(t) > retention
+}
+
+// Purge permanently deletes node, which should already have been
+// deleted with Rm.
+func (tx *Transaction) Purge(node *google.Node) (err error) {
+	defer Return(&err)
+	err = tx.gf.Rm(node)
+	Ck(err)
+	err = tx.log("purge", node)
+	Ck(err)
+	return
+}
+
+// TrashList returns the deleted documents: those in the archive
+// folder that the audit log shows docbot deleted, if an archive
+// folder is set, otherwise those in the Drive trash.
+func (tx *Transaction) TrashList() (entries []*TrashEntry, err error) {
+	defer Return(&err)
+	var nodes []*google.Node
+	if tx.Archive != "" {
+		nodes, err = tx.gf.Children(tx.Archive)
+	} else {
+		nodes, err = tx.gf.Trashed()
+	}
+	Ck(err)
+
+	// the latest delete of each doc in the audit log
+	deletes := make(map[string]AuditEntry)
+	if tx.Audit != nil {
+		log, err := tx.Audit.Entries()
+		Ck(err)
+		for _, e := range log {
+			if e.Action == "rm" {
+				deletes[e.Id] = e
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		e := &TrashEntry{Node: node, Deleted: node.TrashedDate()}
+		a, ok := deletes[node.Id()]
+		if ok {
+			e.Deleted = a.Time
+			e.By = a.By
+		} else if tx.Archive != "" {
+			// archived by something other than docbot
+			continue
+		}
+		if e.Deleted == "" {
+			e.Deleted = node.Modified()
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Node.Name() < entries[j].Node.Name()
+	})
+	return
+}
+
+// Untrash restores the deleted document named name.  It fails if a
+// document with that name has since been created.
+func (tx *Transaction) Untrash(name string) (node *google.Node, err error) {
+	defer Return(&err)
+	existing, err := tx.GetByName(name)
+	Ck(err)
+	Assert(existing == nil, "already exists: %s", name)
+
+	entries, err := tx.TrashList()
+	Ck(err)
+	var found *google.Node
+	for _, e := range entries {
+		if e.Node.Name() == name {
+			found = e.Node
+		}
+	}
+	Assert(found != nil, "not in trash: %s", name)
+
+	if tx.Archive != "" {
+		node, err = tx.gf.Move(found, name)
+	} else {
+		node, err = tx.gf.Untrash(found.Id())
+	}
+	Ck(err)
+	err = tx.cachenode(node)
+	Ck(err)
+	err = tx.log("restore", node)
+	Ck(err)
+	return
+}
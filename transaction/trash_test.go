@@ -0,0 +1,37 @@
+package transaction
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestAudit(t *testing.T) {
+	a := OpenAudit(filepath.Join(t.TempDir(), "audit.jsonl"))
+	entries, err := a.Entries()
+	Tassert(t, err == nil, err)
+	Tassert(t, len(entries) == 0, entries)
+
+	err = a.Log(AuditEntry{Action: "rm", Id: "abc", Name: "mcp-17-foo", By: "alice"})
+	Tassert(t, err == nil, err)
+	err = a.Log(AuditEntry{Action: "restore", Id: "abc", Name: "mcp-17-foo"})
+	Tassert(t, err == nil, err)
+
+	entries, err = a.Entries()
+	Tassert(t, err == nil, err)
+	Tassert(t, len(entries) == 2, entries)
+	Tassert(t, entries[0].Action == "rm" && entries[0].By == "alice", entries[0])
+	Tassert(t, entries[1].Action == "restore" && entries[1].Time != "", entries[1])
+}
+
+func TestTrashExpired(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	e := &TrashEntry{Deleted: "2022-05-20T00:00:00Z"}
+	Tassert(t, e.Expired(week, now))
+	Tassert(t, !e.Expired(30*24*time.Hour, now))
+	e.Deleted = ""
+	Tassert(t, !e.Expired(week, now))
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	nomconre    = regexp.MustCompile(`-nomcon-\d{4}-`)
+	cswgre      = regexp.MustCompile(`-cswg-workshop-`)
+	numprefixre = regexp.MustCompile(`^[A-Za-z0-9_]+-\d+-?`)
+)
+
+// Doctypes lists the document types, as used by the create form's
+// doctype field.
+var Doctypes = []string{"misc", "nomcon", "cswg"}
+
+// Doctype derives a document's type from its filename: "nomcon" for
+// session docs (mcp-N-nomcon-YYYY-...), "cswg" for workshop docs
+// (mcp-N-cswg-workshop-...), and "misc" for everything else.
+func Doctype(name string) string {
+	switch {
+	case nomconre.MatchString(name):
+		return "nomcon"
+	case cswgre.MatchString(name):
+		return "cswg"
+	}
+	return "misc"
+}
+
+// Title derives a readable title from a filename by dropping the
+// prefix and number, e.g. "why numbered docs" for
+// "mcp-4-why-numbered-docs".
+func Title(name string) string {
+	return strings.ReplaceAll(numprefixre.ReplaceAllString(name, ""), "-", " ")
+}
+
+// SplitTags splits a Tags: header into its comma-separated tags.
+func SplitTags(h string) (tags []string) {
+	for _, tag := range strings.Split(h, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
+// HasTag returns true if tags includes tag, ignoring case.
+func HasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
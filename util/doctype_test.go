@@ -0,0 +1,21 @@
+package util
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestDoctype(t *testing.T) {
+	Tassert(t, Doctype("mcp-2-nomcon-2022-keynote") == "nomcon")
+	Tassert(t, Doctype("mcp-3-cswg-workshop-tools") == "cswg")
+	Tassert(t, Doctype("mcp-1-why-numbered-docs") == "misc")
+	Tassert(t, Title("mcp-1-why-numbered-docs") == "why numbered docs")
+}
+
+func TestTags(t *testing.T) {
+	tags := SplitTags(" tools, ,Keynote ,")
+	Tassert(t, len(tags) == 2 && tags[0] == "tools" && tags[1] == "Keynote", tags)
+	Tassert(t, HasTag(tags, "keynote"))
+	Tassert(t, !HasTag(tags, "key"))
+}
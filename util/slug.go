@@ -0,0 +1,16 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+var nonword = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug converts a title to the lower-case, dash-separated form used
+// in document filenames, e.g. "Why Numbered Docs?" becomes
+// "why-numbered-docs".
+func Slug(title string) string {
+	s := nonword.ReplaceAllString(strings.ToLower(title), "-")
+	return strings.Trim(s, "-")
+}
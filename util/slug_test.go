@@ -0,0 +1,19 @@
+package util
+
+import (
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestSlug(t *testing.T) {
+	for in, expect := range map[string]string{
+		"Why Numbered Docs?":        "why-numbered-docs",
+		"  NOMCON 2022 -- Keynote ": "nomcon-2022-keynote",
+		"Überblick & Plan":          "berblick-plan",
+		"???":                       "",
+	} {
+		got := Slug(in)
+		Tassert(t, got == expect, Spf("%q: got %q want %q", in, got, expect))
+	}
+}
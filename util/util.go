@@ -2,6 +2,11 @@ package util
 
 // . "github.com/stevegt/goadapt"
 
-// should match minnextnum in bot/testdata/bot/testdata
-// should match number(s) in web/testdata
-const MinTestNum = 99900
+// MinTestNum and MaxTestNum bound the document numbers that tests may
+// create, change or delete; see transaction.TestSandbox.
+// MinTestNum should match minnextnum in bot/testdata/docbot.conf and
+// number(s) in web/testdata.
+const (
+	MinTestNum = 99900
+	MaxTestNum = 99999
+)
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+const (
+	calendarType = "text/calendar; charset=utf-8"
+	// icsLineLen is the most octets in a content line before it is
+	// folded, per RFC 5545.
+	icsLineLen = 75
+)
+
+// calEvent is one session document in a calendar.
+type calEvent struct {
+	UID     string
+	Name    string
+	URL     string
+	Stamp   time.Time
+	Session *transaction.Session
+}
+
+// calData is a calendar independent of its encoding.
+type calData struct {
+	Title  string
+	Events []*calEvent
+}
+
+// calendar serves /calendar.ics: one event per session document,
+// linking to the document, optionally limited to sessions starting in
+// year.  Sessions are read from the properties recorded when the
+// document was made, or else from the session lines of an older
+// nomcon document.
+func (s *server) calendar(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
+	if !parseForm(w, r) {
+		return
+	}
+	var err error
+	year := 0
+	if y := r.Form.Get("year"); y != "" {
+		year, err = strconv.Atoi(y)
+		if err != nil || year < 1 || year > 9999 {
+			http.Error(w, Spf("bad year: %q", y), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx := s.b.StartTransaction()
+	defer tx.Close()
+	nodes, err := tx.AllNodes()
+	ckw(w, err)
+	conf := s.conf()
+	c := &calData{Title: Spf("%s sessions", conf.Docprefix)}
+	if year > 0 {
+		c.Title = Spf("%s %d", c.Title, year)
+	}
+	for _, n := range nodes {
+		if n.Num() == 0 || n.MimeType() != google.DocMimeType || transaction.IsTemplate(n) {
+			continue
+		}
+		sess := transaction.SessionFromProperties(n.Property)
+		if sess == nil && util.Doctype(n.Name()) == "nomcon" {
+			txt, err := s.docText(tx, n)
+			ckw(w, err)
+			sess = transaction.SessionFromText(txt)
+		}
+		if sess == nil || (year > 0 && sess.Start.Year() != year) {
+			continue
+		}
+		if sess.Title == "" {
+			sess.Title = util.Title(n.Name())
+		}
+		stamp := parseTime(n.Modified())
+		if stamp.IsZero() || stamp.Year() < 1970 {
+			stamp = parseTime(n.Created())
+		}
+		c.Events = append(c.Events, &calEvent{
+			UID:     Spf("%s/doc/%s-%d", conf.Url, conf.Docprefix, n.Num()),
+			Name:    n.Name(),
+			URL:     Spf("%s/doc/%s", conf.Url, n.Name()),
+			Stamp:   stamp,
+			Session: sess,
+		})
+	}
+
+	w.Header().Set("Content-Type", calendarType)
+	_, err = w.Write(c.ics())
+	ckw(w, err)
+}
+
+// ics encodes c as an RFC 5545 iCalendar object.  Session times are
+// floating, i.e. wall-clock times wherever the session is held.
+func (c *calData) ics() []byte {
+	events := append([]*calEvent{}, c.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Session.Start.Before(events[j].Session.Start)
+	})
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		icsFold(&buf, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//docbot//"+icsText(c.Title)+"//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", icsText(c.Title))
+	for _, e := range events {
+		sess := e.Session
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", e.Stamp.UTC().Format("20060102T150405Z"))
+		end := sess.End
+		if sess.AllDay {
+			if end.IsZero() {
+				end = sess.Start
+			}
+			// DTEND of an all-day event is exclusive
+			line("DTSTART;VALUE=DATE", sess.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE", end.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			if end.IsZero() {
+				end = sess.Start.Add(time.Hour)
+			}
+			line("DTSTART", sess.Start.Format("20060102T150405"))
+			line("DTEND", end.Format("20060102T150405"))
+		}
+		line("SUMMARY", icsText(sess.Title))
+		desc := e.URL
+		if sess.Speakers != "" {
+			desc = Spf("Speakers: %s\n%s", sess.Speakers, e.URL)
+		}
+		line("DESCRIPTION", icsText(desc))
+		line("URL", e.URL)
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+// icsText escapes a TEXT value.
+func icsText(v string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(v)
+}
+
+// icsFold writes a content line, folding it so that no line is longer
+// than icsLineLen octets, without splitting a character.
+func icsFold(buf *bytes.Buffer, line string) {
+	max := icsLineLen
+	for len(line) > max {
+		i := max
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		buf.WriteString(line[:i])
+		buf.WriteString("\r\n ")
+		line = line[i:]
+		// continuation lines start with a space
+		max = icsLineLen - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
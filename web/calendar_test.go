@@ -0,0 +1,74 @@
+package web
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestCalendarICS(t *testing.T) {
+	stamp := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := &calData{
+		Title: "mcp sessions",
+		Events: []*calEvent{{
+			UID:   "http://localhost:8080/doc/mcp-18",
+			Name:  "mcp-18-nomcon-2026-wrap-up",
+			URL:   "http://localhost:8080/doc/mcp-18-nomcon-2026-wrap-up",
+			Stamp: stamp,
+			Session: &transaction.Session{
+				Start:  time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC),
+				AllDay: true,
+				Title:  "Wrap-up",
+			},
+		}, {
+			UID:   "http://localhost:8080/doc/mcp-17",
+			Name:  "mcp-17-nomcon-2026-tools",
+			URL:   "http://localhost:8080/doc/mcp-17-nomcon-2026-tools",
+			Stamp: stamp,
+			Session: &transaction.Session{
+				Start:    time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+				Title:    "Tools; and, toys",
+				Speakers: strings.Repeat("Ann Arms, ", 10) + "Bob Barker",
+			},
+		}},
+	}
+	buf := c.ics()
+	Tassert(t, bytes.HasPrefix(buf, []byte("BEGIN:VCALENDAR\r\n")), string(buf))
+	Tassert(t, bytes.HasSuffix(buf, []byte("END:VCALENDAR\r\n")), string(buf))
+	for _, line := range strings.Split(strings.TrimSuffix(string(buf), "\r\n"), "\r\n") {
+		Tassert(t, len(line) <= icsLineLen, line)
+	}
+	// unfold
+	txt := strings.ReplaceAll(string(buf), "\r\n ", "")
+	Tassert(t, strings.Count(txt, "BEGIN:VEVENT") == 2, txt)
+	// sorted by start
+	Tassert(t, strings.Index(txt, "mcp-17") < strings.Index(txt, "mcp-18"), txt)
+	for _, want := range []string{
+		"DTSTART:20261019T090000\r\n",
+		"DTEND:20261019T100000\r\n",
+		"DTSTART;VALUE=DATE:20261020\r\n",
+		"DTEND;VALUE=DATE:20261021\r\n",
+		"DTSTAMP:20261001T120000Z\r\n",
+		`SUMMARY:Tools\; and\, toys` + "\r\n",
+		`DESCRIPTION:Speakers: Ann Arms\, `,
+		`Bob Barker\nhttp://localhost:8080/doc/mcp-17-nomcon-2026-tools` + "\r\n",
+		"URL:http://localhost:8080/doc/mcp-18-nomcon-2026-wrap-up\r\n",
+		"UID:http://localhost:8080/doc/mcp-17\r\n",
+	} {
+		Tassert(t, strings.Contains(txt, want), want)
+	}
+}
+
+func TestICSFold(t *testing.T) {
+	var buf bytes.Buffer
+	icsFold(&buf, "SUMMARY:"+strings.Repeat("ü", 80))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	Tassert(t, len(lines) == 3, lines)
+	for _, line := range lines {
+		Tassert(t, len(line) <= icsLineLen && strings.ToValidUTF8(line, "?") == line, line)
+	}
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stevegt/docbot/bot"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestSplitDocKey(t *testing.T) {
+	for in, expect := range map[string][2]string{
+		"42":             {"42", ""},
+		"42.md":          {"42", "md"},
+		"mcp-42-foo.txt": {"mcp-42-foo", "txt"},
+		"mcp-42.json":    {"mcp-42", "json"},
+		"mcp-42.html":    {"mcp-42", "html"},
+		"v1.2":           {"v1.2", ""},
+	} {
+		key, format := splitDocKey(in)
+		Tassert(t, key == expect[0] && format == expect[1], Spf("%q: %q %q", in, key, format))
+	}
+}
+
+func TestWantsDocPage(t *testing.T) {
+	b := &bot.Bot{Conf: &bot.Conf{}}
+	s := &server{b: b}
+	for _, c := range []struct {
+		docPage bool
+		query   string
+		expect  bool
+	}{
+		{false, "", false},
+		{false, "?info", true},
+		{true, "", true},
+		{true, "?redirect", false},
+		{true, "?redirect=1&info", false},
+	} {
+		b.Conf.DocPage = c.docPage
+		r := httptest.NewRequest("GET", "/doc/42"+c.query, nil)
+		err := r.ParseForm()
+		Tassert(t, err == nil, err)
+		Tassert(t, s.wantsDocPage(r) == c.expect, c)
+	}
+}
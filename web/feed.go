@@ -0,0 +1,411 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+const (
+	defaultFeedItems = 20
+	maxFeedItems     = 100
+	// maxFeedScan limits how many documents are read looking for
+	// ones with a matching tag.
+	maxFeedScan  = 200
+	excerptLen   = 280
+	feedMaxAge   = 5 * time.Minute
+	jsonFeedSpec = "https://jsonfeed.org/version/1.1"
+)
+
+// feedTypes maps each feed extension to its content type.
+var feedTypes = map[string]string{
+	"atom": "application/atom+xml; charset=utf-8",
+	"rss":  "application/rss+xml; charset=utf-8",
+	"json": "application/feed+json; charset=utf-8",
+}
+
+// feedItem is one document in a feed.
+type feedItem struct {
+	Num     int
+	Name    string
+	Title   string
+	URL     string
+	Created time.Time
+	Updated time.Time
+	Excerpt string
+	Tags    []string
+}
+
+// feedData is a feed independent of its format.
+type feedData struct {
+	Title   string
+	HomeURL string
+	SelfURL string
+	Updated time.Time
+	Items   []*feedItem
+}
+
+// excerpt returns up to n characters of txt's body, skipping the
+// header lines and collapsing whitespace.  A cut excerpt ends at a
+// word boundary with an ellipsis.
+func excerpt(txt string, n int) string {
+	lines := strings.Split(txt, "\n")
+	if len(lines) > 0 && headerLine(lines[0]) {
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				lines = lines[i:]
+				break
+			}
+		}
+	}
+	body := strings.Join(strings.Fields(strings.Join(lines, " ")), " ")
+	if utf8.RuneCountInString(body) <= n {
+		return body
+	}
+	cut := string([]rune(body)[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+var headerre = regexp.MustCompile(`^\w+:\s+`)
+
+func headerLine(line string) bool {
+	return headerre.MatchString(line)
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t.UTC()
+}
+
+type cachedText struct {
+	version int64
+	txt     string
+}
+
+// docText returns node's text, fetching it only if node has changed
+// since it was last fetched.
+func (s *server) docText(tx *transaction.Transaction, node *google.Node) (txt string, err error) {
+	defer Return(&err)
+	s.tmu.Lock()
+	c, ok := s.texts[node.Id()]
+	s.tmu.Unlock()
+	if ok && c.version == node.Version() {
+		return c.txt, nil
+	}
+	txt, err = tx.Doc2txt(node)
+	Ck(err)
+	s.tmu.Lock()
+	defer s.tmu.Unlock()
+	if s.texts == nil {
+		s.texts = make(map[string]cachedText)
+	}
+	s.texts[node.Id()] = cachedText{version: node.Version(), txt: txt}
+	return
+}
+
+// feed serves /feed.atom, /feed.rss and /feed.json: the newest
+// documents, optionally limited to a doctype or to documents whose
+// Tags: header includes tag.
+func (s *server) feed(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
+	if !parseForm(w, r) {
+		return
+	}
+	var err error
+	format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+	if feedTypes[format] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	doctype := r.Form.Get("doctype")
+	tag := r.Form.Get("tag")
+	for _, f := range []struct{ name, v string }{{"doctype", doctype}, {"tag", tag}} {
+		err = checkInput(f.name, f.v, maxQueryLen, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultFeedItems
+	if n := r.Form.Get("n"); n != "" {
+		limit, err = strconv.Atoi(n)
+		if err != nil || limit < 1 || limit > maxFeedItems {
+			http.Error(w, Spf("bad n: %q", n), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx := s.b.StartTransaction()
+	defer tx.Close()
+	nodes, err := tx.AllNodes()
+	ckw(w, err)
+	var candidates []*google.Node
+	for _, n := range nodes {
+		if n.Num() == 0 || n.MimeType() != google.DocMimeType {
+			continue
+		}
+		if doctype != "" && util.Doctype(n.Name()) != doctype {
+			continue
+		}
+		candidates = append(candidates, n)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Created() > candidates[j].Created()
+	})
+
+	conf := s.conf()
+	f := &feedData{
+		Title:   Spf("%s documents", conf.Docprefix),
+		HomeURL: conf.Url,
+		SelfURL: conf.Url + r.URL.RequestURI(),
+		Updated: time.Unix(0, 0).UTC(),
+	}
+	for i, n := range candidates {
+		if len(f.Items) == limit || i == maxFeedScan {
+			break
+		}
+		txt, err := s.docText(tx, n)
+		ckw(w, err)
+		h := google.ParseHeaders(txt)
+		tags := util.SplitTags(h["Tags"])
+		if tag != "" && !util.HasTag(tags, tag) {
+			continue
+		}
+		item := &feedItem{
+			Num:     n.Num(),
+			Name:    n.Name(),
+			Title:   h["Title"],
+			URL:     Spf("%s/doc/%s", conf.Url, n.Name()),
+			Created: parseTime(n.Created()),
+			Updated: parseTime(n.Modified()),
+			Excerpt: excerpt(txt, excerptLen),
+			Tags:    tags,
+		}
+		if item.Title == "" {
+			item.Title = util.Title(n.Name())
+		}
+		if item.Updated.Before(item.Created) {
+			item.Updated = item.Created
+		}
+		if item.Updated.After(f.Updated) {
+			f.Updated = item.Updated
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	err = serveFeed(w, r, format, f)
+	ckw(w, err)
+}
+
+// serveFeed writes f in format with validators and caching headers,
+// answering conditional requests with 304 Not Modified.
+func serveFeed(w http.ResponseWriter, r *http.Request, format string, f *feedData) (err error) {
+	defer Return(&err)
+	var body []byte
+	switch format {
+	case "atom":
+		body, err = f.atom()
+	case "rss":
+		body, err = f.rss()
+	case "json":
+		body, err = f.jsonFeed()
+	default:
+		err = fmt.Errorf("unknown feed format: %q", format)
+	}
+	Ck(err)
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", feedTypes[format])
+	w.Header().Set("ETag", Spf(`"%x"`, sum[:8]))
+	w.Header().Set("Cache-Control", Spf("public, max-age=%d", int(feedMaxAge.Seconds())))
+	http.ServeContent(w, r, "", f.Updated, bytes.NewReader(body))
+	return
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	Id         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (f *feedData) atom() (buf []byte, err error) {
+	a := atomFeed{
+		Title:   f.Title,
+		Id:      f.SelfURL,
+		Updated: f.Updated.Format(time.RFC3339),
+		Author:  f.Title,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.SelfURL},
+			{Rel: "alternate", Type: "text/html", Href: f.HomeURL},
+		},
+	}
+	for _, item := range f.Items {
+		e := atomEntry{
+			Title:     Spf("%s: %s", item.Name, item.Title),
+			Id:        item.URL,
+			Updated:   item.Updated.Format(time.RFC3339),
+			Published: item.Created.Format(time.RFC3339),
+			Link:      atomLink{Rel: "alternate", Href: item.URL},
+			Summary:   item.Excerpt,
+		}
+		for _, tag := range item.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: tag})
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return marshalXML(a)
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        rssGuid  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description,omitempty"`
+	Categories  []string `xml:"category"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+func (f *feedData) rss() (buf []byte, err error) {
+	rf := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.HomeURL,
+			Description:   Spf("Newest %s", f.Title),
+			LastBuildDate: f.Updated.Format(time.RFC1123Z),
+		},
+	}
+	for _, item := range f.Items {
+		rf.Channel.Items = append(rf.Channel.Items, rssItem{
+			Title:       Spf("%s: %s", item.Name, item.Title),
+			Link:        item.URL,
+			Guid:        rssGuid{IsPermaLink: true, Value: item.URL},
+			PubDate:     item.Created.Format(time.RFC1123Z),
+			Description: item.Excerpt,
+			Categories:  item.Tags,
+		})
+	}
+	return marshalXML(rf)
+}
+
+func marshalXML(v interface{}) (buf []byte, err error) {
+	defer Return(&err)
+	buf, err = xml.MarshalIndent(v, "", "  ")
+	Ck(err)
+	buf = append([]byte(xml.Header), append(buf, '\n')...)
+	return
+}
+
+type jsonFeedItem struct {
+	Id            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	Summary       string   `json:"summary,omitempty"`
+	ContentText   string   `json:"content_text"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+	Tags          []string `json:"tags,omitempty"`
+	// Docbot is a JSON Feed extension object.
+	Docbot jsonFeedExt `json:"_docbot"`
+}
+
+type jsonFeedExt struct {
+	Num  int    `json:"num"`
+	Name string `json:"name"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+func (f *feedData) jsonFeed() (buf []byte, err error) {
+	jf := jsonFeed{
+		Version:     jsonFeedSpec,
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.SelfURL,
+		Items:       []jsonFeedItem{},
+	}
+	for _, item := range f.Items {
+		jf.Items = append(jf.Items, jsonFeedItem{
+			Id:            item.URL,
+			URL:           item.URL,
+			Title:         Spf("%s: %s", item.Name, item.Title),
+			Summary:       item.Title,
+			ContentText:   item.Excerpt,
+			DatePublished: item.Created.Format(time.RFC3339),
+			DateModified:  item.Updated.Format(time.RFC3339),
+			Tags:          item.Tags,
+			Docbot:        jsonFeedExt{Num: item.Num, Name: item.Name},
+		})
+	}
+	buf, err = json.MarshalIndent(jf, "", "  ")
+	return
+}
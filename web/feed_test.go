@@ -0,0 +1,133 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func testFeed() *feedData {
+	created := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &feedData{
+		Title:   "mcp documents",
+		HomeURL: "http://localhost:8080",
+		SelfURL: "http://localhost:8080/feed.atom",
+		Updated: created.Add(time.Hour),
+		Items: []*feedItem{{
+			Num:     42,
+			Name:    "mcp-42-feeds",
+			Title:   "Feeds & <things>",
+			URL:     "http://localhost:8080/doc/mcp-42-feeds",
+			Created: created,
+			Updated: created.Add(time.Hour),
+			Excerpt: "An excerpt.",
+			Tags:    []string{"web", "nomcon"},
+		}},
+	}
+}
+
+// TestAtom checks the elements RFC 4287 requires.
+func TestAtom(t *testing.T) {
+	buf, err := testFeed().atom()
+	Tassert(t, err == nil, err)
+	Tassert(t, strings.HasPrefix(string(buf), "<?xml"), string(buf))
+	var a atomFeed
+	err = xml.Unmarshal(buf, &a)
+	Tassert(t, err == nil, err)
+	Tassert(t, a.XMLName.Space == "http://www.w3.org/2005/Atom", a.XMLName)
+	Tassert(t, a.Id != "" && a.Title != "" && a.Author != "", a)
+	_, err = time.Parse(time.RFC3339, a.Updated)
+	Tassert(t, err == nil, err)
+	var self bool
+	for _, l := range a.Links {
+		self = self || l.Rel == "self"
+	}
+	Tassert(t, self, a.Links)
+	Tassert(t, len(a.Entries) == 1, a.Entries)
+	e := a.Entries[0]
+	Tassert(t, e.Id != "" && e.Link.Href != "", e)
+	Tassert(t, e.Title == "mcp-42-feeds: Feeds & <things>", e.Title)
+	for _, d := range []string{e.Updated, e.Published} {
+		_, err = time.Parse(time.RFC3339, d)
+		Tassert(t, err == nil, err)
+	}
+	Tassert(t, len(e.Categories) == 2 && e.Categories[0].Term == "web", e.Categories)
+}
+
+// TestRSS checks the elements RSS 2.0 requires.
+func TestRSS(t *testing.T) {
+	buf, err := testFeed().rss()
+	Tassert(t, err == nil, err)
+	var r rssFeed
+	err = xml.Unmarshal(buf, &r)
+	Tassert(t, err == nil, err)
+	Tassert(t, r.XMLName.Local == "rss" && r.Version == "2.0", r.XMLName, r.Version)
+	c := r.Channel
+	Tassert(t, c.Title != "" && c.Link != "" && c.Description != "", c)
+	Tassert(t, len(c.Items) == 1, c.Items)
+	item := c.Items[0]
+	Tassert(t, item.Guid.IsPermaLink && item.Guid.Value == item.Link, item.Guid)
+	_, err = time.Parse(time.RFC1123Z, item.PubDate)
+	Tassert(t, err == nil, err)
+	_, err = time.Parse(time.RFC1123Z, c.LastBuildDate)
+	Tassert(t, err == nil, err)
+}
+
+// TestJSONFeed checks the fields JSON Feed 1.1 requires.
+func TestJSONFeed(t *testing.T) {
+	buf, err := testFeed().jsonFeed()
+	Tassert(t, err == nil, err)
+	var m map[string]interface{}
+	err = json.Unmarshal(buf, &m)
+	Tassert(t, err == nil, err)
+	Tassert(t, m["version"] == "https://jsonfeed.org/version/1.1", m["version"])
+	Tassert(t, m["title"] == "mcp documents", m["title"])
+	items := m["items"].([]interface{})
+	Tassert(t, len(items) == 1, items)
+	item := items[0].(map[string]interface{})
+	Tassert(t, item["id"] != "" && item["content_text"] == "An excerpt.", item)
+	_, err = time.Parse(time.RFC3339, item["date_published"].(string))
+	Tassert(t, err == nil, err)
+	ext := item["_docbot"].(map[string]interface{})
+	Tassert(t, ext["num"] == float64(42), ext)
+}
+
+func TestFeedCaching(t *testing.T) {
+	f := testFeed()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/feed.json", nil)
+	err := serveFeed(w, r, "json", f)
+	Tassert(t, err == nil, err)
+	Tassert(t, w.Code == http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	Tassert(t, etag != "", w.Header())
+	Tassert(t, w.Header().Get("Content-Type") == "application/feed+json; charset=utf-8", w.Header())
+	Tassert(t, strings.HasPrefix(w.Header().Get("Cache-Control"), "public, max-age="), w.Header())
+	Tassert(t, w.Header().Get("Last-Modified") == "Sun, 01 May 2022 13:00:00 GMT", w.Header())
+
+	w = httptest.NewRecorder()
+	r.Header.Set("If-None-Match", etag)
+	err = serveFeed(w, r, "json", f)
+	Tassert(t, err == nil, err)
+	Tassert(t, w.Code == http.StatusNotModified, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/feed.json", nil)
+	r.Header.Set("If-Modified-Since", "Sun, 01 May 2022 14:00:00 GMT")
+	err = serveFeed(w, r, "json", f)
+	Tassert(t, err == nil, err)
+	Tassert(t, w.Code == http.StatusNotModified, w.Code)
+}
+
+func TestExcerpt(t *testing.T) {
+	txt := "Name: mcp-42-feeds\nTitle: Feeds\n\nThe  first\nparagraph is here.\n"
+	Tassert(t, excerpt(txt, 100) == "The first paragraph is here.", excerpt(txt, 100))
+	Tassert(t, excerpt(txt, 12) == "The first…", excerpt(txt, 12))
+	Tassert(t, excerpt("No headers here.", 100) == "No headers here.")
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/stevegt/docbot/transaction"
+)
+
+// GraphDoc is one document's row on the /graph page.
+type GraphDoc struct {
+	transaction.GraphNode
+	Refs      []transaction.GraphNode
+	Backlinks []transaction.GraphNode
+}
+
+// GraphView is the reference graph arranged for the /graph page.
+type GraphView struct {
+	Updated  string
+	Docs     []GraphDoc
+	Dangling []transaction.Dangling
+}
+
+// graphView lists each document in g with its outgoing and incoming
+// references, leaving out missing documents, which are reported
+// through dangling instead.
+func graphView(g *transaction.Graph, dangling []transaction.Dangling) (v *GraphView) {
+	v = &GraphView{Updated: g.Updated, Dangling: dangling}
+	bynum := make(map[int]transaction.GraphNode)
+	pos := make(map[int]int)
+	for _, n := range g.Nodes {
+		bynum[n.Num] = n
+		if n.Missing {
+			continue
+		}
+		pos[n.Num] = len(v.Docs)
+		v.Docs = append(v.Docs, GraphDoc{GraphNode: n})
+	}
+	for _, e := range g.Edges {
+		from, ok := pos[e.From]
+		if !ok {
+			continue
+		}
+		v.Docs[from].Refs = append(v.Docs[from].Refs, bynum[e.To])
+		if to, ok := pos[e.To]; ok {
+			v.Docs[to].Backlinks = append(v.Docs[to].Backlinks, bynum[e.From])
+		}
+	}
+	return
+}
+
+// graph serves the reference graph as a web page, or as DOT or JSON
+// for /graph.dot and /graph.json.
+func (s *server) graph(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
+	tx := s.b.StartTransaction()
+	defer tx.Close()
+
+	if tx.Refs == nil {
+		http.Error(w, "no reference index", http.StatusNotFound)
+		return
+	}
+	idx, err := tx.Refs.Load()
+	ckw(w, err)
+	g := idx.Graph()
+	conf := s.conf()
+	switch {
+	case strings.HasSuffix(r.URL.Path, ".dot"):
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		_, err = w.Write([]byte(g.DOT(conf.Url)))
+		ckw(w, err)
+	case strings.HasSuffix(r.URL.Path, ".json"):
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(g)
+		ckw(w, err)
+	default:
+		nextNum, err := tx.NextNum()
+		ckw(w, err)
+		p := newPage(s, r.URL.Path, nextNum)
+		p.Graph = graphView(g, idx.Dangling())
+		err = s.tmpl().ExecuteTemplate(w, "graph.html", p)
+		ckw(w, err)
+	}
+}
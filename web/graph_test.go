@@ -0,0 +1,25 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestGraphView(t *testing.T) {
+	g := &transaction.Graph{
+		Nodes: []transaction.GraphNode{
+			{Num: 1, Name: "mcp-1-intro"},
+			{Num: 2, Name: "mcp-2-scope"},
+			{Num: 5, Missing: true},
+		},
+		Edges: []transaction.GraphEdge{{From: 1, To: 2}, {From: 1, To: 5}, {From: 2, To: 1}},
+	}
+	v := graphView(g, nil)
+	Tassert(t, len(v.Docs) == 2, v.Docs)
+	d := v.Docs[0]
+	Tassert(t, d.Num == 1 && len(d.Refs) == 2 && d.Refs[1].Missing, d)
+	Tassert(t, len(d.Backlinks) == 1 && d.Backlinks[0].Name == "mcp-2-scope", d)
+	Tassert(t, len(v.Docs[1].Backlinks) == 1 && v.Docs[1].Backlinks[0].Num == 1, v.Docs[1])
+}
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/bot"
+	"github.com/stevegt/docbot/google/fakedrive"
+	. "github.com/stevegt/goadapt"
+)
+
+const fakeConf = `{
+	"folderid": "folder",
+	"docprefix": "mcp",
+	"template": "mcp-template",
+	"session_template": "session-template",
+	"minnextnum": 100,
+	"url": "http://localhost:8080",
+	"datadir": %q
+}`
+
+// fakeServer returns a server whose bot uses a fake Drive folder
+// holding a misc template, a session template and two documents.
+func fakeServer(t testing.TB) (s *server, fd *fakedrive.Server) {
+	fd = fakedrive.New()
+	t.Cleanup(fd.Close)
+	fd.AddFolder("folder", "docs")
+	fd.AddDoc("folder", "mcp-template", fakedrive.Doc("Name: {{NAME}}", "", "{{TITLE}} in {{LOCATION}}"))
+	fd.AddDoc("folder", "session-template", fakedrive.Doc("Name: {{NAME}}", "", "{{TITLE}} on {{SESSION_DATE|Jan 2, 2006}}"))
+	fd.AddDoc("folder", "mcp-7-tools", fakedrive.Doc("Name: mcp-7-tools", "", "hand tools"))
+	fd.AddDoc("folder", "mcp-8-nomcon-2026-keynote", fakedrive.Doc("Name: mcp-8-nomcon-2026-keynote"))
+
+	dir := t.TempDir()
+	confpath := filepath.Join(dir, "docbot.conf")
+	err := ioutil.WriteFile(confpath, []byte(Spf(fakeConf, dir)), 0644)
+	Ck(err)
+	b := &bot.Bot{Confpath: confpath, ClientOptions: fd.Options()}
+	err = b.Init()
+	Ck(err)
+	s = &server{b: b}
+	s.t, err = parseTemplates(b.Conf.TemplateDir)
+	Ck(err)
+	return
+}
+
+// get sends a GET for uri to s's search or create handler.
+func get(s *server, uri string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	// set the raw query directly so that malformed escapes get
+	// through to the handler
+	parts := strings.SplitN(uri, "?", 2)
+	r.URL.Path = parts[0]
+	if len(parts) == 2 {
+		r.URL.RawQuery = parts[1]
+	}
+	switch parts[0] {
+	case "/search":
+		s.search(w, r)
+	case "/api/search":
+		s.apiSearch(w, r)
+	default:
+		s.index(w, r)
+	}
+	return w
+}
+
+var handlerCases = []struct {
+	uri  string
+	code int
+	// body, if not "", must appear in the response
+	body string
+}{
+	{"/search", 200, "mcp-7-tools"},
+	{"/search?query=hand", 200, "mcp-7-tools"},
+	{"/search?query=it's')+or+('x", 200, ""},
+	{`/search?query=a\`, 200, ""},
+	{"/search?query=mcp+7", 302, ""},
+	{"/search?doctype=nomcon&sort=title&order=asc&page=1&per_page=10", 200, "mcp-8-nomcon-2026-keynote"},
+	{"/search?page=99", 200, ""},
+	{"/search?query=%zz", 400, ""},
+	{"/search?query=a%00b", 400, ""},
+	{"/search?query=%FF", 400, ""},
+	{"/search?owner=a%0Ab", 400, ""},
+	{"/search?doctype=bogus", 400, ""},
+	{"/search?sort=bogus", 400, ""},
+	{"/search?order=sideways", 400, ""},
+	{"/search?page=0", 400, ""},
+	{"/search?page=x", 400, ""},
+	{"/search?per_page=100000", 400, ""},
+	{"/search?from=2026-13-01", 400, ""},
+	{"/search?query=" + strings.Repeat("x", maxQueryLen+1), 400, ""},
+	{"/api/search?query=hand", 200, `"name":"mcp-7-tools"`},
+	{"/api/search?sort=bogus", 400, ""},
+	{"/api/search?%", 400, ""},
+
+	{"/create", 200, ""},
+	{"/create?doctype=bogus", 200, ""},
+	{"/create?doctype=misc&title=Saws&location=Shop", 302, ""},
+	{"/create?doctype=misc&title=Saws", 400, "LOCATION"},
+	{"/create?doctype=misc&title=Saws&location=Shop&filename=mcp-7", 400, ""},
+	{"/create?doctype=misc&title=Saws&location=Shop&filename=../../etc", 400, ""},
+	{"/create?doctype=misc&title=a%0Ab", 400, ""},
+	{"/create?doctype=misc&notes=a%00b", 400, ""},
+	{"/create?doctype=misc&title=%zz", 400, ""},
+	{"/create?doctype=nomcon&session_title=Keynote", 400, ""},
+	{"/create?doctype=nomcon&session_year=2026&session_title=Keynote", 400, "SESSION_DATE"},
+	{"/create?doctype=nomcon&session_year=2026&session_title=Keynote&session_date=someday", 400, ""},
+	// no cswg template is configured, so the forms are shown again
+	{"/create?doctype=cswg&cswg_title=Tools", 200, ""},
+	{"/create?doctype=template&template=mcp-7-tools&title=x", 400, "not a template"},
+	{"/create?doctype=template&template=nope&title=x", 400, "not a template"},
+}
+
+func TestHandlers(t *testing.T) {
+	s, fd := fakeServer(t)
+	for _, c := range handlerCases {
+		w := get(s, c.uri)
+		Tassert(t, w.Code == c.code, c.uri, w.Code, w.Body.String())
+		Tassert(t, strings.Contains(w.Body.String(), c.body), c.uri, w.Body.String())
+	}
+	Tassert(t, strings.Contains(strings.Join(fd.Titles("folder"), " "), "mcp-100-saws"), fd.Titles("folder"))
+}
+
+// FuzzHandlers checks that no query string, however malformed, makes
+// the search or create handlers fail with a server error.
+func FuzzHandlers(f *testing.F) {
+	for _, c := range handlerCases {
+		f.Add(c.uri)
+	}
+	s, _ := fakeServer(f)
+	f.Fuzz(func(t *testing.T, uri string) {
+		if !strings.HasPrefix(uri, "/") {
+			uri = "/search?" + uri
+		}
+		w := get(s, uri)
+		Tassert(t, w.Code < http.StatusInternalServerError, uri, w.Code, w.Body.String())
+	})
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrBadInput is returned for a form value that is too long or
+// contains characters that can't be typed into a form field.
+var ErrBadInput = errors.New("bad input")
+
+// Input length limits, in bytes.
+const (
+	maxQueryLen    = 256
+	maxKeyLen      = 64
+	maxLineLen     = 256
+	maxFieldLen    = 4096
+	maxFormEntries = 100
+)
+
+// checkInput returns ErrBadInput if v is longer than max bytes, is
+// not valid UTF-8, or contains control characters other than line
+// breaks and tabs, which are only allowed if multiline is true.
+func checkInput(name, v string, max int, multiline bool) error {
+	if len(v) > max {
+		return fmt.Errorf("%w: %s: longer than %d bytes", ErrBadInput, name, max)
+	}
+	if !utf8.ValidString(v) {
+		return fmt.Errorf("%w: %s: not UTF-8", ErrBadInput, name)
+	}
+	for _, r := range v {
+		if !unicode.IsControl(r) {
+			continue
+		}
+		if multiline && (r == '\n' || r == '\r' || r == '\t') {
+			continue
+		}
+		return fmt.Errorf("%w: %s: control character %U", ErrBadInput, name, r)
+	}
+	return nil
+}
+
+// parseForm parses r's form values, replying with a 400 error and
+// returning false if they are malformed, e.g. a bad %-escape.
+func parseForm(w http.ResponseWriter, r *http.Request) bool {
+	err := r.ParseForm()
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// createForm is a submitted create form.
+type createForm struct {
+	Doctype  string
+	Filename string
+	Title    string
+	Year     string
+	// Template is only set for the generic form of the templates
+	// page.
+	Template string
+}
+
+// createFields maps each doctype to its form's filename and title
+// fields.
+var createFields = map[string][2]string{
+	"misc":     {"filename", "title"},
+	"nomcon":   {"session_filename", "session_title"},
+	"cswg":     {"cswg_filename", "cswg_title"},
+	"template": {"filename", "title"},
+}
+
+// parseCreateForm reads a create form, checking every value since
+// all of them may end up in the new document as placeholder values.
+// It returns nil if form isn't a create form.
+func parseCreateForm(form url.Values) (c *createForm, err error) {
+	doctype := form.Get("doctype")
+	fields, ok := createFields[doctype]
+	if !ok {
+		return nil, nil
+	}
+	if len(form) > maxFormEntries {
+		return nil, fmt.Errorf("%w: more than %d fields", ErrBadInput, maxFormEntries)
+	}
+	for k, vs := range form {
+		err = checkInput("field name", k, maxKeyLen, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vs {
+			err = checkInput(k, v, maxFieldLen, true)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	c = &createForm{
+		Doctype:  doctype,
+		Filename: form.Get(fields[0]),
+		Title:    form.Get(fields[1]),
+		Year:     form.Get("session_year"),
+	}
+	if doctype == "template" {
+		c.Template = form.Get("template")
+	}
+	for _, f := range []struct{ name, v string }{
+		{fields[0], c.Filename}, {fields[1], c.Title},
+		{"session_year", c.Year}, {"template", c.Template},
+	} {
+		err = checkInput(f.name, f.v, maxLineLen, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/bot"
+	. "github.com/stevegt/goadapt"
+)
+
+func TestCheckInput(t *testing.T) {
+	Tassert(t, checkInput("q", "it's fine, ünïcode", 100, false) == nil)
+	Tassert(t, checkInput("q", "two\nlines\ttabbed", 100, true) == nil)
+	for _, tc := range []struct {
+		v         string
+		multiline bool
+	}{
+		{strings.Repeat("x", 101), false},
+		{"\xff", false},
+		{"nul\x00", true},
+		{"two\nlines", false},
+		{"bell\a", true},
+		{"del\u007f", true},
+	} {
+		err := checkInput("q", tc.v, 100, tc.multiline)
+		Tassert(t, errors.Is(err, ErrBadInput), Spf("%q: %v", tc.v, err))
+	}
+}
+
+func TestSearchBadInput(t *testing.T) {
+	for _, q := range []string{
+		"query=" + strings.Repeat("x", maxQueryLen+1),
+		"query=a%00b",
+		"owner=a%0Ab",
+		"query=%FF",
+	} {
+		form, _ := url.ParseQuery(q)
+		_, err := parseSearchOpts(form)
+		Tassert(t, errors.Is(err, ErrBadInput), q, err)
+	}
+	form, _ := url.ParseQuery("query=it's")
+	o, err := parseSearchOpts(form)
+	Tassert(t, err == nil, err)
+	Tassert(t, o.DriveQuery().String() == `fullText contains 'it\'s'`, o.DriveQuery())
+}
+
+func TestParseCreateForm(t *testing.T) {
+	form, _ := url.ParseQuery("doctype=nomcon&session_year=2026&session_title=Keynote&session_filename=mcp-17&session_speakers=Ann%0ABob")
+	f, err := parseCreateForm(form)
+	Tassert(t, err == nil, err)
+	Tassert(t, f.Doctype == "nomcon" && f.Title == "Keynote" && f.Filename == "mcp-17" && f.Year == "2026", f)
+
+	form, _ = url.ParseQuery("query=x")
+	f, err = parseCreateForm(form)
+	Tassert(t, f == nil && err == nil, f, err)
+
+	for _, q := range []string{
+		"doctype=misc&title=a%0Ab",
+		"doctype=misc&filename=mcp-17%09x",
+		"doctype=misc&title=" + strings.Repeat("x", maxLineLen+1),
+		"doctype=misc&notes=" + strings.Repeat("x", maxFieldLen+1),
+		"doctype=misc&notes=a%00b",
+		"doctype=misc&" + strings.Repeat("k", maxKeyLen+1) + "=x",
+		"doctype=template&template=a%0Ab",
+	} {
+		form, _ := url.ParseQuery(q)
+		_, err := parseCreateForm(form)
+		Tassert(t, errors.Is(err, ErrBadInput), q, err)
+	}
+}
+
+// FuzzSearch checks that any search form is either rejected or
+// turned into a Drive query that quotes the search words intact.
+func FuzzSearch(f *testing.F) {
+	for _, q := range []string{"", "query=tools", "query=it's", `query=a\b`, "query=x'+or+'1'='1&sort=title", "owner=al&page=2&per_page=3"} {
+		f.Add(q)
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		form, err := url.ParseQuery(q)
+		if err != nil {
+			return
+		}
+		o, err := parseSearchOpts(form)
+		if err != nil {
+			return
+		}
+		Tassert(t, len(o.Query) <= maxQueryLen, o.Query)
+		lit := strings.TrimPrefix(o.DriveQuery().String(), "fullText contains ")
+		Tassert(t, len(lit) >= 2 && lit[0] == '\'' && lit[len(lit)-1] == '\'', lit)
+		// every quote and backslash inside the literal is escaped
+		var got strings.Builder
+		inner := lit[1 : len(lit)-1]
+		for i := 0; i < len(inner); i++ {
+			c := inner[i]
+			if c == '\\' {
+				i++
+				Tassert(t, i < len(inner), lit)
+				c = inner[i]
+			} else {
+				Tassert(t, c != '\'', lit)
+			}
+			got.WriteByte(c)
+		}
+		Tassert(t, got.String() == o.Query, Spf("%q: %q", o.Query, lit))
+		r := search(fakeDocs, o, "/search")
+		Tassert(t, r.Total <= len(fakeDocs), r)
+	})
+}
+
+// fakeNames is a numNamer that knows documents 3 and 5.
+func fakeNames(num int) (string, error) {
+	switch num {
+	case 3:
+		return "mcp-3-tools", nil
+	case 5:
+		return "mcp-5-nomcon-2026-keynote", nil
+	}
+	return "", nil
+}
+
+func TestFilename(t *testing.T) {
+	s := &server{b: &bot.Bot{Conf: &bot.Conf{Docprefix: "mcp", MaxNameLen: 60}}}
+	for _, c := range []struct {
+		q, expect string
+	}{
+		{"doctype=misc&title=Tools&filename=mcp-17", "mcp-17-tools"},
+		{"doctype=misc&title=Tools&filename=mcp-3-tools", "mcp-3-tools"},
+		{"doctype=nomcon&session_year=2026&session_title=Keynote&session_filename=mcp-5-nomcon-2026-keynote", "mcp-5-nomcon-2026-keynote"},
+		{"doctype=nomcon&session_year=2026&session_title=Keynote&session_filename=mcp-17", "mcp-17-nomcon-2026-keynote"},
+		{"doctype=cswg&cswg_title=Tools&cswg_filename=mcp-17", "mcp-17-cswg-workshop-tools"},
+		// documents made from other templates need no doctype segments
+		{"doctype=template&template=t&title=Tools&filename=mcp-17", "mcp-17-tools"},
+		{"doctype=template&template=t&filename=mcp-17-nomcon-x", "mcp-17-nomcon-x"},
+		// a free number below the next one
+		{"doctype=misc&title=Tools&filename=mcp-4", "mcp-4-tools"},
+	} {
+		form, _ := url.ParseQuery(c.q)
+		f, err := parseCreateForm(form)
+		Tassert(t, err == nil && f != nil, c.q, err)
+		name, err := s.filename(fakeNames, f, 17)
+		Tassert(t, err == nil, c.q, err)
+		Tassert(t, name == c.expect, Spf("%s: %q", c.q, name))
+	}
+	for _, q := range []string{
+		// number taken by another document
+		"doctype=misc&title=Other&filename=mcp-3-other",
+		"doctype=misc&title=Other&filename=mcp-3",
+		// bad or missing nomcon year
+		"doctype=nomcon&session_title=Keynote&session_filename=mcp-17",
+		"doctype=nomcon&session_year=26&session_title=Keynote&session_filename=mcp-17",
+		"doctype=nomcon&session_year=2025&session_title=Keynote&session_filename=mcp-17-nomcon-2026-keynote",
+		"doctype=misc&filename=../../etc&title=x",
+	} {
+		form, _ := url.ParseQuery(q)
+		f, err := parseCreateForm(form)
+		Tassert(t, err == nil && f != nil, q, err)
+		_, err = s.filename(fakeNames, f, 17)
+		Tassert(t, errors.Is(err, bot.ErrBadName), q, err)
+	}
+
+	failing := func(int) (string, error) { return "", errors.New("drive down") }
+	form, _ := url.ParseQuery("doctype=misc&title=Tools&filename=mcp-3")
+	f, _ := parseCreateForm(form)
+	_, err := s.filename(failing, f, 17)
+	Tassert(t, err != nil && !errors.Is(err, bot.ErrBadName), err)
+}
+
+// FuzzCreate checks that any create form is either rejected or
+// yields a filename that follows the naming policy and doesn't take
+// another document's number.
+func FuzzCreate(f *testing.F) {
+	for _, q := range []string{
+		"doctype=misc&title=Tools&filename=mcp-17",
+		"doctype=misc&title=Tools&filename=mcp-3-tools",
+		"doctype=nomcon&session_year=2026&session_title=Keynote&session_filename=mcp-17-nomcon-2026-keynote",
+		"doctype=cswg&cswg_title=It's+%2F+ok&cswg_filename=mcp-17",
+		"doctype=template&template=t&filename=mcp-3-x'y",
+		"doctype=misc&filename=../../etc&title=x",
+	} {
+		f.Add(q, 17)
+	}
+	s := &server{b: &bot.Bot{Conf: &bot.Conf{Docprefix: "mcp", MaxNameLen: 60}}}
+	namere := regexp.MustCompile(`^mcp-(\d+)(-[a-z0-9]+)*$`)
+	f.Fuzz(func(t *testing.T, q string, nextNum int) {
+		if nextNum < 1 {
+			return
+		}
+		form, err := url.ParseQuery(q)
+		if err != nil {
+			return
+		}
+		cf, err := parseCreateForm(form)
+		if err != nil || cf == nil {
+			return
+		}
+		name, err := s.filename(fakeNames, cf, nextNum)
+		if err != nil {
+			Tassert(t, errors.Is(err, bot.ErrBadName), err)
+			return
+		}
+		m := namere.FindStringSubmatch(name)
+		Tassert(t, m != nil, name)
+		num, _ := strconv.Atoi(m[1])
+		Tassert(t, len(name) <= 60 || name == Spf("mcp-%d", num), name)
+		held, _ := fakeNames(num)
+		Tassert(t, num >= nextNum || held == "" || held == name, name, held)
+	})
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+const maxSuggestions = 10
+
+var digitsre = regexp.MustCompile(`^\d+$`)
+
+type osURL struct {
+	Type     string `xml:"type,attr"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Method   string `xml:"method,attr,omitempty"`
+	Template string `xml:"template,attr"`
+}
+
+type osDescription struct {
+	XMLName       xml.Name `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string   `xml:"ShortName"`
+	Description   string   `xml:"Description"`
+	InputEncoding string   `xml:"InputEncoding"`
+	URLs          []osURL  `xml:"Url"`
+}
+
+// openSearchXML returns an OpenSearch 1.1 description of the search
+// and suggestion endpoints under baseURL.
+func openSearchXML(shortName, baseURL string) (buf []byte, err error) {
+	d := osDescription{
+		ShortName:     shortName,
+		Description:   Spf("Search %s by number, name or text", shortName),
+		InputEncoding: "UTF-8",
+		URLs: []osURL{
+			{Type: "text/html", Method: "get", Template: baseURL + "/search?query={searchTerms}"},
+			{Type: "application/x-suggestions+json", Template: baseURL + "/suggest?q={searchTerms}"},
+			{Type: "application/opensearchdescription+xml", Rel: "self", Template: baseURL + "/opensearch.xml"},
+		},
+	}
+	return marshalXML(d)
+}
+
+// docRef recognizes a query that names a document by number, such as
+// "mcp 42", "mcp-42" or "#42", and returns the number.
+func docRef(query, docprefix string) (num int, ok bool) {
+	re := regexp.MustCompile(`(?i)^(?:` + regexp.QuoteMeta(docprefix) + `[\s-]*|#)(\d+)$`)
+	m := re.FindStringSubmatch(strings.TrimSpace(query))
+	if m == nil {
+		return 0, false
+	}
+	num, err := strconv.Atoi(m[1])
+	return num, err == nil
+}
+
+// suggest returns OpenSearch suggestions for q: documents whose
+// number starts with the digits in q, or whose title contains every
+// word of q, newest first.  The result is [q, completions,
+// descriptions, urls].
+func suggest(docs []searchDoc, q, docprefix, baseURL string) []interface{} {
+	completions := []string{}
+	descriptions := []string{}
+	urls := []string{}
+
+	words := strings.Fields(strings.ToLower(q))
+	var digits string
+	if num, ok := docRef(q, docprefix); ok {
+		digits = strconv.Itoa(num)
+	} else if len(words) == 1 && digitsre.MatchString(words[0]) {
+		digits = words[0]
+	}
+
+	var matched []searchDoc
+	for _, d := range docs {
+		if d.Num() == 0 {
+			continue
+		}
+		if digits != "" {
+			if strings.HasPrefix(strconv.Itoa(d.Num()), digits) {
+				matched = append(matched, d)
+			}
+			continue
+		}
+		title := strings.ToLower(util.Title(d.Name()))
+		all := len(words) > 0
+		for _, w := range words {
+			all = all && strings.Contains(title, w)
+		}
+		if all {
+			matched = append(matched, d)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		// exact number first, then newest
+		if digits != "" {
+			ei := strconv.Itoa(matched[i].Num()) == digits
+			ej := strconv.Itoa(matched[j].Num()) == digits
+			if ei != ej {
+				return ei
+			}
+		}
+		return matched[i].Created() > matched[j].Created()
+	})
+	if len(matched) > maxSuggestions {
+		matched = matched[:maxSuggestions]
+	}
+	for _, d := range matched {
+		completions = append(completions, Spf("%s %d", docprefix, d.Num()))
+		descriptions = append(descriptions, util.Title(d.Name()))
+		urls = append(urls, Spf("%s/doc/%s", baseURL, url.PathEscape(d.Name())))
+	}
+	return []interface{}{q, completions, descriptions, urls}
+}
+
+func (s *server) opensearch(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
+	conf := s.conf()
+	buf, err := openSearchXML(shortName(conf.Docprefix), conf.Url)
+	ckw(w, err)
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	_, err = w.Write(buf)
+	ckw(w, err)
+}
+
+func (s *server) suggestions(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
+	if !parseForm(w, r) {
+		return
+	}
+	q := r.Form.Get("q")
+	err := checkInput("q", q, maxQueryLen, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tx := s.b.StartTransaction()
+	defer tx.Close()
+	nodes, err := tx.AllNodes()
+	ckw(w, err)
+	docs := make([]searchDoc, len(nodes))
+	for i, n := range nodes {
+		docs[i] = n
+	}
+	conf := s.conf()
+	res := suggest(docs, q, conf.Docprefix, conf.Url)
+	w.Header().Set("Content-Type", "application/x-suggestions+json")
+	err = json.NewEncoder(w).Encode(res)
+	ckw(w, err)
+}
+
+// shortName is the name browsers show for the search engine.
+func shortName(docprefix string) string {
+	return Spf("%s docs", docprefix)
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	. "github.com/stevegt/goadapt"
+)
+
+func TestOpenSearchXML(t *testing.T) {
+	buf, err := openSearchXML("mcp docs", "http://localhost:8080")
+	Tassert(t, err == nil, err)
+	var d osDescription
+	err = xml.Unmarshal(buf, &d)
+	Tassert(t, err == nil, err)
+	Tassert(t, d.XMLName.Space == "http://a9.com/-/spec/opensearch/1.1/", d.XMLName)
+	Tassert(t, d.ShortName == "mcp docs" && len(d.ShortName) <= 16, d.ShortName)
+	types := map[string]string{}
+	for _, u := range d.URLs {
+		types[u.Type] = u.Template
+	}
+	Tassert(t, types["text/html"] == "http://localhost:8080/search?query={searchTerms}", types)
+	Tassert(t, strings.Contains(types["application/x-suggestions+json"], "{searchTerms}"), types)
+}
+
+func TestDocRef(t *testing.T) {
+	for q, expect := range map[string]int{
+		"mcp 42":  42,
+		"MCP-42":  42,
+		"mcp42":   42,
+		"#7":      7,
+		" mcp 3 ": 3,
+		"42":      0,
+		"mcp 42x": 0,
+		"maker":   0,
+	} {
+		num, ok := docRef(q, "mcp")
+		Tassert(t, ok == (expect != 0) && num == expect, Spf("%q: %d %v", q, num, ok))
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	res := suggest(fakeDocs, "mcp 2", "mcp", "http://localhost:8080")
+	Tassert(t, res[0] == "mcp 2", res)
+	Tassert(t, strings.Join(res[1].([]string), ",") == "mcp 2", res)
+	Tassert(t, res[3].([]string)[0] == "http://localhost:8080/doc/mcp-2-nomcon-2022-keynote", res)
+
+	res = suggest(fakeDocs, "nomcon 2022", "mcp", "http://localhost:8080")
+	Tassert(t, strings.Join(res[1].([]string), ",") == "mcp 4,mcp 2", res)
+	Tassert(t, res[2].([]string)[0] == "nomcon 2022 access", res)
+
+	res = suggest(fakeDocs, "zzz", "mcp", "http://localhost:8080")
+	Tassert(t, len(res[1].([]string)) == 0, res)
+}
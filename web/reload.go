@@ -0,0 +1,124 @@
+package web
+
+import (
+	"html/template"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/stevegt/docbot/bot"
+	"github.com/stevegt/docbot/transaction"
+	. "github.com/stevegt/goadapt"
+)
+
+// funcs are available to all web templates.
+var funcs = template.FuncMap{
+	"field": transaction.Field,
+}
+
+// parseTemplates parses the built-in templates and then any *.html
+// files in dir, which replace built-in templates of the same name.
+func parseTemplates(dir string) (t *template.Template, err error) {
+	defer Return(&err)
+	t, err = template.New("web").Funcs(funcs).ParseFS(fs, "template/*")
+	Ck(err)
+	if dir == "" {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	Ck(err)
+	if len(matches) > 0 {
+		t, err = t.ParseFiles(matches...)
+		Ck(err, dir)
+	}
+	return
+}
+
+// reload re-reads the config file and templates.  Either both are
+// swapped in or, if anything is invalid, neither is.  The new state
+// is built without holding s.mu, so requests aren't held up by a slow
+// reload.
+func (s *server) reload() (err error) {
+	defer Return(&err)
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	oldListen := s.conf().Listen
+	var t *template.Template
+	err = s.b.Reload(func(conf *bot.Conf) (err error) {
+		t, err = parseTemplates(conf.TemplateDir)
+		return
+	})
+	Ck(err)
+	s.mu.Lock()
+	s.t = t
+	s.mu.Unlock()
+	if s.conf().Listen != oldListen {
+		log.Printf("listen address changed to %q; restart docbot to apply", s.conf().Listen)
+	}
+	return
+}
+
+// stamp returns a string that changes whenever the config file or a
+// template override file is added, removed, or modified.
+func (s *server) stamp() string {
+	paths := []string{s.b.Confpath}
+	dir := s.conf().TemplateDir
+	if dir != "" {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.html"))
+		paths = append(paths, matches...)
+	}
+	var parts []string
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			parts = append(parts, Spf("%s:missing", path))
+			continue
+		}
+		parts = append(parts, Spf("%s:%d:%d", path, fi.Size(), fi.ModTime().UnixNano()))
+	}
+	return strings.Join(parts, "|")
+}
+
+// watch reloads the config and templates on SIGHUP or whenever
+// stamp() changes.  A rejected reload is logged and the previous
+// state is kept.
+func (s *server) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := s.stamp()
+	for {
+		select {
+		case <-hup:
+			log.Printf("SIGHUP: reloading")
+		case <-ticker.C:
+			stamp := s.stamp()
+			if stamp == last {
+				continue
+			}
+			log.Printf("change detected: reloading")
+		}
+		last = s.tryReload()
+	}
+}
+
+// tryReload reloads, logging the outcome, and returns the stamp to
+// watch for further changes.  After a successful reload that is the
+// stamp of the new config, whose template_dir may have changed;
+// otherwise it is the stamp of the files as they were, so a bad edit
+// isn't retried until the files change again.
+func (s *server) tryReload() (stamp string) {
+	stamp = s.stamp()
+	err := s.reload()
+	if err != nil {
+		log.Printf("reload rejected, keeping previous config and templates: %v", err)
+		return
+	}
+	log.Printf("reloaded %s", s.b.Confpath)
+	return s.stamp()
+}
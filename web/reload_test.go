@@ -0,0 +1,78 @@
+package web
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/bot"
+	. "github.com/stevegt/goadapt"
+)
+
+const testConf = `{
+	"folderid": "1HcCIw7ppJZPD9GEHccnkgNYUwhAGCif6",
+	"docprefix": "mcp",
+	"template": "mcp-template",
+	"url": "http://localhost:8080",
+	"template_dir": %q
+}`
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	tdir := filepath.Join(dir, "template")
+	confpath := filepath.Join(dir, "docbot.conf")
+	credpath := filepath.Join(dir, "docbot.cred")
+	headpath := filepath.Join(tdir, "head.html")
+
+	write := func(fn, txt string) {
+		err := ioutil.WriteFile(fn, []byte(txt), 0644)
+		Tassert(t, err == nil, err)
+	}
+	render := func(s *server) string {
+		buf := &bytes.Buffer{}
+		err := s.tmpl().ExecuteTemplate(buf, "head.html", newPage(s, "/", 1))
+		Tassert(t, err == nil, err)
+		return buf.String()
+	}
+
+	err := ioutil.WriteFile(credpath, nil, 0600)
+	Tassert(t, err == nil, err)
+	write(confpath, Spf(testConf, ""))
+
+	b := &bot.Bot{Confpath: confpath, Credpath: credpath}
+	err = b.Init()
+	Tassert(t, err == nil, err)
+	s := &server{b: b}
+	s.t, err = parseTemplates(b.Conf.TemplateDir)
+	Tassert(t, err == nil, err)
+	Tassert(t, strings.Contains(render(s), "Maker Community Practices"))
+
+	// override head.html
+	err = os.Mkdir(tdir, 0755)
+	Tassert(t, err == nil, err)
+	write(headpath, "override {{.BaseURL}}")
+	write(confpath, Spf(testConf, tdir))
+	// the stamp to watch covers the new template_dir
+	stamp := s.tryReload()
+	Tassert(t, strings.Contains(stamp, headpath), stamp)
+	Tassert(t, render(s) == "override http://localhost:8080", render(s))
+
+	// a broken template is rejected and the old one kept
+	write(headpath, "broken {{.BaseURL")
+	err = s.reload()
+	Tassert(t, err != nil)
+	Tassert(t, render(s) == "override http://localhost:8080", render(s))
+	// and not retried until the files change again
+	Tassert(t, s.tryReload() == s.stamp())
+
+	// so is a broken config
+	write(headpath, "fixed {{.BaseURL}}")
+	write(confpath, `{"folderid": "x", "bogus": 1}`)
+	err = s.reload()
+	Tassert(t, err != nil)
+	Tassert(t, render(s) == "override http://localhost:8080", render(s))
+	Tassert(t, s.conf().TemplateDir == tdir, s.conf())
+}
@@ -0,0 +1,293 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/util"
+)
+
+// searchDoc is what search needs to know about a document.
+// *google.Node implements it.
+type searchDoc interface {
+	Name() string
+	Num() int
+	URL() string
+	Created() string
+	Modified() string
+	Owners() []string
+}
+
+// SortKeys lists the ways search results can be sorted.
+var SortKeys = []string{"created", "modified", "num", "title"}
+
+// sortKeys maps each sort key to its default order.
+var sortKeys = map[string]string{
+	"created":  "desc",
+	"modified": "desc",
+	"num":      "desc",
+	"title":    "asc",
+}
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// SearchOpts are the search parameters accepted by /search and
+// /api/search.
+type SearchOpts struct {
+	Query   string `json:"query,omitempty"`
+	Doctype string `json:"doctype,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+	// From and To bound the creation date, inclusive, as YYYY-MM-DD.
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Sort    string `json:"sort"`
+	Order   string `json:"order"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"per_page"`
+}
+
+// parseSearchOpts reads and validates search parameters from form,
+// filling in defaults.
+func parseSearchOpts(form url.Values) (o *SearchOpts, err error) {
+	o = &SearchOpts{
+		Query:   strings.TrimSpace(form.Get("query")),
+		Doctype: form.Get("doctype"),
+		Owner:   strings.TrimSpace(form.Get("owner")),
+		From:    form.Get("from"),
+		To:      form.Get("to"),
+		Sort:    form.Get("sort"),
+		Order:   form.Get("order"),
+		Page:    1,
+		PerPage: defaultPerPage,
+	}
+	for _, f := range []struct{ name, v string }{{"query", o.Query}, {"owner", o.Owner}} {
+		err = checkInput(f.name, f.v, maxQueryLen, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	found := o.Doctype == ""
+	for _, dt := range util.Doctypes {
+		found = found || dt == o.Doctype
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown doctype: %q", o.Doctype)
+	}
+	for _, d := range []string{o.From, o.To} {
+		if d == "" {
+			continue
+		}
+		_, err = time.Parse("2006-01-02", d)
+		if err != nil {
+			return nil, fmt.Errorf("bad date %q: want YYYY-MM-DD", d)
+		}
+	}
+	if o.Sort == "" {
+		o.Sort = "created"
+	}
+	def, ok := sortKeys[o.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key: %q", o.Sort)
+	}
+	if o.Order == "" {
+		o.Order = def
+	}
+	if o.Order != "asc" && o.Order != "desc" {
+		return nil, fmt.Errorf("order must be asc or desc: %q", o.Order)
+	}
+	for _, p := range []struct {
+		name string
+		n    *int
+		max  int
+	}{{"page", &o.Page, 0}, {"per_page", &o.PerPage, maxPerPage}} {
+		s := form.Get(p.name)
+		if s == "" {
+			continue
+		}
+		*p.n, err = strconv.Atoi(s)
+		if err != nil || *p.n < 1 || (p.max > 0 && *p.n > p.max) {
+			return nil, fmt.Errorf("bad %s: %q", p.name, s)
+		}
+	}
+	return o, nil
+}
+
+// DriveQuery returns the Drive search for o's full-text query.  The
+// other options are applied to the results by search.
+func (o *SearchOpts) DriveQuery() *google.Query {
+	return google.NewQuery().Contains("fullText", o.Query)
+}
+
+// Values encodes o as query parameters, leaving out defaults so that
+// URLs stay short.
+func (o *SearchOpts) Values() url.Values {
+	v := url.Values{}
+	set := func(k, val, def string) {
+		if val != def {
+			v.Set(k, val)
+		}
+	}
+	set("query", o.Query, "")
+	set("doctype", o.Doctype, "")
+	set("owner", o.Owner, "")
+	set("from", o.From, "")
+	set("to", o.To, "")
+	set("sort", o.Sort, "created")
+	set("order", o.Order, sortKeys[o.Sort])
+	set("page", strconv.Itoa(o.Page), "1")
+	set("per_page", strconv.Itoa(o.PerPage), strconv.Itoa(defaultPerPage))
+	return v
+}
+
+// URL returns base with o's parameters, showing page.
+func (o *SearchOpts) URL(base string, page int) string {
+	p := *o
+	p.Page = page
+	q := p.Values().Encode()
+	if q == "" {
+		return base
+	}
+	return base + "?" + q
+}
+
+// match returns true if d passes o's filters.  The full-text query is
+// applied by Drive, not here.
+func (o *SearchOpts) match(d searchDoc) bool {
+	if o.Doctype != "" && util.Doctype(d.Name()) != o.Doctype {
+		return false
+	}
+	// created is RFC 3339, so its first 10 characters are the date
+	created := d.Created()
+	if len(created) >= 10 {
+		created = created[:10]
+	}
+	if o.From != "" && created < o.From {
+		return false
+	}
+	if o.To != "" && created > o.To {
+		return false
+	}
+	if o.Owner != "" {
+		owner := strings.ToLower(o.Owner)
+		ok := false
+		for _, name := range d.Owners() {
+			ok = ok || strings.Contains(strings.ToLower(name), owner)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// less orders a before b by o's sort key, ascending.
+func (o *SearchOpts) less(a, b searchDoc) bool {
+	switch o.Sort {
+	case "num":
+		return a.Num() < b.Num()
+	case "modified":
+		return a.Modified() < b.Modified()
+	case "title":
+		return strings.ToLower(util.Title(a.Name())) < strings.ToLower(util.Title(b.Name()))
+	}
+	// dates are in RFC3339 format, so they sort correctly as strings
+	return a.Created() < b.Created()
+}
+
+// SearchResult is one page of search results.
+type SearchResult struct {
+	Opts  *SearchOpts
+	Docs  []searchDoc
+	Total int
+	Pages int
+	// First and Last are the 1-based positions of Docs in the full
+	// result list.
+	First, Last int
+	PrevURL     string
+	NextURL     string
+}
+
+// search filters, sorts and paginates docs.  base is the URL that
+// PrevURL and NextURL are built from.
+func search(docs []searchDoc, o *SearchOpts, base string) (r *SearchResult) {
+	r = &SearchResult{Opts: o}
+	var matched []searchDoc
+	for _, d := range docs {
+		if o.match(d) {
+			matched = append(matched, d)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if o.Order == "desc" {
+			return o.less(matched[j], matched[i])
+		}
+		return o.less(matched[i], matched[j])
+	})
+
+	r.Total = len(matched)
+	r.Pages = (r.Total + o.PerPage - 1) / o.PerPage
+	start := (o.Page - 1) * o.PerPage
+	if start > r.Total {
+		start = r.Total
+	}
+	end := start + o.PerPage
+	if end > r.Total {
+		end = r.Total
+	}
+	r.Docs = matched[start:end]
+	if end > start {
+		r.First, r.Last = start+1, end
+	}
+	if o.Page > 1 && start > 0 {
+		r.PrevURL = o.URL(base, o.Page-1)
+	}
+	if end < r.Total {
+		r.NextURL = o.URL(base, o.Page+1)
+	}
+	return
+}
+
+// searchJSON is the /api/search representation of a document.
+type searchJSON struct {
+	Num      int      `json:"num"`
+	Name     string   `json:"name"`
+	Title    string   `json:"title"`
+	Doctype  string   `json:"doctype"`
+	URL      string   `json:"url"`
+	Created  string   `json:"created"`
+	Modified string   `json:"modified"`
+	Owners   []string `json:"owners"`
+}
+
+// JSON returns the /api/search response body for r.
+func (r *SearchResult) JSON() interface{} {
+	results := []searchJSON{}
+	for _, d := range r.Docs {
+		results = append(results, searchJSON{
+			Num:      d.Num(),
+			Name:     d.Name(),
+			Title:    util.Title(d.Name()),
+			Doctype:  util.Doctype(d.Name()),
+			URL:      d.URL(),
+			Created:  d.Created(),
+			Modified: d.Modified(),
+			Owners:   d.Owners(),
+		})
+	}
+	return struct {
+		*SearchOpts
+		Total   int          `json:"total"`
+		Pages   int          `json:"pages"`
+		Prev    string       `json:"prev,omitempty"`
+		Next    string       `json:"next,omitempty"`
+		Results []searchJSON `json:"results"`
+	}{r.Opts, r.Total, r.Pages, r.PrevURL, r.NextURL, results}
+}
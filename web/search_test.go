@@ -0,0 +1,102 @@
+package web
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stevegt/docbot/util"
+	. "github.com/stevegt/goadapt"
+)
+
+type fakeDoc struct {
+	name     string
+	num      int
+	created  string
+	modified string
+	owner    string
+}
+
+func (d *fakeDoc) Name() string     { return d.name }
+func (d *fakeDoc) Num() int         { return d.num }
+func (d *fakeDoc) URL() string      { return "https://docs.google.com/" + d.name }
+func (d *fakeDoc) Created() string  { return d.created }
+func (d *fakeDoc) Modified() string { return d.modified }
+func (d *fakeDoc) Owners() []string { return []string{d.owner} }
+
+var fakeDocs = []searchDoc{
+	&fakeDoc{"mcp-1-why-numbered-docs", 1, "2022-01-10T00:00:00Z", "2022-03-01T00:00:00Z", "Alice"},
+	&fakeDoc{"mcp-2-nomcon-2022-keynote", 2, "2022-02-10T00:00:00Z", "2022-02-11T00:00:00Z", "Bob"},
+	&fakeDoc{"mcp-3-cswg-workshop-tools", 3, "2022-03-10T00:00:00Z", "2022-03-11T00:00:00Z", "Alice"},
+	&fakeDoc{"mcp-4-nomcon-2022-access", 4, "2022-04-10T00:00:00Z", "2022-04-11T00:00:00Z", "Carol"},
+}
+
+func names(r *SearchResult) (out []string) {
+	for _, d := range r.Docs {
+		out = append(out, d.Name())
+	}
+	return
+}
+
+func TestSearch(t *testing.T) {
+	for q, expect := range map[string]string{
+		"":                              "mcp-4-nomcon-2022-access mcp-3-cswg-workshop-tools mcp-2-nomcon-2022-keynote mcp-1-why-numbered-docs",
+		"sort=num&order=asc":            "mcp-1-why-numbered-docs mcp-2-nomcon-2022-keynote mcp-3-cswg-workshop-tools mcp-4-nomcon-2022-access",
+		"sort=title":                    "mcp-3-cswg-workshop-tools mcp-4-nomcon-2022-access mcp-2-nomcon-2022-keynote mcp-1-why-numbered-docs",
+		"sort=modified":                 "mcp-4-nomcon-2022-access mcp-3-cswg-workshop-tools mcp-1-why-numbered-docs mcp-2-nomcon-2022-keynote",
+		"doctype=nomcon":                "mcp-4-nomcon-2022-access mcp-2-nomcon-2022-keynote",
+		"owner=alice":                   "mcp-3-cswg-workshop-tools mcp-1-why-numbered-docs",
+		"from=2022-02-10&to=2022-03-10": "mcp-3-cswg-workshop-tools mcp-2-nomcon-2022-keynote",
+	} {
+		form, err := url.ParseQuery(q)
+		Tassert(t, err == nil, err)
+		o, err := parseSearchOpts(form)
+		Tassert(t, err == nil, q, err)
+		r := search(fakeDocs, o, "/search")
+		got := strings.Join(names(r), " ")
+		Tassert(t, got == expect, Spf("%q: got %q", q, got))
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	form, _ := url.ParseQuery("doctype=&per_page=3&page=2&sort=num")
+	o, err := parseSearchOpts(form)
+	Tassert(t, err == nil, err)
+	r := search(fakeDocs, o, "/search")
+	Tassert(t, r.Total == 4 && r.Pages == 2, r)
+	Tassert(t, r.First == 4 && r.Last == 4, r)
+	Tassert(t, len(r.Docs) == 1 && r.Docs[0].Num() == 1, names(r))
+	Tassert(t, r.PrevURL == "/search?per_page=3&sort=num", r.PrevURL)
+	Tassert(t, r.NextURL == "", r.NextURL)
+}
+
+func TestSearchBadOpts(t *testing.T) {
+	for _, q := range []string{
+		"doctype=memo",
+		"sort=size",
+		"order=up",
+		"from=June",
+		"page=0",
+		"per_page=100000",
+	} {
+		form, _ := url.ParseQuery(q)
+		_, err := parseSearchOpts(form)
+		Tassert(t, err != nil, q)
+	}
+}
+
+func TestSearchTemplate(t *testing.T) {
+	tmpl, err := parseTemplates("")
+	Tassert(t, err == nil, err)
+	form, _ := url.ParseQuery("doctype=cswg&per_page=1")
+	o, err := parseSearchOpts(form)
+	Tassert(t, err == nil, err)
+	p := &Page{Search: search(fakeDocs, o, "/search"), Doctypes: util.Doctypes, SortKeys: SortKeys}
+	buf := &bytes.Buffer{}
+	err = tmpl.ExecuteTemplate(buf, "search.html", p)
+	Tassert(t, err == nil, err)
+	out := buf.String()
+	Tassert(t, strings.Contains(out, `<option value="cswg" selected>`), out)
+	Tassert(t, strings.Contains(out, "1-1 of 1 documents"), out)
+}
@@ -2,17 +2,26 @@ package web
 
 import (
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"sort"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/stevegt/docbot/bot"
 	"github.com/stevegt/docbot/google"
+	"github.com/stevegt/docbot/transaction"
+	"github.com/stevegt/docbot/util"
 	. "github.com/stevegt/goadapt"
+	"google.golang.org/api/docs/v1"
 )
 
 //go:embed template/*
@@ -35,9 +44,30 @@ func logw(args ...interface{}) {
 }
 
 type server struct {
-	b         *bot.Bot
-	t         *template.Template
-	searchUrl string
+	b *bot.Bot
+	// rmu serializes reloads; mu guards t
+	rmu sync.Mutex
+	mu  sync.RWMutex
+	t   *template.Template
+	// texts caches document text for feeds
+	tmu   sync.Mutex
+	texts map[string]cachedText
+}
+
+// tmpl returns the current parsed templates.
+func (s *server) tmpl() *template.Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.t
+}
+
+// conf returns the current config.
+func (s *server) conf() *bot.Conf {
+	return s.b.CurrentConf()
+}
+
+func (s *server) searchUrl() string {
+	return Spf("%s/search", s.conf().Url)
 }
 
 func Serve(b *bot.Bot) (err error) {
@@ -55,17 +85,30 @@ func Serve(b *bot.Bot) (err error) {
 
 	s := &server{b: b}
 
-	s.t, err = template.ParseFS(fs, "template/*")
+	s.t, err = parseTemplates(b.Conf.TemplateDir)
 	Ck(err)
 
-	s.searchUrl = Spf("%s/search", s.b.Conf.Url)
+	go s.watch(2 * time.Second)
 
 	// start server
 	http.HandleFunc("/doc/", s.doc)
 	http.HandleFunc("/unlock/", s.unlock)
 	http.HandleFunc("/search", s.search)
-	http.HandleFunc("/browse/", handleBrowse)   // allows browsing of different revisions
-	http.HandleFunc("/doc_html/", serveDocHTML) // serves the document HTML for gdoctools integration
+	http.HandleFunc("/api/search", s.apiSearch)
+	http.HandleFunc("/opensearch.xml", s.opensearch)
+	http.HandleFunc("/suggest", s.suggestions)
+	http.HandleFunc("/feed.atom", s.feed)
+	http.HandleFunc("/feed.rss", s.feed)
+	http.HandleFunc("/feed.json", s.feed)
+	http.HandleFunc("/calendar.ics", s.calendar)
+	http.HandleFunc("/graph", s.graph)
+	http.HandleFunc("/graph.dot", s.graph)
+	http.HandleFunc("/graph.json", s.graph)
+	http.HandleFunc("/create", s.index)
+	http.HandleFunc("/admin/templates", s.templates)
+	http.HandleFunc("/browse/", s.browse)    // allows browsing of different revisions
+	http.HandleFunc("/doc_html/", s.docHTML) // serves the document HTML for gdoctools integration
+	http.HandleFunc("/images/", s.images)
 	http.Handle("/",
 		http.StripPrefix("/", http.FileServer(http.Dir("/tmp/gdoctools/"))))
 
@@ -84,21 +127,34 @@ type Page struct {
 	Nodes          []*google.Node
 	YYYY           string
 	NextNum        int
+	DocPrefix      string
 	BaseURL        string
+	ShortName      string
 	PageURL        string
 	UnlockBase     string
 	SearchURL      string
 	SearchQuery    string
 	ResultsHeading string
+	Templates      *bot.TemplateReport
+	Search         *SearchResult
+	Doc            *transaction.DocInfo
+	Graph          *GraphView
+	Doctypes       []string
+	SortKeys       []string
 }
 
 func newPage(s *server, uri string, nextnum int) (p *Page) {
+	conf := s.conf()
 	p = &Page{
 		NextNum:    nextnum,
-		BaseURL:    s.b.Conf.Url,
-		PageURL:    Spf("%s%s", s.b.Conf.Url, uri),
-		SearchURL:  s.searchUrl,
-		UnlockBase: Spf("%s/unlock", s.b.Conf.Url),
+		DocPrefix:  conf.Docprefix,
+		BaseURL:    conf.Url,
+		ShortName:  shortName(conf.Docprefix),
+		PageURL:    Spf("%s%s", conf.Url, uri),
+		SearchURL:  s.searchUrl(),
+		UnlockBase: Spf("%s/unlock", conf.Url),
+		Doctypes:   util.Doctypes,
+		SortKeys:   SortKeys,
 		// "01/02 03:04:05PM '06 -0700"
 		YYYY: time.Now().Format("2006"),
 	}
@@ -108,45 +164,75 @@ func newPage(s *server, uri string, nextnum int) (p *Page) {
 func (s *server) index(w http.ResponseWriter, r *http.Request) {
 	defer logw(r.URL)
 	log.Println(r.URL)
-	err := r.ParseForm()
-	ckw(w, err)
+	if !parseForm(w, r) {
+		return
+	}
 	tx := s.b.StartTransaction()
 	defer tx.Close()
 
 	// create doc and redirect
+	conf := s.conf()
+	f, err := parseCreateForm(r.Form)
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	var tmpl string
-	var ofn string
-	var title string
-	doctype := r.Form.Get("doctype")
-	switch doctype {
-	case "misc":
-		ofn = r.Form.Get("filename")
-		title = r.Form.Get("title")
-		tmpl = s.b.Conf.Template
-	case "nomcon":
-		ofn = r.Form.Get("session_filename")
-		title = r.Form.Get("session_title")
-		tmpl = s.b.Conf.SessionTemplate
-	case "cswg":
-		ofn = r.Form.Get("cswg_filename")
-		title = r.Form.Get("cswg_title")
-		tmpl = s.b.Conf.CSWGTemplate
-	}
-	log.Printf("r.URL: %s", r.URL)
-	log.Printf("r.Form: %v", r.Form)
-	log.Printf("doctype: %s ofn: %s title: %s", doctype, ofn, title)
-	log.Printf("tmpl: %s", tmpl)
+	if f != nil {
+		switch f.Doctype {
+		case "misc":
+			tmpl = conf.Template
+		case "nomcon":
+			tmpl = conf.SessionTemplate
+		case "cswg":
+			tmpl = conf.CSWGTemplate
+		case "template":
+			// generic form from the templates page
+			tmpl = f.Template
+			tr, err := s.b.ListTemplates(tx, false)
+			ckw(w, err)
+			if tr.Template(tmpl) == nil {
+				log.Printf("error: not a template: %q", tmpl)
+				http.Error(w, Spf("not a template: %q", tmpl), http.StatusBadRequest)
+				return
+			}
+		}
+		log.Printf("r.URL: %s", r.URL)
+		log.Printf("r.Form: %v", r.Form)
+		log.Printf("doctype: %s ofn: %s title: %s", f.Doctype, f.Filename, f.Title)
+		log.Printf("tmpl: %s", tmpl)
+	}
 
 	nextNum, err := tx.NextNum()
 	ckw(w, err)
 	p := newPage(s, "/", nextNum)
 
-	unlockPrefix := Spf("%s/%s", p.UnlockBase, s.b.Conf.Docprefix)
-
 	if tmpl != "" {
-		log.Printf("creating doc: %s: %s: %s", tmpl, ofn, title)
+		ofn, err := s.filename(docNamer(tx), f, nextNum)
+		if errors.Is(err, bot.ErrBadName) {
+			log.Printf("error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ckw(w, err)
+		log.Printf("creating doc: %s: %s: %s", tmpl, ofn, f.Title)
+		opts := &transaction.DocOpts{
+			Template:     tmpl,
+			Filename:     ofn,
+			Title:        f.Title,
+			UnlockPrefix: Spf("%s/%s", p.UnlockBase, conf.Docprefix),
+			DocPrefix:    Spf("%s/doc/%s", conf.Url, conf.Docprefix),
+			Creator:      creator(r),
+			Vars:         transaction.VarsFromForm(r.Form),
+		}
 		var node *google.Node
-		node, err = tx.OpenCreate(r, tmpl, ofn, unlockPrefix, title)
+		node, err = tx.OpenCreateOpts(opts)
+		if errors.Is(err, transaction.ErrMissingValue) || errors.Is(err, transaction.ErrBadValue) {
+			log.Printf("error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		ckw(w, err)
 		err = tx.Unlock(node)
 		ckw(w, err)
@@ -154,17 +240,120 @@ func (s *server) index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.t.ExecuteTemplate(w, "index.html", p)
+	err = s.tmpl().ExecuteTemplate(w, "index.html", p)
 	ckw(w, err)
 
 	return
 }
 
-func (s *server) search(w http.ResponseWriter, r *http.Request) {
+// numNamer returns the name of the document numbered num, or "" if
+// there is none.
+type numNamer func(num int) (name string, err error)
+
+// docNamer returns a numNamer that looks documents up in tx.
+func docNamer(tx *transaction.Transaction) numNamer {
+	return func(num int) (name string, err error) {
+		node, err := tx.GetByNum(num)
+		if err != nil || node == nil {
+			return "", err
+		}
+		return node.Name(), nil
+	}
+}
+
+// filename applies the naming policy to the filename submitted by a
+// create form.  A number that already belongs to a document of
+// another name is refused, so only an existing document's exact name
+// can be reopened.
+func (s *server) filename(nameOf numNamer, f *createForm, nextNum int) (name string, err error) {
+	defer Return(&err)
+	req := bot.NameRequest{Doctype: f.Doctype, Filename: f.Filename, Title: f.Title, NextNum: nextNum}
+	if f.Doctype == "template" {
+		req.Doctype = ""
+	}
+	if f.Doctype == "nomcon" {
+		req.Year, err = strconv.Atoi(f.Year)
+		if err != nil || req.Year < 1000 || req.Year > 9999 {
+			return "", fmt.Errorf("%w: bad year: %q", bot.ErrBadName, f.Year)
+		}
+	}
+	name, num, err := s.conf().Filename(req)
+	Ck(err)
+	if num < nextNum {
+		held, err := nameOf(num)
+		Ck(err)
+		if held != "" && held != name {
+			return "", fmt.Errorf("%w: %d is already %s", bot.ErrBadName, num, held)
+		}
+	}
+	return
+}
+
+// templates lists the available templates, with a create form for
+// each generated from its placeholders.
+func (s *server) templates(w http.ResponseWriter, r *http.Request) {
 	defer logw(r.URL)
 	log.Println(r.URL)
-	err := r.ParseForm()
+	tx := s.b.StartTransaction()
+	defer tx.Close()
+
+	nextNum, err := tx.NextNum()
+	ckw(w, err)
+	p := newPage(s, "/admin/templates", nextNum)
+	p.Templates, err = s.b.ListTemplates(tx, true)
+	ckw(w, err)
+
+	err = s.tmpl().ExecuteTemplate(w, "templates.html", p)
+	ckw(w, err)
+}
+
+// creator returns who is creating a document, for the CREATOR
+// placeholder: the "creator" form field if set, else a user name
+// supplied by an authenticating proxy, else "anonymous".
+func creator(r *http.Request) string {
+	for _, v := range []string{
+		r.Form.Get("creator"),
+		r.Header.Get("X-Forwarded-User"),
+		r.Header.Get("X-Forwarded-Email"),
+	} {
+		if v != "" {
+			return v
+		}
+	}
+	return "anonymous"
+}
+
+// findDocs runs the search described by r's form.  base is the URL
+// that page links are built from.  A bad parameter is reported with
+// status 400.
+func (s *server) findDocs(w http.ResponseWriter, r *http.Request, tx *transaction.Transaction, base string) (res *SearchResult, ok bool) {
+	if !parseForm(w, r) {
+		return
+	}
+	opts, err := parseSearchOpts(r.Form)
+	if err != nil {
+		log.Printf("error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	var nodes []*google.Node
+	if opts.Query == "" {
+		nodes, err = tx.AllNodes()
+	} else {
+		nodes, err = tx.FindNodes(opts.DriveQuery())
+	}
 	ckw(w, err)
+	docs := make([]searchDoc, len(nodes))
+	for i, n := range nodes {
+		docs[i] = n
+	}
+	return search(docs, opts, base), true
+}
+
+func (s *server) search(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
 	tx := s.b.StartTransaction()
 	defer tx.Close()
 
@@ -172,35 +361,60 @@ func (s *server) search(w http.ResponseWriter, r *http.Request) {
 	ckw(w, err)
 	p := newPage(s, "/search", nextNum)
 
-	p.SearchQuery = r.Form.Get("query")
+	// "mcp 42" typed into the browser's address bar goes straight
+	// to the document
+	if !parseForm(w, r) {
+		return
+	}
+	num, ok := docRef(r.Form.Get("query"), s.conf().Docprefix)
+	if ok {
+		http.Redirect(w, r, Spf("%s/doc/%d", p.BaseURL, num), http.StatusFound)
+		return
+	}
+
+	res, ok := s.findDocs(w, r, tx, p.SearchURL)
+	if !ok {
+		return
+	}
+	p.Search = res
+	p.SearchQuery = res.Opts.Query
+	for _, d := range res.Docs {
+		p.Nodes = append(p.Nodes, d.(*google.Node))
+	}
 	if p.SearchQuery == "" {
-		p.Nodes, err = tx.AllNodes()
-		ckw(w, err)
 		p.ResultsHeading = "All documents:"
 	} else {
-		q := Spf("fullText contains '%s'", p.SearchQuery)
-		p.Nodes, err = tx.FindNodes(q)
-		ckw(w, err)
 		p.ResultsHeading = Spf("Search results for '%s':", p.SearchQuery)
 	}
 
-	// sort nodes by date, newest first.  dates are in RFC3339 format,
-	// so they sort correctly as strings.
-	sort.Slice(p.Nodes, func(i, j int) bool {
-		return p.Nodes[i].Created() > p.Nodes[j].Created()
-	})
-
-	err = s.t.ExecuteTemplate(w, "search.html", p)
+	err = s.tmpl().ExecuteTemplate(w, "search.html", p)
 	ckw(w, err)
 
 	return
 }
 
-func (s *server) unlock(w http.ResponseWriter, r *http.Request) {
+// apiSearch is the JSON version of search.
+func (s *server) apiSearch(w http.ResponseWriter, r *http.Request) {
 	defer logw(r.URL)
 	log.Println(r.URL)
-	err := r.ParseForm()
+	tx := s.b.StartTransaction()
+	defer tx.Close()
+
+	res, ok := s.findDocs(w, r, tx, Spf("%s/api/search", s.conf().Url))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(res.JSON())
 	ckw(w, err)
+}
+
+func (s *server) unlock(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	log.Println(r.URL)
+	if !parseForm(w, r) {
+		return
+	}
 	tx := s.b.StartTransaction()
 	defer tx.Close()
 
@@ -213,7 +427,7 @@ func (s *server) unlock(w http.ResponseWriter, r *http.Request) {
 	// first part is empty because of leading slash
 	if len(parts) != 3 {
 		log.Printf("error: wrong parts count: %s: %v", r.URL, parts)
-		http.Redirect(w, r, s.searchUrl, http.StatusFound)
+		http.Redirect(w, r, s.searchUrl(), http.StatusFound)
 		return
 	}
 
@@ -223,7 +437,7 @@ func (s *server) unlock(w http.ResponseWriter, r *http.Request) {
 	ckw(w, err)
 	if node == nil {
 		log.Printf("error: doc not found: %s", prefix)
-		http.Redirect(w, r, s.searchUrl, http.StatusFound)
+		http.Redirect(w, r, s.searchUrl(), http.StatusFound)
 		return
 	}
 
@@ -237,62 +451,144 @@ func (s *server) unlock(w http.ResponseWriter, r *http.Request) {
 func (s *server) doc(w http.ResponseWriter, r *http.Request) {
 	defer logw(r.URL)
 	log.Println(r.URL)
-	err := r.ParseForm()
-	ckw(w, err)
+	if !parseForm(w, r) {
+		return
+	}
 	tx := s.b.StartTransaction()
 	defer tx.Close()
 
-	parts := strings.Split(r.URL.String(), "/")
+	parts := strings.Split(r.URL.Path, "/")
 	// first part is empty because of leading slash
 	if len(parts) != 3 {
 		log.Printf("error: wrong parts count: %s: %v", r.URL, parts)
-		http.Redirect(w, r, s.searchUrl, http.StatusFound)
+		http.Redirect(w, r, s.searchUrl(), http.StatusFound)
 		return
 	}
 
-	// XXX move this to tx so we can get google doc url via cli
-	prefix := Spf("%s-", parts[2])
-	node, err := tx.OpenPrefix(prefix)
+	// the key can be a number, name, name prefix, alias, or Drive
+	// ID, optionally followed by an export extension such as .md
+	key, format := splitDocKey(parts[2])
+	nodes, err := tx.Resolve(key)
 	ckw(w, err)
-	if node == nil {
-		log.Printf("error: doc not found: %s", prefix)
-		http.Redirect(w, r, s.searchUrl, http.StatusFound)
-		return
+	switch len(nodes) {
+	case 0:
+		log.Printf("error: doc not found: %s", key)
+		http.Redirect(w, r, s.searchUrl(), http.StatusFound)
+	case 1:
+		node := nodes[0]
+		switch {
+		case format != "":
+			buf, err := tx.Export(node, format)
+			ckw(w, err)
+			w.Header().Set("Content-Type", transaction.ExportFormats[format])
+			_, err = w.Write(buf)
+			ckw(w, err)
+		case s.wantsDocPage(r):
+			nextNum, err := tx.NextNum()
+			ckw(w, err)
+			p := newPage(s, r.URL.Path, nextNum)
+			p.Doc, err = tx.DocInfo(node)
+			ckw(w, err)
+			err = s.tmpl().ExecuteTemplate(w, "doc.html", p)
+			ckw(w, err)
+		default:
+			http.Redirect(w, r, node.URL(), http.StatusFound)
+		}
+	default:
+		// let the user choose
+		nextNum, err := tx.NextNum()
+		ckw(w, err)
+		p := newPage(s, r.URL.Path, nextNum)
+		p.Nodes = nodes
+		p.SearchQuery = key
+		p.ResultsHeading = Spf("Several documents match '%s':", key)
+		err = s.tmpl().ExecuteTemplate(w, "search.html", p)
+		ckw(w, err)
 	}
-
-	http.Redirect(w, r, node.URL(), http.StatusFound)
 	return
 }
 
+// splitDocKey splits an export extension, if any, off a /doc/ key:
+// "42.md" gives "42" and "md".
+func splitDocKey(s string) (key, format string) {
+	ext := path.Ext(s)
+	if ext != "" && transaction.ExportFormats[ext[1:]] != "" {
+		return strings.TrimSuffix(s, ext), ext[1:]
+	}
+	return s, ""
+}
+
+// wantsDocPage returns true if a /doc/ request should show docbot's
+// page about the document rather than redirect to it.  The
+// "redirect" and "info" query flags override the doc_page setting.
+func (s *server) wantsDocPage(r *http.Request) bool {
+	if _, ok := r.Form["redirect"]; ok {
+		return false
+	}
+	if _, ok := r.Form["info"]; ok {
+		return true
+	}
+	return s.conf().DocPage
+}
+
 // serveDocsIndex serves the docs_index.json file for gdoctools integration
 func serveDocsIndex(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	http.ServeFile(w, r, "/tmp/docs_index.json")
 }
 
-// serveDocHTML serves the document HTML for gdoctools integration
-func serveDocHTML(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
-	parts := strings.Split(path, "/")
+// docHTML serves a revision saved by gdoctools.  If the revision
+// directory has the document's JSON, it is rendered with docbot's
+// HTML renderer; otherwise the pre-rendered HTML is served as is.
+func (s *server) docHTML(w http.ResponseWriter, r *http.Request) {
+	defer logw(r.URL)
+	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 6 {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
 	docname := parts[2]
 	rev := parts[4]
-	fullpath := fmt.Sprintf("/tmp/%s/Revision_%s/document.html", docname, rev)
+	if strings.Contains(docname+rev, "..") {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	dir := fmt.Sprintf("/tmp/%s/Revision_%s", docname, rev)
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "document.json"))
+	if err == nil {
+		var doc docs.Document
+		err = json.Unmarshal(buf, &doc)
+		ckw(w, err)
+		tx := s.b.StartTransaction()
+		defer tx.Close()
+		buf, err = tx.HTML(&doc)
+		ckw(w, err)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err = w.Write(buf)
+		ckw(w, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/html")
-	http.ServeFile(w, r, fullpath)
+	http.ServeFile(w, r, filepath.Join(dir, "document.html"))
+}
+
+// images serves the local copies of document images.
+func (s *server) images(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		// no directory listings
+		http.NotFound(w, r)
+		return
+	}
+	dir := http.Dir(s.conf().DataPath("images"))
+	http.StripPrefix("/images/", http.FileServer(dir)).ServeHTTP(w, r)
 }
 
-// handleBrowse handles the browsing of different revisions
-func handleBrowse(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles(
-		"web/template/head.html",
-		"web/template/browse.html",
-	))
-	err := tmpl.ExecuteTemplate(w, "browse.html", nil)
+// browse handles the browsing of different revisions
+func (s *server) browse(w http.ResponseWriter, r *http.Request) {
+	p := newPage(s, "/browse/", 0)
+	err := s.tmpl().ExecuteTemplate(w, "browse.html", p)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}